@@ -0,0 +1,128 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/garethgeorge/media-toolkit/internal/encodelog"
+	"github.com/garethgeorge/media-toolkit/internal/flags"
+	"github.com/garethgeorge/media-toolkit/internal/fsutil"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+var (
+	maxDiscrepancies = flag.Int("max-discrepancies", 0, "Exit non-zero if more than this many discrepancies are found")
+)
+
+func main() {
+	flag.Parse()
+
+	if flag.NArg() < 1 {
+		fmt.Println("Usage: transcodeaudit <library directory>")
+		return
+	}
+
+	libraryDir, err := filepath.Abs(flag.Arg(0))
+	if err != nil {
+		zap.S().Fatalf("Error resolving library directory: %v", err)
+	}
+
+	matches, err := fsutil.MediaInDir(libraryDir)
+	if err != nil {
+		zap.S().Fatalf("Error listing library directory: %v", err)
+	}
+	onDisk := make(map[string]bool, len(matches))
+	for _, match := range matches {
+		onDisk[match] = true
+	}
+
+	transcodeLog, err := encodelog.ReadLog(flags.LogFilePath())
+	if err != nil {
+		zap.S().Fatalf("Error reading transcode log: %v", err)
+	}
+
+	// the latest entry for each output wins, earlier attempts may have failed before a later success
+	latest := make(map[string]encodelog.LogFileEntry)
+	var order []string
+	for _, entry := range transcodeLog {
+		if !isUnder(entry.OutputPath, libraryDir) {
+			continue
+		}
+		if _, ok := latest[entry.OutputPath]; !ok {
+			order = append(order, entry.OutputPath)
+		}
+		latest[entry.OutputPath] = entry
+	}
+
+	discrepancies := 0
+	report := func(kind, path string) {
+		discrepancies++
+		fmt.Printf("%-22s %s\n", kind, path)
+	}
+
+	for _, output := range order {
+		entry := latest[output]
+		if entry.Error != "" || entry.Skipped != "" {
+			continue
+		}
+		if !onDisk[output] {
+			report("missing-output", output)
+		}
+		if onDisk[entry.InputPath] && !keepsOriginal(entry) {
+			report("not-finalized", entry.InputPath)
+		}
+	}
+
+	for _, match := range matches {
+		if !isEncoderOutput(match) {
+			continue
+		}
+		if _, ok := latest[match]; !ok {
+			report("unlogged-output", match)
+		}
+	}
+
+	fmt.Printf("Found %d discrepancies\n", discrepancies)
+	if discrepancies > *maxDiscrepancies {
+		os.Exit(1)
+	}
+}
+
+// Log entry modes of the transcoder's encode modes. Masters are -master-crf encodes, previews are -mode preview
+// placeholders waiting for -upgrade-previews.
+const (
+	modeMaster  = "master"
+	modePreview = "preview"
+)
+
+// keepsOriginal reports whether transcodefinalize deliberately keeps the original of a successful entry's output.
+func keepsOriginal(entry encodelog.LogFileEntry) bool {
+	return entry.Mode == modeMaster || entry.Mode == modePreview
+}
+
+// isEncoderOutput reports whether path is named like a finished output of the transcoder, a distribution copy or
+// a master.
+func isEncoderOutput(path string) bool {
+	base := filepath.Base(path)
+	if strings.Contains(base, ".transcode.") || strings.Contains(base, "-svtav1enc.sample.") {
+		return false
+	}
+	return strings.Contains(base, "-svtav1enc.") || strings.Contains(base, "-svtav1master.")
+}
+
+func isUnder(path, dir string) bool {
+	rel, err := filepath.Rel(dir, path)
+	return err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
+
+func init() {
+	// Create a colored zap console logger
+	consoleConfig := zap.NewDevelopmentConfig()
+	consoleConfig.EncoderConfig.EncodeLevel = zapcore.CapitalColorLevelEncoder
+	consoleLogger, _ := consoleConfig.Build()
+	zap.ReplaceGlobals(consoleLogger)
+}
@@ -0,0 +1,30 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/garethgeorge/media-toolkit/internal/encodelog"
+)
+
+func TestIsEncoderOutput(t *testing.T) {
+	for path, want := range map[string]bool{
+		"/media/movie-svtav1enc.mkv":                   true,
+		"/media/movie-svtav1master.mkv":                true,
+		"/media/movie.mkv":                             false,
+		"/media/movie-svtav1enc.sample.mkv":            false,
+		"/media/.movie-svtav1master.mkv.transcode.mkv": false,
+		"/media/movie-svtav1enc.mkv.transcode.mkv":     false,
+	} {
+		if got := isEncoderOutput(path); got != want {
+			t.Errorf("isEncoderOutput(%q) = %v, want %v", path, got, want)
+		}
+	}
+}
+
+func TestKeepsOriginal(t *testing.T) {
+	for mode, want := range map[string]bool{"": false, modeMaster: true, modePreview: true} {
+		if got := keepsOriginal(encodelog.LogFileEntry{Mode: mode}); got != want {
+			t.Errorf("keepsOriginal() of mode %q = %v, want %v", mode, got, want)
+		}
+	}
+}
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+
+	"github.com/garethgeorge/media-toolkit/internal/encodelog"
+	"github.com/garethgeorge/media-toolkit/internal/flags"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+var (
+	rotateMiB  = flag.Int64("rotate-mib", 0, "After compacting, move the log to <log>.1 if it is still at least this many MiB. Rotated entries are no longer consulted by the transcoder. 0 disables rotation.")
+	rotateKeep = flag.Int("rotate-keep", 3, "Number of rotated logs kept, <log>.1 being the newest")
+)
+
+// transcodecompactlog rewrites the encode log keeping only the latest entry of each file, entries of earlier
+// attempts that were superseded by a later run only slow down reading the log.
+func main() {
+	flag.Parse()
+
+	if *rotateMiB < 0 || *rotateKeep < 1 {
+		zap.S().Fatalf("-rotate-mib must not be negative and -rotate-keep must be at least 1")
+	}
+
+	logFile := flags.LogFilePath()
+	result, err := encodelog.Compact(logFile)
+	if err != nil {
+		zap.S().Fatalf("Error compacting transcode log %q: %v", logFile, err)
+	}
+	if result.Invalid > 0 {
+		zap.S().Warnf("Kept %d lines verbatim that don't parse", result.Invalid)
+	}
+	fmt.Printf("Compacted %q, kept %d entries and dropped %d superseded entries\n", logFile, result.Kept, result.Dropped)
+
+	if *rotateMiB > 0 {
+		rotated, err := encodelog.Rotate(logFile, *rotateMiB<<20, *rotateKeep)
+		if err != nil {
+			zap.S().Fatalf("Error rotating transcode log %q: %v", logFile, err)
+		}
+		if rotated {
+			fmt.Printf("Rotated %q to %q\n", logFile, logFile+".1")
+		}
+	}
+}
+
+func init() {
+	// Create a colored zap console logger
+	consoleConfig := zap.NewDevelopmentConfig()
+	consoleConfig.EncoderConfig.EncodeLevel = zapcore.CapitalColorLevelEncoder
+	consoleLogger, _ := consoleConfig.Build()
+	zap.ReplaceGlobals(consoleLogger)
+}
@@ -1,11 +1,16 @@
 package main
 
 import (
+	"errors"
 	"flag"
 	"fmt"
 	"os"
+	"path/filepath"
+	"strings"
+	"sync"
 
 	"github.com/garethgeorge/media-toolkit/internal/encodelog"
+	"github.com/garethgeorge/media-toolkit/internal/ffmpegutil"
 	"github.com/garethgeorge/media-toolkit/internal/flags"
 	"github.com/garethgeorge/media-toolkit/internal/fsutil"
 	"go.uber.org/zap"
@@ -13,7 +18,12 @@ import (
 )
 
 var (
-	dryRun = flag.Bool("dry-run", true, "Dry run mode")
+	dryRun         = flag.Bool("dry-run", true, "Dry run mode")
+	verify         = flag.Bool("verify", false, "Also check that each output is smaller than its original before deleting the original, see -min-savings")
+	minSavings     = flag.Float64("min-savings", 0, "With -verify, keep originals whose output isn't at least this many percent smaller")
+	integrityCheck = flag.Bool("integrity-check", true, "Re-probe each output and its original before deleting the original, keeping it if the output has no video, lost its audio or is shorter, e.g. because it was corrupted or truncated since it was encoded")
+	trashDir       = flag.String("trash-dir", "", "Move originals into this directory, keeping their path relative to the finalized directory, instead of deleting them")
+	workers        = flag.Int("workers", 8, "Number of files checked concurrently, raise on slow network filesystems where most time is spent on stats")
 )
 
 func main() {
@@ -24,7 +34,14 @@ func main() {
 		return
 	}
 
-	finalizeDir := flag.Arg(0)
+	if *workers < 1 {
+		zap.S().Fatalf("-workers must be at least 1")
+	}
+
+	finalizeDir, err := filepath.Abs(flag.Arg(0))
+	if err != nil {
+		zap.S().Fatalf("Error resolving finalized directory: %v", err)
+	}
 
 	fmt.Printf("Finalizing directory: %s\n", finalizeDir)
 
@@ -40,38 +57,203 @@ func main() {
 		zap.S().Fatalf("Error reading transcode log: %v", err)
 	}
 
-	transcodeLogMap := make(map[string]encodelog.LogFileEntry)
-	for _, entry := range transcodeLog {
-		transcodeLogMap[entry.OutputPath] = entry
+	transcodeLogMap := encodelog.Index(transcodeLog)
+
+	// checks run concurrently but results are kept in listing order so the output is deterministic
+	decisions := make([]finalizeDecision, len(matches))
+	var wg sync.WaitGroup
+	sem := make(chan struct{}, *workers)
+	for idx, match := range matches {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func() {
+			defer wg.Done()
+			defer func() { <-sem }()
+			decisions[idx] = checkMatch(match, transcodeLogMap)
+		}()
 	}
+	wg.Wait()
 
-	for _, match := range matches {
-		zap.S().Debugf("Checking if media file %q exists in transcode log", match)
-		logEntry, ok := transcodeLogMap[match]
-		if !ok {
-			zap.S().Debugf("Media file %q does not exist in transcode log", match)
-			continue
-		}
-		if logEntry.Error != "" {
-			zap.S().Warnf("Media file %q has errors in transcode log, keeping: %s", match, logEntry.Error)
+	var reclaimed int64
+	removed := 0
+	for idx, match := range matches {
+		decision := decisions[idx]
+		if !decision.Remove {
+			if decision.Keep != "" {
+				zap.S().Warnf("Media file %q %s", match, decision.Keep)
+			} else {
+				zap.S().Debugf("Media file %q %s", match, decision.Note)
+			}
 			continue
 		}
-		if logEntry.Skipped != "" {
-			zap.S().Warnf("Media file %q was skipped in transcode log, keeping: %s", match, logEntry.Skipped)
-			continue
+
+		trashPath := ""
+		if *trashDir != "" {
+			trashPath = trashDestination(*trashDir, finalizeDir, decision.Original)
 		}
 
 		// Is it a dry run?
 		if *dryRun {
-			zap.S().Infof("Would remove original media file %q", match)
+			if trashPath != "" {
+				zap.S().Infof("Would move original media file %q of %q to %q, reclaiming %s", decision.Original, match, trashPath, fsutil.FormatBytes(decision.Reclaimed))
+			} else {
+				zap.S().Infof("Would remove original media file %q of %q, reclaiming %s", decision.Original, match, fsutil.FormatBytes(decision.Reclaimed))
+			}
+			reclaimed += decision.Reclaimed
+			removed++
 			continue
 		}
 
-		zap.S().Infof("Removing original media file %q", match)
-		if err := os.Remove(match); err != nil {
-			zap.S().Warnf("Failed to remove original media file %q: %v", match, err)
+		if trashPath != "" {
+			zap.S().Infof("Moving original media file %q of %q to %q", decision.Original, match, trashPath)
+			if err := fsutil.MoveFile(decision.Original, trashPath); err != nil {
+				zap.S().Warnf("Failed to move original media file %q to the trash: %v", decision.Original, err)
+				continue
+			}
+		} else {
+			zap.S().Infof("Removing original media file %q of %q", decision.Original, match)
+			if err := os.Remove(decision.Original); err != nil {
+				zap.S().Warnf("Failed to remove original media file %q: %v", decision.Original, err)
+				continue
+			}
+		}
+		reclaimed += decision.Reclaimed
+		removed++
+	}
+
+	switch {
+	case *dryRun:
+		fmt.Printf("Would remove %d originals, reclaiming %s\n", removed, fsutil.FormatBytes(reclaimed))
+	case *trashDir != "":
+		fmt.Printf("Moved %d originals to %q, %s can be reclaimed by emptying it\n", removed, *trashDir, fsutil.FormatBytes(reclaimed))
+	default:
+		fmt.Printf("Removed %d originals, reclaimed %s\n", removed, fsutil.FormatBytes(reclaimed))
+	}
+}
+
+// trashDestination returns where -trash-dir keeps an original, at its path relative to the finalized directory.
+// Originals outside of it keep their full path under the trash directory.
+func trashDestination(trash, finalizeDir, original string) string {
+	rel, err := filepath.Rel(finalizeDir, original)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		rel = strings.TrimPrefix(original, filepath.VolumeName(original))
+	}
+	return filepath.Join(trash, rel)
+}
+
+// finalizeDecision is the outcome of checking a single output.
+type finalizeDecision struct {
+	Original string // source the output was encoded from
+	Remove   bool   // the original can be removed
+	Keep     string // why the original is kept despite a successful encode
+	Note     string // why there is nothing to do
+
+	Reclaimed int64 // bytes freed by removing the original net of the output
+}
+
+// Log entry modes of the transcoder's encode modes. Masters are -master-crf encodes, previews are -mode preview
+// placeholders waiting for -upgrade-previews.
+const (
+	modeMaster  = "master"
+	modePreview = "preview"
+)
+
+// checkMatch decides whether the original of an output can be removed. It only stats, probes and reads the log so
+// it is safe to run concurrently.
+func checkMatch(match string, transcodeLogMap map[string]encodelog.LogFileEntry) finalizeDecision {
+	logEntry, ok := transcodeLogMap[match]
+	if !ok {
+		return finalizeDecision{Note: "does not exist in transcode log"}
+	}
+	decision := finalizeDecision{Original: logEntry.InputPath}
+	if logEntry.Error != "" {
+		decision.Keep = "has errors in transcode log, keeping original: " + logEntry.Error
+		return decision
+	}
+	if logEntry.Skipped != "" {
+		decision.Keep = "was skipped in transcode log, keeping original: " + logEntry.Skipped
+		return decision
+	}
+	if logEntry.Mode == modeMaster {
+		decision.Note = "is a master encode, its original is never removed"
+		return decision
+	}
+	if logEntry.Mode == modePreview {
+		decision.Note = "is a preview encode, its original is kept for -upgrade-previews"
+		return decision
+	}
+	originalInfo, err := os.Stat(logEntry.InputPath)
+	if errors.Is(err, os.ErrNotExist) {
+		decision.Note = "is already finalized"
+		return decision
+	} else if err != nil {
+		decision.Keep = fmt.Sprintf("original could not be checked, keeping it: %v", err)
+		return decision
+	}
+	if *verify {
+		if err := checkSavings(originalInfo.Size(), match); err != nil {
+			decision.Keep = fmt.Sprintf("FAILED verification, keeping original %q: %v", logEntry.InputPath, err)
+			return decision
+		}
+	}
+	if *integrityCheck {
+		if err := checkIntegrity(logEntry, match); err != nil {
+			decision.Keep = fmt.Sprintf("FAILED integrity check, the output may be damaged, keeping original %q: %v", logEntry.InputPath, err)
+			return decision
+		}
+	}
+	decision.Remove = true
+	decision.Reclaimed = reclaimedBytes(logEntry, originalInfo.Size(), match)
+	return decision
+}
+
+// reclaimedBytes returns the space saved by an encode, from the sizes recorded in the log or for older entries
+// without them from the sizes on disk.
+func reclaimedBytes(logEntry encodelog.LogFileEntry, originalSize int64, output string) int64 {
+	if logEntry.InputSizeBytes > 0 && logEntry.OutputSizeBytes > 0 {
+		return logEntry.InputSizeBytes - logEntry.OutputSizeBytes
+	}
+	outputInfo, err := os.Stat(output)
+	if err != nil {
+		return 0
+	}
+	return originalSize - outputInfo.Size()
+}
+
+// checkSavings checks that an output on disk saves at least -min-savings percent of its original's size.
+func checkSavings(originalSize int64, output string) error {
+	outputInfo, err := os.Stat(output)
+	if err != nil {
+		return err
+	}
+	if originalSize > 0 {
+		savings := 100 * (1 - float64(outputInfo.Size())/float64(originalSize))
+		if savings <= 0 || savings < *minSavings {
+			return fmt.Errorf("output only saves %.1f%% of the original's size, want at least %.1f%%", savings, *minSavings)
+		}
+	}
+	return nil
+}
+
+// checkIntegrity re-probes an output on disk and the original of its log entry, the output must have a video stream
+// and the original's audio, duration and display aspect after any crop recorded in the entry.
+func checkIntegrity(logEntry encodelog.LogFileEntry, output string) error {
+	var crop ffmpegutil.Crop
+	if logEntry.Crop != "" {
+		var err error
+		if crop, err = ffmpegutil.ParseCrop(logEntry.Crop); err != nil {
+			return err
 		}
 	}
+	originalProbe, err := ffmpegutil.GetFfprobeInfo(logEntry.InputPath)
+	if err != nil {
+		return fmt.Errorf("probe original: %w", err)
+	}
+	outputProbe, err := ffmpegutil.GetFfprobeInfo(output)
+	if err != nil {
+		return fmt.Errorf("probe output: %w", err)
+	}
+	return ffmpegutil.VerifyOutput(originalProbe, outputProbe, crop)
 }
 
 func init() {
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/garethgeorge/media-toolkit/internal/encodelog"
+)
+
+func TestCheckMatchTargetsOriginal(t *testing.T) {
+	dir := t.TempDir()
+	original := filepath.Join(dir, "movie.mkv")
+	output := filepath.Join(dir, "movie-svtav1enc.mkv")
+	for _, path := range []string{original, output} {
+		if err := os.WriteFile(path, []byte("media"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	logMap := map[string]encodelog.LogFileEntry{
+		output: {InputPath: original, OutputPath: output},
+	}
+
+	decision := checkMatch(output, logMap)
+	if decision.Original != original {
+		t.Errorf("checkMatch(%q).Original = %q, want the logged input %q", output, decision.Original, original)
+	}
+
+	// once the original is gone the output must be left alone
+	if err := os.Remove(original); err != nil {
+		t.Fatal(err)
+	}
+	if decision := checkMatch(output, logMap); decision.Remove {
+		t.Errorf("checkMatch(%q) with the original already removed = %+v, want nothing to remove", output, decision)
+	}
+}
+
+func TestCheckMatchModes(t *testing.T) {
+	previous := *integrityCheck
+	*integrityCheck = false
+	t.Cleanup(func() { *integrityCheck = previous })
+
+	dir := t.TempDir()
+	original := filepath.Join(dir, "movie.mkv")
+	output := filepath.Join(dir, "movie-svtav1enc.mkv")
+	for _, path := range []string{original, output} {
+		if err := os.WriteFile(path, []byte("media"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		name       string
+		entry      encodelog.LogFileEntry
+		wantRemove bool
+		wantKeep   bool
+	}{
+		{name: "quality", entry: encodelog.LogFileEntry{}, wantRemove: true},
+		{name: "master", entry: encodelog.LogFileEntry{Mode: modeMaster}},
+		{name: "preview", entry: encodelog.LogFileEntry{Mode: modePreview}},
+		{name: "error", entry: encodelog.LogFileEntry{Error: "exit status 1"}, wantKeep: true},
+	}
+	for _, tc := range tests {
+		tc.entry.InputPath, tc.entry.OutputPath = original, output
+		decision := checkMatch(output, map[string]encodelog.LogFileEntry{output: tc.entry})
+		if decision.Remove != tc.wantRemove || (decision.Keep != "") != tc.wantKeep {
+			t.Errorf("%s: checkMatch() = %+v, want Remove %v and a Keep reason %v", tc.name, decision, tc.wantRemove, tc.wantKeep)
+		}
+		if !tc.wantRemove && !tc.wantKeep && decision.Note == "" {
+			t.Errorf("%s: checkMatch() = %+v, want a note why the original is kept", tc.name, decision)
+		}
+	}
+}
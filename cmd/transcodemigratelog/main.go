@@ -0,0 +1,44 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+
+	"github.com/garethgeorge/media-toolkit/internal/encodelog"
+	"github.com/garethgeorge/media-toolkit/internal/flags"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+var (
+	backupFile = flag.String("backup", "", "Where to move the original log, defaults to <log>.pre-migrate.bak. Must not exist.")
+)
+
+// transcodemigratelog rewrites an encode log written by older builds, which wrote empty fields, in the canonical
+// format of the encodelog package.
+func main() {
+	flag.Parse()
+
+	logFile := flags.LogFilePath()
+	backup := *backupFile
+	if backup == "" {
+		backup = logFile + ".pre-migrate.bak"
+	}
+
+	result, err := encodelog.MigrateLog(logFile, backup)
+	if err != nil {
+		zap.S().Fatalf("Error migrating transcode log %q: %v", logFile, err)
+	}
+	if result.Kept > 0 {
+		zap.S().Warnf("Kept %d entries verbatim that have unknown fields or don't parse", result.Kept)
+	}
+	fmt.Printf("Migrated %d entries of %q, the original is backed up at %q\n", result.Rewritten, logFile, backup)
+}
+
+func init() {
+	// Create a colored zap console logger
+	consoleConfig := zap.NewDevelopmentConfig()
+	consoleConfig.EncoderConfig.EncodeLevel = zapcore.CapitalColorLevelEncoder
+	consoleLogger, _ := consoleConfig.Build()
+	zap.ReplaceGlobals(consoleLogger)
+}
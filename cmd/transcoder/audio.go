@@ -0,0 +1,386 @@
+package main
+
+import (
+	"fmt"
+	"maps"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/garethgeorge/media-toolkit/internal/encodelog"
+	"github.com/garethgeorge/media-toolkit/internal/ffmpegutil"
+)
+
+// Surround policies control how audio tracks with more than two channels are carried into the output.
+const (
+	surroundCopy       = "copy"        // copy surround tracks as-is
+	surroundCopyStereo = "copy+stereo" // copy surround tracks and add a stereo downmix companion after each
+	surroundStereo     = "stereo"      // replace surround tracks with a stereo downmix
+)
+
+var surroundPolicies = []string{surroundCopy, surroundCopyStereo, surroundStereo}
+
+// Channel preferences used to choose between several audio tracks in the same language.
+const (
+	preferMostChannels   = "most"
+	preferFewestChannels = "fewest"
+)
+
+// audioOptions controls which source audio tracks are kept and how they are converted.
+type audioOptions struct {
+	SurroundPolicy string   // one of surroundPolicies
+	PreferChannels string   // if set keep only one track per language, the one with the most or fewest channels
+	Languages      []string // if set keep only tracks in these languages, und matching untagged tracks
+	Tracks         []int    // if set keep exactly these source audio stream indices, overriding Languages and PreferChannels
+	CopyCodecs     []string // codecs the output container can carry, surround tracks in other codecs are downmixed instead of copied, nil allows any
+	Channels       int      // channels encoded tracks are downmixed to, 0 keeps the source's, see downmixChannels
+}
+
+func audioOptionsFromFlags() audioOptions {
+	tracks, _ := parseAudioTracks(*audioTracks) // validated at startup
+	return audioOptions{
+		SurroundPolicy: *surroundPolicy,
+		PreferChannels: *preferChannels,
+		Languages:      parseList(*audioLangs),
+		Tracks:         tracks,
+		CopyCodecs:     containerFor(outputExtension()).AudioCopyCodecs,
+		Channels:       *audioDownmixChannels,
+	}
+}
+
+// parseAudioTracks parses a comma separated list of zero-based audio stream indices e.g. 0,2. An empty value
+// returns nil.
+func parseAudioTracks(value string) ([]int, error) {
+	var tracks []int
+	for _, item := range parseList(value) {
+		idx, err := strconv.Atoi(item)
+		if err != nil || idx < 0 {
+			return nil, fmt.Errorf("audio track %q must be a zero-based audio stream index", item)
+		}
+		tracks = append(tracks, idx)
+	}
+	return tracks, nil
+}
+
+// validateAudioTracks checks that every selected audio stream index exists in the source.
+func validateAudioTracks(probeData ffmpegutil.ProbeData, tracks []int) error {
+	count := 0
+	for _, stream := range probeData.Streams {
+		if stream.IsAudio() {
+			count++
+		}
+	}
+	for _, idx := range tracks {
+		if idx >= count {
+			return fmt.Errorf("-audio-tracks selects audio stream %d but the source has %d audio streams", idx, count)
+		}
+	}
+	return nil
+}
+
+// audioTrackPlan describes a single output audio track.
+type audioTrackPlan struct {
+	SourceIdx int    // index among the source's audio streams i.e. the N in 0:a:N
+	Language  string // language tag of the source stream, may be empty
+	Title     string // title tag of the source stream, may be empty
+	Channels  int    // channel count of the source stream
+	Copy      bool   // stream copy the source, otherwise encode it
+	DownmixTo int    // channels a surround track is downmixed to, 0 if it isn't downmixed
+}
+
+// downmixChannels returns the channels a surround track of sourceChannels is downmixed to. Unless fewer channels are
+// requested it is stereo, so that a downmix never keeps every channel e.g. when -audio-downmix-channels is 0.
+func downmixChannels(requested, sourceChannels int) int {
+	if requested > 0 && requested < sourceChannels {
+		return requested
+	}
+	return 2
+}
+
+// describeChannels names a channel count for decisions e.g. stereo or 6ch.
+func describeChannels(channels int) string {
+	switch channels {
+	case 1:
+		return "mono"
+	case 2:
+		return "stereo"
+	}
+	return fmt.Sprintf("%dch", channels)
+}
+
+// planAudioTracks decides which output audio tracks to produce for the source's audio streams. Every kept
+// track gets the same treatment: stereo (or fewer channels) is encoded to opts.Channels and surround is handled
+// according to the surround policy.
+func planAudioTracks(probeData ffmpegutil.ProbeData, opts audioOptions) ([]audioTrackPlan, []encodelog.StreamDecision) {
+	var plan []audioTrackPlan
+	var decisions []encodelog.StreamDecision
+
+	dropped := make(map[int]encodelog.StreamDecision)
+	fellBack := false
+	if opts.Tracks != nil {
+		dropped = dropUnselectedTracks(probeData, opts.Tracks)
+	} else {
+		if opts.Languages != nil {
+			dropped, fellBack = dropOtherLanguages(probeData, opts.Languages)
+		}
+		// after a fallback only one track is left, it must not be dropped as a duplicate of a disallowed one
+		if opts.PreferChannels != "" && !fellBack {
+			maps.Copy(dropped, dropDuplicateLanguages(probeData, opts.PreferChannels))
+		}
+	}
+
+	for idx, stream := range probeData.Streams {
+		if !stream.IsAudio() {
+			continue
+		}
+		if decision, ok := dropped[idx]; ok {
+			decisions = append(decisions, decision)
+			continue
+		}
+		audioIdx := probeData.MapStreamIdx("audio", idx)
+		track := audioTrackPlan{
+			SourceIdx: audioIdx,
+			Language:  stream.Tags.Language,
+			Title:     stream.Tags.Title,
+			Channels:  stream.Channels,
+		}
+		specifier := fmt.Sprintf("0:a:%d", audioIdx)
+		desc := describeAudioStream(stream)
+		if opts.Tracks != nil {
+			desc += " selected by -audio-tracks,"
+		} else if fellBack {
+			desc += " first track kept as none is in -audio-langs,"
+		}
+
+		if !stream.IsSurroundAudio() {
+			channels := stream.Channels
+			if opts.Channels > 0 {
+				channels = opts.Channels
+			}
+			plan = append(plan, track)
+			decisions = append(decisions, encodelog.StreamDecision{Stream: specifier, Action: "encode", Reason: desc + " encoded to " + describeChannels(channels)})
+			continue
+		}
+		downmix := downmixChannels(opts.Channels, stream.Channels)
+
+		policy := opts.SurroundPolicy
+		if opts.CopyCodecs != nil && !slices.Contains(opts.CopyCodecs, strings.ToLower(stream.CodecName)) {
+			policy = surroundStereo
+			desc += fmt.Sprintf(" codec %s can't be copied into the container,", stream.CodecName)
+		}
+		switch policy {
+		case surroundStereo:
+			track.DownmixTo = downmix
+			plan = append(plan, track)
+			decisions = append(decisions, encodelog.StreamDecision{Stream: specifier, Action: "downmix", Reason: desc + " downmixed to " + describeChannels(downmix)})
+		case surroundCopyStereo:
+			copied := track
+			copied.Copy = true
+			track.DownmixTo = downmix
+			plan = append(plan, copied, track)
+			decisions = append(decisions,
+				encodelog.StreamDecision{Stream: specifier, Action: "copy", Reason: desc + " copied"},
+				encodelog.StreamDecision{Stream: specifier, Action: "downmix", Reason: desc + " " + describeChannels(downmix) + " companion"},
+			)
+		default:
+			track.Copy = true
+			plan = append(plan, track)
+			decisions = append(decisions, encodelog.StreamDecision{Stream: specifier, Action: "copy", Reason: desc + " copied"})
+		}
+	}
+
+	return plan, decisions
+}
+
+// dropUnselectedTracks returns drop decisions for the audio streams not in tracks keyed by their index in
+// probeData.Streams.
+func dropUnselectedTracks(probeData ffmpegutil.ProbeData, tracks []int) map[int]encodelog.StreamDecision {
+	dropped := make(map[int]encodelog.StreamDecision)
+	for idx, stream := range probeData.Streams {
+		if !stream.IsAudio() {
+			continue
+		}
+		audioIdx := probeData.MapStreamIdx("audio", idx)
+		if slices.Contains(tracks, audioIdx) {
+			continue
+		}
+		dropped[idx] = encodelog.StreamDecision{
+			Stream: fmt.Sprintf("0:a:%d", audioIdx),
+			Action: "drop",
+			Reason: describeAudioStream(stream) + " not selected by -audio-tracks",
+		}
+	}
+	return dropped
+}
+
+// dropOtherLanguages returns drop decisions for the audio streams whose language isn't in languages keyed by their
+// index in probeData.Streams. If no stream is in an allowed language the first audio stream is kept so that the
+// output isn't silent, fellBack reports whether that happened.
+func dropOtherLanguages(probeData ffmpegutil.ProbeData, languages []string) (dropped map[int]encodelog.StreamDecision, fellBack bool) {
+	dropped = make(map[int]encodelog.StreamDecision)
+	first, kept := -1, 0
+	for idx, stream := range probeData.Streams {
+		if !stream.IsAudio() {
+			continue
+		}
+		if first < 0 {
+			first = idx
+		}
+		if slices.Contains(languages, normalizeLanguage(stream.Tags.Language)) {
+			kept++
+			continue
+		}
+		dropped[idx] = encodelog.StreamDecision{
+			Stream: fmt.Sprintf("0:a:%d", probeData.MapStreamIdx("audio", idx)),
+			Action: "drop",
+			Reason: describeAudioStream(stream) + " language not in -audio-langs",
+		}
+	}
+	if first >= 0 && kept == 0 {
+		delete(dropped, first)
+		fellBack = true
+	}
+	return dropped, fellBack
+}
+
+// dropDuplicateLanguages picks one audio stream per language, the one with the most or fewest channels depending
+// on prefer, ties going to the earlier stream. It returns drop decisions for the other streams keyed by their
+// index in probeData.Streams.
+func dropDuplicateLanguages(probeData ffmpegutil.ProbeData, prefer string) map[int]encodelog.StreamDecision {
+	best := make(map[string]int) // language -> index in probeData.Streams of the preferred stream
+	for idx, stream := range probeData.Streams {
+		if !stream.IsAudio() {
+			continue
+		}
+		lang := normalizeLanguage(stream.Tags.Language)
+		current, ok := best[lang]
+		if !ok {
+			best[lang] = idx
+			continue
+		}
+		channels, currentChannels := stream.Channels, probeData.Streams[current].Channels
+		if (prefer == preferMostChannels && channels > currentChannels) || (prefer == preferFewestChannels && channels < currentChannels) {
+			best[lang] = idx
+		}
+	}
+
+	dropped := make(map[int]encodelog.StreamDecision)
+	for idx, stream := range probeData.Streams {
+		if !stream.IsAudio() {
+			continue
+		}
+		kept := best[normalizeLanguage(stream.Tags.Language)]
+		if kept == idx {
+			continue
+		}
+		dropped[idx] = encodelog.StreamDecision{
+			Stream: fmt.Sprintf("0:a:%d", probeData.MapStreamIdx("audio", idx)),
+			Action: "drop",
+			Reason: fmt.Sprintf("%s duplicate, kept 0:a:%d with the %s channels (%dch)", describeAudioStream(stream), probeData.MapStreamIdx("audio", kept), prefer, probeData.Streams[kept].Channels),
+		}
+	}
+	return dropped
+}
+
+func normalizeLanguage(lang string) string {
+	lang = strings.ToLower(strings.TrimSpace(lang))
+	if lang == "" {
+		return "und"
+	}
+	return lang
+}
+
+// audioEncoding is how audio tracks that aren't copied are encoded.
+type audioEncoding struct {
+	Codec    string // ffmpeg audio encoder e.g. libopus
+	Bitrate  string // e.g. 192k, empty leaves the encoder default
+	Channels int    // channels to encode to, 0 keeps the source's, downmixed surround tracks use their DownmixTo
+}
+
+var defaultAudioEncoding = audioEncoding{Codec: "libopus", Bitrate: "192k", Channels: 2}
+
+func audioEncodingFromFlags() audioEncoding {
+	return audioEncoding{
+		Codec:    *audioCodec,
+		Bitrate:  *audioBitrate,
+		Channels: *audioDownmixChannels,
+	}
+}
+
+// validate checks the encoding flags at startup.
+func (e audioEncoding) validate() error {
+	if strings.TrimSpace(e.Codec) == "" {
+		return fmt.Errorf("audio codec must not be empty")
+	}
+	if e.Channels < 0 {
+		return fmt.Errorf("audio downmix channels must not be negative")
+	}
+	if e.Bitrate != "" {
+		if _, err := parseBitrate(e.Bitrate); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// parseBitrate parses an ffmpeg style bitrate e.g. 192k or 1.5M into bits per second.
+func parseBitrate(value string) (int, error) {
+	multiplier := 1.0
+	number := value
+	switch {
+	case strings.HasSuffix(value, "k"):
+		multiplier, number = 1e3, strings.TrimSuffix(value, "k")
+	case strings.HasSuffix(value, "M"):
+		multiplier, number = 1e6, strings.TrimSuffix(value, "M")
+	}
+	n, err := strconv.ParseFloat(number, 64)
+	if err != nil || n <= 0 {
+		return 0, fmt.Errorf("invalid bitrate %q, want e.g. 192k", value)
+	}
+	return int(n * multiplier), nil
+}
+
+// audioTrackArgs converts an audio plan into ffmpeg mapping and codec arguments. Codec options use per
+// output stream specifiers so that they never leak onto copied tracks.
+func audioTrackArgs(plan []audioTrackPlan, enc audioEncoding) []string {
+	var args []string
+	for outIdx, track := range plan {
+		args = append(args, "-map", fmt.Sprintf("0:a:%d", track.SourceIdx))
+		if track.Copy {
+			args = append(args, fmt.Sprintf("-c:a:%d", outIdx), "copy")
+			continue
+		}
+		args = append(args, fmt.Sprintf("-c:a:%d", outIdx), enc.Codec)
+		if enc.Bitrate != "" {
+			args = append(args, fmt.Sprintf("-b:a:%d", outIdx), enc.Bitrate)
+		}
+		channels := enc.Channels
+		if track.DownmixTo > 0 {
+			channels = track.DownmixTo
+		}
+		if channels > 0 {
+			args = append(args, fmt.Sprintf("-ac:a:%d", outIdx), strconv.Itoa(channels))
+		}
+	}
+	return args
+}
+
+// audioMetadataArgs tags each output audio track with its source's language and, unless stripping, its title. ffmpeg
+// numbers output streams after reordering and filtering so the tags are applied by output index, which also keeps
+// them on tracks that are encoded or downmixed.
+func audioMetadataArgs(plan []audioTrackPlan, strip bool) []string {
+	var args []string
+	for outIdx, track := range plan {
+		if track.Language != "" {
+			args = append(args, fmt.Sprintf("-metadata:s:a:%d", outIdx), "language="+track.Language)
+		}
+		if track.Title != "" && !strip {
+			args = append(args, fmt.Sprintf("-metadata:s:a:%d", outIdx), "title="+track.Title)
+		}
+	}
+	return args
+}
+
+func describeAudioStream(stream ffmpegutil.StreamData) string {
+	return fmt.Sprintf("%s %dch", normalizeLanguage(stream.Tags.Language), stream.Channels)
+}
@@ -0,0 +1,320 @@
+package main
+
+import (
+	"encoding/json"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/garethgeorge/media-toolkit/internal/encodelog"
+	"github.com/garethgeorge/media-toolkit/internal/ffmpegutil"
+)
+
+func mustParseProbe(t *testing.T, data string) ffmpegutil.ProbeData {
+	t.Helper()
+	var pd ffmpegutil.ProbeData
+	if err := json.Unmarshal([]byte(data), &pd); err != nil {
+		t.Fatalf("failed to parse probe fixture: %v", err)
+	}
+	return pd
+}
+
+const threeLanguageProbe = `{
+	"format": {"bit_rate": "8000000"},
+	"streams": [
+		{"codec_type": "video", "codec_name": "h264", "width": 1920, "height": 1080},
+		{"codec_type": "audio", "codec_name": "ac3", "channels": 6, "tags": {"language": "eng"}},
+		{"codec_type": "audio", "codec_name": "aac", "channels": 2, "tags": {"language": "fre"}},
+		{"codec_type": "audio", "codec_name": "dts", "channels": 8, "tags": {"language": "jpn"}},
+		{"codec_type": "subtitle", "codec_name": "subrip", "tags": {"language": "eng"}}
+	]
+}`
+
+func TestPlanAudioTracks(t *testing.T) {
+	pd := mustParseProbe(t, threeLanguageProbe)
+
+	tests := []struct {
+		policy     string
+		wantTracks []audioTrackPlan
+		wantArgs   []string
+	}{
+		{
+			policy: surroundCopy,
+			wantTracks: []audioTrackPlan{
+				{SourceIdx: 0, Language: "eng", Channels: 6, Copy: true},
+				{SourceIdx: 1, Language: "fre", Channels: 2},
+				{SourceIdx: 2, Language: "jpn", Channels: 8, Copy: true},
+			},
+			wantArgs: []string{
+				"-map", "0:a:0", "-c:a:0", "copy",
+				"-map", "0:a:1", "-c:a:1", "libopus", "-b:a:1", "192k", "-ac:a:1", "2",
+				"-map", "0:a:2", "-c:a:2", "copy",
+			},
+		},
+		{
+			policy: surroundCopyStereo,
+			wantTracks: []audioTrackPlan{
+				{SourceIdx: 0, Language: "eng", Channels: 6, Copy: true},
+				{SourceIdx: 0, Language: "eng", Channels: 6, DownmixTo: 2},
+				{SourceIdx: 1, Language: "fre", Channels: 2},
+				{SourceIdx: 2, Language: "jpn", Channels: 8, Copy: true},
+				{SourceIdx: 2, Language: "jpn", Channels: 8, DownmixTo: 2},
+			},
+			wantArgs: []string{
+				"-map", "0:a:0", "-c:a:0", "copy",
+				"-map", "0:a:0", "-c:a:1", "libopus", "-b:a:1", "192k", "-ac:a:1", "2",
+				"-map", "0:a:1", "-c:a:2", "libopus", "-b:a:2", "192k", "-ac:a:2", "2",
+				"-map", "0:a:2", "-c:a:3", "copy",
+				"-map", "0:a:2", "-c:a:4", "libopus", "-b:a:4", "192k", "-ac:a:4", "2",
+			},
+		},
+		{
+			policy: surroundStereo,
+			wantTracks: []audioTrackPlan{
+				{SourceIdx: 0, Language: "eng", Channels: 6, DownmixTo: 2},
+				{SourceIdx: 1, Language: "fre", Channels: 2},
+				{SourceIdx: 2, Language: "jpn", Channels: 8, DownmixTo: 2},
+			},
+			wantArgs: []string{
+				"-map", "0:a:0", "-c:a:0", "libopus", "-b:a:0", "192k", "-ac:a:0", "2",
+				"-map", "0:a:1", "-c:a:1", "libopus", "-b:a:1", "192k", "-ac:a:1", "2",
+				"-map", "0:a:2", "-c:a:2", "libopus", "-b:a:2", "192k", "-ac:a:2", "2",
+			},
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.policy, func(t *testing.T) {
+			plan, decisions := planAudioTracks(pd, audioOptions{SurroundPolicy: tc.policy})
+			if !slices.Equal(plan, tc.wantTracks) {
+				t.Errorf("planAudioTracks() plan = %+v, want %+v", plan, tc.wantTracks)
+			}
+			if len(decisions) != len(tc.wantTracks) {
+				t.Errorf("planAudioTracks() returned %d decisions, want %d: %v", len(decisions), len(tc.wantTracks), decisions)
+			}
+			if args := audioTrackArgs(plan, defaultAudioEncoding); !slices.Equal(args, tc.wantArgs) {
+				t.Errorf("audioTrackArgs() = %v, want %v", args, tc.wantArgs)
+			}
+		})
+	}
+}
+
+const duplicateLanguageProbe = `{
+	"format": {"bit_rate": "8000000"},
+	"streams": [
+		{"codec_type": "video", "codec_name": "h264", "width": 1920, "height": 1080},
+		{"codec_type": "audio", "codec_name": "aac", "channels": 2, "tags": {"language": "eng"}},
+		{"codec_type": "audio", "codec_name": "ac3", "channels": 6, "tags": {"language": "eng"}},
+		{"codec_type": "audio", "codec_name": "aac", "channels": 2, "tags": {"language": "fre"}}
+	]
+}`
+
+func TestPlanAudioTracksPreferChannels(t *testing.T) {
+	pd := mustParseProbe(t, duplicateLanguageProbe)
+
+	tests := []struct {
+		prefer      string
+		wantTracks  []audioTrackPlan
+		wantDropped string
+	}{
+		{
+			prefer: preferMostChannels,
+			wantTracks: []audioTrackPlan{
+				{SourceIdx: 1, Language: "eng", Channels: 6, Copy: true},
+				{SourceIdx: 2, Language: "fre", Channels: 2},
+			},
+			wantDropped: "0:a:0",
+		},
+		{
+			prefer: preferFewestChannels,
+			wantTracks: []audioTrackPlan{
+				{SourceIdx: 0, Language: "eng", Channels: 2},
+				{SourceIdx: 2, Language: "fre", Channels: 2},
+			},
+			wantDropped: "0:a:1",
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.prefer, func(t *testing.T) {
+			plan, decisions := planAudioTracks(pd, audioOptions{SurroundPolicy: surroundCopy, PreferChannels: tc.prefer})
+			if !slices.Equal(plan, tc.wantTracks) {
+				t.Errorf("planAudioTracks() plan = %+v, want %+v", plan, tc.wantTracks)
+			}
+			if !slices.ContainsFunc(decisions, func(d encodelog.StreamDecision) bool {
+				return d.Stream == tc.wantDropped && d.Action == "drop"
+			}) {
+				t.Errorf("planAudioTracks() decisions %v missing drop of %s", decisions, tc.wantDropped)
+			}
+		})
+	}
+}
+
+func TestPlanAudioTracksLanguages(t *testing.T) {
+	pd := mustParseProbe(t, duplicateLanguageProbe)
+
+	tests := []struct {
+		name       string
+		languages  []string
+		wantTracks []audioTrackPlan
+	}{
+		{
+			name:      "allowlisted",
+			languages: []string{"fre", "und"},
+			wantTracks: []audioTrackPlan{
+				{SourceIdx: 2, Language: "fre", Channels: 2},
+			},
+		},
+		{
+			name:      "allowlisted with duplicates",
+			languages: []string{"eng"},
+			wantTracks: []audioTrackPlan{
+				{SourceIdx: 1, Language: "eng", Channels: 6, Copy: true},
+			},
+		},
+		{
+			// the first track is kept even though a better eng track would be preferred
+			name:      "no match falls back to the first track",
+			languages: []string{"jpn"},
+			wantTracks: []audioTrackPlan{
+				{SourceIdx: 0, Language: "eng", Channels: 2},
+			},
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			plan, decisions := planAudioTracks(pd, audioOptions{SurroundPolicy: surroundCopy, PreferChannels: preferMostChannels, Languages: tc.languages})
+			if !slices.Equal(plan, tc.wantTracks) {
+				t.Errorf("planAudioTracks() plan = %+v, want %+v", plan, tc.wantTracks)
+			}
+			if len(decisions) != 3 {
+				t.Errorf("planAudioTracks() decisions = %v, want one per source track", decisions)
+			}
+		})
+	}
+}
+
+func TestPlanAudioTracksExplicitSelection(t *testing.T) {
+	pd := mustParseProbe(t, duplicateLanguageProbe)
+
+	tracks, err := parseAudioTracks("1")
+	if err != nil {
+		t.Fatalf("parseAudioTracks() error: %v", err)
+	}
+	if err := validateAudioTracks(pd, tracks); err != nil {
+		t.Fatalf("validateAudioTracks() error: %v", err)
+	}
+	plan, decisions := planAudioTracks(pd, audioOptions{SurroundPolicy: surroundCopy, PreferChannels: preferFewestChannels, Tracks: tracks})
+	want := []audioTrackPlan{{SourceIdx: 1, Language: "eng", Channels: 6, Copy: true}}
+	if !slices.Equal(plan, want) {
+		t.Errorf("planAudioTracks() plan = %+v, want %+v", plan, want)
+	}
+	for _, decision := range decisions {
+		if !strings.Contains(decision.Reason, "-audio-tracks") {
+			t.Errorf("planAudioTracks() decision %v doesn't mention the explicit selection", decision)
+		}
+	}
+
+	if err := validateAudioTracks(pd, []int{3}); err == nil {
+		t.Errorf("validateAudioTracks() of out of range stream succeeded, want an error")
+	}
+	if _, err := parseAudioTracks("0,-1"); err == nil {
+		t.Errorf("parseAudioTracks(\"0,-1\") succeeded, want an error")
+	}
+}
+
+func TestDownmixKeepingSourceChannels(t *testing.T) {
+	pd := mustParseProbe(t, threeLanguageProbe)
+	enc := audioEncoding{Codec: "libopus", Bitrate: "192k"}
+
+	// without a channel count the companion must still be stereo or it duplicates the copied surround track
+	plan, decisions := planAudioTracks(pd, audioOptions{SurroundPolicy: surroundCopyStereo, Channels: enc.Channels})
+	args := audioTrackArgs(plan, enc)
+	for _, seq := range [][]string{{"-map", "0:a:0", "-c:a:1", "libopus", "-b:a:1", "192k", "-ac:a:1", "2"}, {"-c:a:4", "libopus", "-b:a:4", "192k", "-ac:a:4", "2"}} {
+		if !containsSeq(args, seq...) {
+			t.Errorf("audioTrackArgs() with 0 channels = %v, want %v", args, seq)
+		}
+	}
+	if containsSeq(args, "-ac:a:2") {
+		t.Errorf("audioTrackArgs() with 0 channels = %v, want the stereo track's channels kept", args)
+	}
+	if got := decisions[1].Reason; !strings.Contains(got, "stereo companion") {
+		t.Errorf("planAudioTracks() companion decision = %q, want a stereo companion", got)
+	}
+
+	_, decisions = planAudioTracks(pd, audioOptions{SurroundPolicy: surroundStereo, Channels: 6})
+	if got := decisions[2].Reason; !strings.Contains(got, "downmixed to 6ch") {
+		t.Errorf("planAudioTracks() with 6 channels decision = %q, want downmixed to 6ch", got)
+	}
+}
+
+func TestAudioTrackArgsEncoding(t *testing.T) {
+	plan := []audioTrackPlan{{SourceIdx: 0, Channels: 6, Copy: true}, {SourceIdx: 1, Channels: 6}}
+	tests := []struct {
+		enc  audioEncoding
+		want []string
+	}{
+		{
+			enc:  audioEncoding{Codec: "aac", Bitrate: "256k", Channels: 2},
+			want: []string{"-map", "0:a:0", "-c:a:0", "copy", "-map", "0:a:1", "-c:a:1", "aac", "-b:a:1", "256k", "-ac:a:1", "2"},
+		},
+		{
+			enc:  audioEncoding{Codec: "libopus", Bitrate: "384k"},
+			want: []string{"-map", "0:a:0", "-c:a:0", "copy", "-map", "0:a:1", "-c:a:1", "libopus", "-b:a:1", "384k"},
+		},
+	}
+	for _, tc := range tests {
+		if args := audioTrackArgs(plan, tc.enc); !slices.Equal(args, tc.want) {
+			t.Errorf("audioTrackArgs(%+v) = %v, want %v", tc.enc, args, tc.want)
+		}
+	}
+
+	for _, enc := range []audioEncoding{{Codec: " "}, {Codec: "aac", Channels: -1}, {Codec: "aac", Bitrate: "lots"}} {
+		if err := enc.validate(); err == nil {
+			t.Errorf("audioEncoding%+v.validate() succeeded, want an error", enc)
+		}
+	}
+}
+
+func TestAudioMetadataArgs(t *testing.T) {
+	plan := []audioTrackPlan{
+		{SourceIdx: 2, Language: "jpn", Title: "Japanese 5.1", Channels: 6, Copy: true},
+		{SourceIdx: 2, Language: "jpn", Title: "Japanese 5.1", Channels: 6},
+		{SourceIdx: 0, Channels: 2, Title: "Commentary"},
+		{SourceIdx: 1, Channels: 2},
+	}
+	want := []string{
+		"-metadata:s:a:0", "language=jpn", "-metadata:s:a:0", "title=Japanese 5.1",
+		"-metadata:s:a:1", "language=jpn", "-metadata:s:a:1", "title=Japanese 5.1",
+		"-metadata:s:a:2", "title=Commentary",
+	}
+	if args := audioMetadataArgs(plan, false); !slices.Equal(args, want) {
+		t.Errorf("audioMetadataArgs() = %v, want %v", args, want)
+	}
+	wantStripped := []string{"-metadata:s:a:0", "language=jpn", "-metadata:s:a:1", "language=jpn"}
+	if args := audioMetadataArgs(plan, true); !slices.Equal(args, wantStripped) {
+		t.Errorf("audioMetadataArgs() stripped = %v, want %v", args, wantStripped)
+	}
+}
+
+func TestMetadataMapping(t *testing.T) {
+	pd := mustParseProbe(t, threeLanguageProbe)
+	for _, strip := range []bool{false, true} {
+		setFlag(t, stripMetadata, strip)
+		args, _, err := createFfmpegCommand(pd, "in.mkv", "out.mkv")
+		if err != nil {
+			t.Fatalf("createFfmpegCommand() error: %v", err)
+		}
+		want := "0"
+		if strip {
+			want = "-1"
+		}
+		if !containsSeq(args, "-map_metadata", want) {
+			t.Errorf("createFfmpegCommand() with -strip-metadata=%v = %v, want -map_metadata %s", strip, args, want)
+		}
+		if !containsSeq(args, "-metadata:s:a:0", "language=eng") {
+			t.Errorf("createFfmpegCommand() with -strip-metadata=%v = %v, want the audio language tagged", strip, args)
+		}
+	}
+}
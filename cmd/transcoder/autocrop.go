@@ -0,0 +1,88 @@
+package main
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/garethgeorge/media-toolkit/internal/encodelog"
+	"github.com/garethgeorge/media-toolkit/internal/ffmpegutil"
+	"go.uber.org/zap"
+)
+
+const (
+	minCropShare = 0.02 // crops removing less of the width and height than this aren't worth a filter
+	maxCropShare = 0.5  // crops removing more of either than this are more likely a misdetection than black bars
+)
+
+var (
+	autocropMu   sync.Mutex
+	autocropSeen = map[string]ffmpegutil.Crop{} // detected crops by source path, the zero Crop if none
+)
+
+// autocropFilter returns the -autocrop filter for a source and a decision recording it, an empty filter if the source
+// has no black bars or they can't be detected reliably.
+func autocropFilter(probeData ffmpegutil.ProbeData, sourceFileName string) (string, *encodelog.StreamDecision) {
+	crop, ok := appliedCrop(probeData, sourceFileName)
+	if !ok {
+		return "", nil
+	}
+	videoStream := probeData.GetPrimaryVideoStream()
+	return crop.Filter(), &encodelog.StreamDecision{
+		Stream: "0:v",
+		Action: "crop",
+		Reason: fmt.Sprintf("black bars removed, %dx%d cropped to %dx%d", videoStream.Width, videoStream.Height, crop.Width, crop.Height),
+	}
+}
+
+// appliedCrop returns the crop -autocrop applies to a source, false if it is off or the source isn't cropped.
+// Detection runs once per source so that a two-pass encode's passes and the checks of its output see the same crop.
+// Call forgetAutocrop once the source is done with.
+func appliedCrop(probeData ffmpegutil.ProbeData, sourceFileName string) (ffmpegutil.Crop, bool) {
+	if !*autocrop {
+		return ffmpegutil.Crop{}, false
+	}
+	autocropMu.Lock()
+	defer autocropMu.Unlock()
+	crop, ok := autocropSeen[sourceFileName]
+	if !ok {
+		detected, stable, err := ffmpegutil.DetectCrop(sourceFileName, probeData.PrimaryVideoStreamIndex(), probeData.GetDurationSeconds())
+		if err != nil {
+			zap.S().Warnf("Item %q crop detection failed, not cropping: %v", sourceFileName, err)
+		} else if !stable {
+			zap.S().Infof("Item %q detected crop isn't stable across the file, not cropping", sourceFileName)
+		} else {
+			crop = detected
+		}
+		autocropSeen[sourceFileName] = crop
+	}
+
+	videoStream := probeData.GetPrimaryVideoStream()
+	if !worthCropping(crop, videoStream.Width, videoStream.Height) {
+		return ffmpegutil.Crop{}, false
+	}
+	return crop, true
+}
+
+// forgetAutocrop drops the remembered crop of a source so that it is detected again if the source changes.
+func forgetAutocrop(sourceFileName string) {
+	autocropMu.Lock()
+	defer autocropMu.Unlock()
+	delete(autocropSeen, sourceFileName)
+}
+
+// worthCropping reports whether a detected crop removes enough of a width x height frame to be applied, and not so
+// much that it is implausible.
+func worthCropping(crop ffmpegutil.Crop, width, height int) bool {
+	if crop.Width <= 0 || crop.Height <= 0 || width <= 0 || height <= 0 {
+		return false
+	}
+	if crop.X+crop.Width > width || crop.Y+crop.Height > height {
+		return false
+	}
+	removedW := 1 - float64(crop.Width)/float64(width)
+	removedH := 1 - float64(crop.Height)/float64(height)
+	if removedW > maxCropShare || removedH > maxCropShare {
+		return false
+	}
+	return removedW >= minCropShare || removedH >= minCropShare
+}
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/garethgeorge/media-toolkit/internal/ffmpegutil"
+)
+
+func TestWorthCropping(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		crop ffmpegutil.Crop
+		want bool
+	}{
+		{name: "letterbox", crop: ffmpegutil.Crop{Width: 1920, Height: 800, Y: 140}, want: true},
+		{name: "pillarbox", crop: ffmpegutil.Crop{Width: 1440, Height: 1080, X: 240}, want: true},
+		{name: "full frame", crop: ffmpegutil.Crop{Width: 1920, Height: 1080}, want: false},
+		{name: "few rows", crop: ffmpegutil.Crop{Width: 1920, Height: 1072, Y: 4}, want: false},
+		{name: "most of the frame", crop: ffmpegutil.Crop{Width: 1920, Height: 400, Y: 340}, want: false},
+		{name: "outside the frame", crop: ffmpegutil.Crop{Width: 1920, Height: 800, Y: 400}, want: false},
+		{name: "none", want: false},
+	} {
+		if got := worthCropping(tc.crop, 1920, 1080); got != tc.want {
+			t.Errorf("worthCropping() of %s %+v = %v, want %v", tc.name, tc.crop, got, tc.want)
+		}
+	}
+}
+
+func TestAutocropFilter(t *testing.T) {
+	pd := mustParseProbe(t, threeLanguageProbe)
+	autocropSeen["in.mkv"] = ffmpegutil.Crop{Width: 1920, Height: 800, Y: 140}
+	t.Cleanup(func() { forgetAutocrop("in.mkv") })
+	setFlag(t, autocrop, true)
+
+	args, decisions, err := createFfmpegCommand(pd, "in.mkv", "out.mkv")
+	if err != nil {
+		t.Fatalf("createFfmpegCommand() error: %v", err)
+	}
+	if !containsSeq(args, "-vf", "crop=1920:800:0:140") {
+		t.Errorf("createFfmpegCommand() with -autocrop = %v, want -vf crop=1920:800:0:140", args)
+	}
+	found := false
+	for _, d := range decisions {
+		found = found || d.Action == "crop"
+	}
+	if !found {
+		t.Errorf("createFfmpegCommand() decisions = %v, want a crop decision", decisions)
+	}
+}
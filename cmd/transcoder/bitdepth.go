@@ -0,0 +1,46 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+)
+
+// -bit-depth settings. 10 bit compresses gradients better even for 8 bit sources, but some older hardware decoders
+// can only play 8 bit AV1.
+const (
+	bitDepthSource = "source"
+	bitDepth8      = "8"
+	bitDepth10     = "10"
+)
+
+// validateBitDepth checks a -bit-depth setting.
+func validateBitDepth(setting string) error {
+	switch setting {
+	case bitDepthSource, bitDepth8, bitDepth10:
+		return nil
+	}
+	return fmt.Errorf("%q must be source, 8 or 10", setting)
+}
+
+// outputBitDepth returns the bit depth a source is encoded at, 8 or 10. sourceDepth is the source's bit depth, 0 if
+// unknown. HDR is always encoded at 10 bit as it would band badly at 8, sources deeper than 10 bit are encoded at
+// 10, the most AV1's main profile carries, and sources of unknown depth at the default of 10.
+func outputBitDepth(setting string, sourceDepth int, hdr bool) int {
+	switch {
+	case hdr:
+		return 10
+	case setting == bitDepth8:
+		return 8
+	case setting == bitDepthSource && sourceDepth == 8:
+		return 8
+	}
+	return 10
+}
+
+// describeBitDepth describes a source bit depth for the log, 0 is unknown.
+func describeBitDepth(depth int) string {
+	if depth <= 0 {
+		return "of unknown depth"
+	}
+	return strconv.Itoa(depth) + " bit"
+}
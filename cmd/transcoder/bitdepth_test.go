@@ -0,0 +1,46 @@
+package main
+
+import "testing"
+
+func TestOutputBitDepth(t *testing.T) {
+	for _, tc := range []struct {
+		setting     string
+		sourceDepth int
+		hdr         bool
+		want        int
+	}{
+		{setting: bitDepth10, sourceDepth: 8, want: 10},
+		{setting: bitDepth8, sourceDepth: 10, want: 8},
+		{setting: bitDepth8, sourceDepth: 10, hdr: true, want: 10},
+		{setting: bitDepthSource, sourceDepth: 8, want: 8},
+		{setting: bitDepthSource, sourceDepth: 10, want: 10},
+		{setting: bitDepthSource, sourceDepth: 12, want: 10},
+		{setting: bitDepthSource, sourceDepth: 0, want: 10},
+	} {
+		if got := outputBitDepth(tc.setting, tc.sourceDepth, tc.hdr); got != tc.want {
+			t.Errorf("outputBitDepth(%q, %d, hdr=%v) = %d, want %d", tc.setting, tc.sourceDepth, tc.hdr, got, tc.want)
+		}
+	}
+	if err := validateBitDepth("12"); err == nil {
+		t.Errorf("validateBitDepth(\"12\") succeeded, want an error")
+	}
+}
+
+func TestBitDepthFlag(t *testing.T) {
+	pd := mustParseProbe(t, threeLanguageProbe)
+	setFlag(t, bitDepth, bitDepth8)
+	for encoderName, want := range map[string][]string{
+		encoderSVTAV1: {"-pix_fmt", "yuv420p"},
+		encoderNVENC:  {"-pix_fmt", "nv12"},
+		encoderVAAPI:  {"-vf", "format=nv12,hwupload"},
+	} {
+		setFlag(t, encoder, encoderName)
+		args, _, err := createFfmpegCommand(pd, "in.mkv", "out.mkv")
+		if err != nil {
+			t.Fatalf("createFfmpegCommand() error: %v", err)
+		}
+		if !containsSeq(args, want...) {
+			t.Errorf("createFfmpegCommand() with -encoder %s -bit-depth 8 = %v, want %v", encoderName, args, want)
+		}
+	}
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+
+	"github.com/garethgeorge/media-toolkit/internal/fsutil"
+)
+
+// checkpoint records the queue position of a run so that -resume can skip ahead after a crash without consulting
+// the encode log.
+type checkpoint struct {
+	Input string `json:"input"` // input directory or glob the run was started with
+	Index int    `json:"index"` // index in the match list of the last completed file
+	Path  string `json:"path"`  // path of the last completed file
+}
+
+// checkpointPath returns the checkpoint file for a run, it lives next to the encode log.
+func checkpointPath(logFile string) string {
+	return filepath.Join(filepath.Dir(logFile), "checkpoint.json")
+}
+
+// writeCheckpoint replaces the checkpoint file atomically so a crash never leaves a partial checkpoint behind.
+func writeCheckpoint(filename string, cp checkpoint) error {
+	data, err := json.Marshal(cp)
+	if err != nil {
+		return err
+	}
+	return fsutil.WriteFileAtomic(filename, data, 0644)
+}
+
+// readCheckpoint reads the checkpoint file, returning ok false if there is none.
+func readCheckpoint(filename string) (cp checkpoint, ok bool, err error) {
+	data, err := os.ReadFile(filename)
+	if errors.Is(err, os.ErrNotExist) {
+		return checkpoint{}, false, nil
+	} else if err != nil {
+		return checkpoint{}, false, err
+	}
+	if err := json.Unmarshal(data, &cp); err != nil {
+		return checkpoint{}, false, err
+	}
+	return cp, true, nil
+}
+
+// resumeIndex returns the index in matches to resume from given a checkpoint. The checkpointed path is looked up
+// first so that files added or removed since the checkpoint don't shift the position, falling back to the index.
+func resumeIndex(cp checkpoint, input string, matches []string) int {
+	if cp.Input != input {
+		return 0
+	}
+	for idx, match := range matches {
+		if match == cp.Path {
+			return idx + 1
+		}
+	}
+	return min(cp.Index+1, len(matches))
+}
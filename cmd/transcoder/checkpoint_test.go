@@ -0,0 +1,39 @@
+package main
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func TestCheckpointResume(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "checkpoint.json")
+	if _, ok, err := readCheckpoint(filename); ok || err != nil {
+		t.Fatalf("readCheckpoint() of missing file = ok %v, err %v, want no checkpoint", ok, err)
+	}
+
+	matches := []string{"/media/a.mkv", "/media/b.mkv", "/media/c.mkv"}
+	if err := writeCheckpoint(filename, checkpoint{Input: "/media", Index: 0, Path: "/media/a.mkv"}); err != nil {
+		t.Fatalf("writeCheckpoint() error: %v", err)
+	}
+	cp, ok, err := readCheckpoint(filename)
+	if !ok || err != nil {
+		t.Fatalf("readCheckpoint() = ok %v, err %v", ok, err)
+	}
+
+	tests := []struct {
+		name    string
+		input   string
+		matches []string
+		want    int
+	}{
+		{name: "same listing", input: "/media", matches: matches, want: 1},
+		{name: "file added before checkpoint", input: "/media", matches: append([]string{"/media/0.mkv"}, matches...), want: 2},
+		{name: "checkpointed file removed", input: "/media", matches: matches[1:], want: 1},
+		{name: "different input", input: "/other", matches: matches, want: 0},
+	}
+	for _, tc := range tests {
+		if got := resumeIndex(cp, tc.input, tc.matches); got != tc.want {
+			t.Errorf("%s: resumeIndex() = %d, want %d", tc.name, got, tc.want)
+		}
+	}
+}
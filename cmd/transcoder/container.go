@@ -0,0 +1,94 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// outputContainer describes what an output container can carry besides the AV1 video.
+type outputContainer struct {
+	Ext             string   // file extension including the dot
+	AudioCopyCodecs []string // audio codecs that can be stream copied, nil allows any
+	AudioEncoders   []string // ffmpeg audio encoders whose output the container accepts, nil allows any
+	SubtitleCodec   string   // codec text subtitles are converted to, empty copies them as-is
+	ImageSubtitles  bool     // whether image subtitles such as PGS and VOBSUB can be carried
+}
+
+// outputContainers are the containers selectable with -output-ext, the first is the default.
+var outputContainers = []outputContainer{
+	{Ext: ".mkv", ImageSubtitles: true},
+	{
+		Ext:             ".mp4",
+		AudioCopyCodecs: []string{"aac", "ac3", "eac3", "opus", "flac", "mp3", "alac"},
+		SubtitleCodec:   "mov_text",
+	},
+	{
+		Ext:             ".webm",
+		AudioCopyCodecs: []string{"opus", "vorbis"},
+		AudioEncoders:   []string{"libopus", "libvorbis"},
+		SubtitleCodec:   "webvtt",
+	},
+}
+
+// containerFor returns the container of a file name, defaulting to matroska for unknown extensions.
+func containerFor(filename string) outputContainer {
+	ext := strings.ToLower(filepath.Ext(filename))
+	for _, c := range outputContainers {
+		if c.Ext == ext {
+			return c
+		}
+	}
+	return outputContainers[0]
+}
+
+// outputExtension returns the -output-ext extension normalized to lowercase with a leading dot.
+func outputExtension() string {
+	ext := strings.ToLower(strings.TrimSpace(*outputExt))
+	if !strings.HasPrefix(ext, ".") {
+		ext = "." + ext
+	}
+	return ext
+}
+
+// validateOutputContainer checks that the -output-ext container is supported and can carry the encoded audio.
+func validateOutputContainer(ext, audioEncoder string) error {
+	i := slices.IndexFunc(outputContainers, func(c outputContainer) bool { return c.Ext == ext })
+	if i < 0 {
+		return fmt.Errorf("%q must be .mkv, .mp4 or .webm", ext)
+	}
+	c := outputContainers[i]
+	if c.AudioEncoders != nil && !slices.Contains(c.AudioEncoders, audioEncoder) {
+		return fmt.Errorf("%s outputs can't carry %s audio, use -audio-codec %s", ext, audioEncoder, strings.Join(c.AudioEncoders, " or "))
+	}
+	return nil
+}
+
+// containerWarnings describes how the configured streams are adjusted to fit the container.
+func containerWarnings(c outputContainer) []string {
+	var warnings []string
+	if c.AudioCopyCodecs != nil && *surroundPolicy != surroundStereo {
+		warnings = append(warnings, fmt.Sprintf("surround tracks that %s can't carry, e.g. DTS or TrueHD, are downmixed instead of copied", c.Ext))
+	}
+	if !c.ImageSubtitles && *subtitleMode != subtitleModeNone {
+		warnings = append(warnings, fmt.Sprintf("image subtitles such as PGS are dropped and text subtitles are converted to %s as %s can't carry them", c.SubtitleCodec, c.Ext))
+	}
+	return warnings
+}
+
+// encodedSuffixes returns the suffixes of files written by the encoder. Outputs in the other supported containers
+// are included so that outputs of runs with a different -output-ext are still recognized.
+func encodedSuffixes() []string {
+	exts := []string{outputExtension()}
+	for _, c := range outputContainers {
+		if !slices.Contains(exts, c.Ext) {
+			exts = append(exts, c.Ext)
+		}
+	}
+	var suffixes []string
+	for _, ext := range exts {
+		suffixes = append(suffixes, "svtav1enc"+ext, "svtav1enc"+sampleInfix+ext, "svtav1master"+ext)
+	}
+	return suffixes
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"path/filepath"
+	"strings"
+
+	"github.com/garethgeorge/media-toolkit/internal/fsutil"
+	"go.uber.org/zap"
+)
+
+// sidecarExts returns the extensions of the -copy-sidecars flag, nil if it is off.
+func sidecarExts() []string {
+	var exts []string
+	for _, ext := range strings.Split(*copySidecars, ",") {
+		if ext = strings.TrimSpace(ext); ext != "" {
+			exts = append(exts, ext)
+		}
+	}
+	return exts
+}
+
+// sidecarCopies returns the destinations of the -copy-sidecars files of infile, keyed by the sidecar's path. Each is
+// renamed after outfile keeping its suffix, e.g. movie.en.srt becomes movie-svtav1enc.en.srt. Sidecars of the output
+// itself, named after an output beside the source, and those the -sidecar metadata file would replace are left out.
+func sidecarCopies(infile, outfile string) (map[string]string, error) {
+	exts := sidecarExts()
+	if len(exts) == 0 {
+		return nil, nil
+	}
+	sidecars, err := fsutil.FindSidecars(infile, exts)
+	if err != nil {
+		return nil, err
+	}
+	outStem := strings.TrimSuffix(outfile, filepath.Ext(outfile))
+	beside := besideFilename(infile)
+	besideStem := strings.TrimSuffix(beside, filepath.Ext(beside))
+	copies := make(map[string]string)
+	for _, sidecar := range sidecars {
+		dst := outStem + sidecar.Suffix
+		if strings.HasPrefix(sidecar.Path, outStem) || strings.HasPrefix(sidecar.Path, besideStem) {
+			continue
+		}
+		if *sidecarFormat != "" && dst == sidecarPath(outfile, *sidecarFormat) {
+			zap.S().Infof("Item %q not copying %q, -sidecar writes %q", infile, filepath.Base(sidecar.Path), dst)
+			continue
+		}
+		copies[sidecar.Path] = dst
+	}
+	return copies, nil
+}
+
+// copySidecarFiles copies the -copy-sidecars files of infile next to outfile once it is in place. Failures are
+// logged, the encode itself succeeded.
+func copySidecarFiles(infile, outfile string) {
+	copies, err := sidecarCopies(infile, outfile)
+	if err != nil {
+		zap.S().Warnf("Item %q error listing sidecar files: %v", infile, err)
+		return
+	}
+	for src, dst := range copies {
+		if err := fsutil.CopyFile(src, dst); err != nil {
+			zap.S().Warnf("Item %q error copying sidecar %q: %v", infile, src, err)
+			continue
+		}
+		zap.S().Infof("Item %q copied sidecar %q to %q", infile, filepath.Base(src), dst)
+	}
+}
@@ -0,0 +1,44 @@
+package main
+
+import (
+	"maps"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestSidecarCopies(t *testing.T) {
+	src, out := t.TempDir(), t.TempDir()
+	for _, name := range []string{"movie.mkv", "movie.en.srt", "movie.nfo", "movie-poster.jpg", "movie-svtav1enc.srt"} {
+		if err := os.WriteFile(filepath.Join(src, name), nil, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	setFlag(t, copySidecars, "srt, nfo,jpg")
+	setFlag(t, sidecarFormat, sidecarNFO)
+
+	// the output beside the source, its own sidecar isn't copied onto itself
+	got, err := sidecarCopies(filepath.Join(src, "movie.mkv"), filepath.Join(src, "movie-svtav1enc.mkv"))
+	if err != nil {
+		t.Fatalf("sidecarCopies() error: %v", err)
+	}
+	want := map[string]string{
+		filepath.Join(src, "movie.en.srt"):     filepath.Join(src, "movie-svtav1enc.en.srt"),
+		filepath.Join(src, "movie-poster.jpg"): filepath.Join(src, "movie-svtav1enc-poster.jpg"),
+	}
+	if !maps.Equal(got, want) {
+		t.Errorf("sidecarCopies() beside the source = %v, want %v", got, want)
+	}
+
+	setFlag(t, sidecarFormat, "")
+	outfile := filepath.Join(out, "movie-svtav1enc.mkv")
+	copySidecarFiles(filepath.Join(src, "movie.mkv"), outfile)
+	for _, name := range []string{"movie-svtav1enc.en.srt", "movie-svtav1enc.nfo", "movie-svtav1enc-poster.jpg"} {
+		if _, err := os.Stat(filepath.Join(out, name)); err != nil {
+			t.Errorf("copySidecarFiles() didn't copy %s: %v", name, err)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(out, "movie-svtav1enc-svtav1enc.srt")); err == nil {
+		t.Errorf("copySidecarFiles() copied the sidecar of an output beside the source")
+	}
+}
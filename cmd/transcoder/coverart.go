@@ -0,0 +1,83 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/garethgeorge/media-toolkit/internal/encodelog"
+	"github.com/garethgeorge/media-toolkit/internal/ffmpegutil"
+)
+
+// -cover-art policies for attached pictures e.g. a poster embedded in the source.
+const (
+	coverArtCopy = "copy"
+	coverArtDrop = "drop"
+)
+
+// coverArtContainers are the output containers that can carry attached pictures, WebM only accepts VP8/VP9/AV1 video.
+var coverArtContainers = []string{".mkv", ".mp4", ".mov"}
+
+// validateCoverArt checks a -cover-art policy.
+func validateCoverArt(policy string) error {
+	switch policy {
+	case coverArtCopy, coverArtDrop:
+		return nil
+	}
+	return fmt.Errorf("%q must be copy or drop", policy)
+}
+
+// videoMapArgs returns the -map arguments of the video streams that are encoded and how many there are. Every video
+// stream that isn't an attached picture is encoded e.g. each angle of a multi-angle rip, the primary video stream
+// first so that it is output stream v:0. Sources whose first video stream is the primary one and that have no
+// attached pictures map 0:v as a whole.
+func videoMapArgs(probeData ffmpegutil.ProbeData) ([]string, int) {
+	primary := probeData.PrimaryVideoStreamIndex()
+	videos := []int{primary}
+	idx := 0
+	for _, stream := range probeData.Streams {
+		if !stream.IsVideo() {
+			continue
+		}
+		if idx != primary && !stream.IsAttachedPic() {
+			videos = append(videos, idx)
+		}
+		idx++
+	}
+	if primary <= 0 && len(probeData.CoverArtIndices()) == 0 {
+		return []string{"-map", "0:v"}, len(videos)
+	}
+	var args []string
+	for _, idx := range videos {
+		args = append(args, "-map", fmt.Sprintf("0:v:%d", idx))
+	}
+	return args, len(videos)
+}
+
+// planCoverArt returns the ffmpeg arguments stream copying the source's attached pictures after the encoded video
+// streams, which are the first encodedVideos output video streams. Attached pictures are dropped if the policy or the
+// output container says so.
+func planCoverArt(probeData ffmpegutil.ProbeData, policy, outputFileName string, encodedVideos int) ([]string, []encodelog.StreamDecision) {
+	var args []string
+	var decisions []encodelog.StreamDecision
+
+	containerOK := slices.Contains(coverArtContainers, strings.ToLower(filepath.Ext(outputFileName)))
+	outIdx := encodedVideos
+	for _, idx := range probeData.CoverArtIndices() {
+		specifier := fmt.Sprintf("0:v:%d", idx)
+		switch {
+		case policy == coverArtDrop:
+			decisions = append(decisions, encodelog.StreamDecision{Stream: specifier, Action: "drop", Reason: "cover art, -cover-art drop"})
+		case !containerOK:
+			decisions = append(decisions, encodelog.StreamDecision{Stream: specifier, Action: "drop", Reason: fmt.Sprintf("cover art, %s outputs can't carry it", filepath.Ext(outputFileName))})
+		default:
+			args = append(args, "-map", specifier,
+				fmt.Sprintf("-c:v:%d", outIdx), "copy",
+				fmt.Sprintf("-disposition:v:%d", outIdx), "attached_pic")
+			decisions = append(decisions, encodelog.StreamDecision{Stream: specifier, Action: "copy", Reason: "cover art"})
+			outIdx++
+		}
+	}
+	return args, decisions
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"slices"
+	"testing"
+
+	"github.com/garethgeorge/media-toolkit/internal/encodelog"
+)
+
+const coverArtFirstProbe = `{
+	"format": {"bit_rate": "8000000", "duration": "5400"},
+	"streams": [
+		{"index": 0, "codec_type": "video", "codec_name": "mjpeg", "width": 600, "height": 900, "disposition": {"attached_pic": 1}},
+		{"index": 1, "codec_type": "video", "codec_name": "h264", "width": 1920, "height": 1080, "pix_fmt": "yuv420p"},
+		{"index": 2, "codec_type": "audio", "codec_name": "aac", "channels": 2, "tags": {"language": "eng"}}
+	]
+}`
+
+func TestCoverArt(t *testing.T) {
+	pd := mustParseProbe(t, coverArtFirstProbe)
+	setFlag(t, denoise, "hqdn3d")
+
+	args, _, err := createFfmpegCommand(pd, "in.mkv", "out.mkv")
+	if err != nil {
+		t.Fatalf("createFfmpegCommand() error: %v", err)
+	}
+	for _, seq := range [][]string{
+		{"-map", "0:v:1", "-c:v", "libsvtav1"},
+		{"-filter:v:0", "hqdn3d"},
+		{"-pix_fmt:v:0", "yuv420p10le"},
+		{"-map", "0:v:0", "-c:v:1", "copy", "-disposition:v:1", "attached_pic"},
+	} {
+		if !containsSeq(args, seq...) {
+			t.Errorf("createFfmpegCommand() of a file with cover art first = %v, want %v", args, seq)
+		}
+	}
+	if slices.Contains(args, "-vf") {
+		t.Errorf("createFfmpegCommand() filters every video stream with -vf: %v", args)
+	}
+
+	setFlag(t, coverArt, coverArtDrop)
+	args, decisions, err := createFfmpegCommand(pd, "in.mkv", "out.webm")
+	if err != nil {
+		t.Fatalf("createFfmpegCommand() error: %v", err)
+	}
+	if containsSeq(args, "-map", "0:v:0") || !containsSeq(args, "-vf", "hqdn3d") {
+		t.Errorf("createFfmpegCommand() with -cover-art drop = %v, want only 0:v:1 mapped and filtered with -vf", args)
+	}
+	if !slices.ContainsFunc(decisions, func(d encodelog.StreamDecision) bool { return d.Stream == "0:v:0" && d.Action == "drop" }) {
+		t.Errorf("createFfmpegCommand() decisions = %v, want the cover art dropped", decisions)
+	}
+}
+
+func TestPrimaryVideoStreamMapped(t *testing.T) {
+	pd := mustParseProbe(t, `{
+		"format": {"bit_rate": "20000000", "duration": "5400"},
+		"streams": [
+			{"index": 0, "codec_type": "video", "codec_name": "h264", "width": 720, "height": 480},
+			{"index": 1, "codec_type": "video", "codec_name": "h264", "width": 1920, "height": 1080},
+			{"index": 2, "codec_type": "audio", "codec_name": "aac", "channels": 2, "tags": {"language": "eng"}}
+		]
+	}`)
+	args, decisions, err := createFfmpegCommand(pd, "in.mkv", "out.mkv")
+	if err != nil {
+		t.Fatalf("createFfmpegCommand() error: %v", err)
+	}
+	if !containsSeq(args, "-map", "0:v:1", "-map", "0:v:0") {
+		t.Errorf("createFfmpegCommand() = %v, want the 1080p stream 0:v:1 mapped first and the 480p stream kept", args)
+	}
+	if slices.ContainsFunc(decisions, func(d encodelog.StreamDecision) bool { return d.Action == "drop" }) {
+		t.Errorf("createFfmpegCommand() decisions = %v, want no video stream dropped", decisions)
+	}
+
+	// with cover art every encoded stream is filtered and the cover art follows them
+	pd = mustParseProbe(t, `{
+		"format": {"bit_rate": "20000000", "duration": "5400"},
+		"streams": [
+			{"index": 0, "codec_type": "video", "codec_name": "h264", "width": 720, "height": 480},
+			{"index": 1, "codec_type": "video", "codec_name": "h264", "width": 1920, "height": 1080},
+			{"index": 2, "codec_type": "video", "codec_name": "mjpeg", "width": 600, "height": 900, "disposition": {"attached_pic": 1}}
+		]
+	}`)
+	setFlag(t, denoise, "hqdn3d")
+	args, _, err = createFfmpegCommand(pd, "in.mkv", "out.mkv")
+	if err != nil {
+		t.Fatalf("createFfmpegCommand() error: %v", err)
+	}
+	for _, seq := range [][]string{
+		{"-map", "0:v:1", "-map", "0:v:0"},
+		{"-filter:v:0", "hqdn3d"},
+		{"-filter:v:1", "hqdn3d"},
+		{"-map", "0:v:2", "-c:v:2", "copy", "-disposition:v:2", "attached_pic"},
+	} {
+		if !containsSeq(args, seq...) {
+			t.Errorf("createFfmpegCommand() of two angles and cover art = %v, want %v", args, seq)
+		}
+	}
+}
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/garethgeorge/media-toolkit/internal/encodelog"
+	"github.com/garethgeorge/media-toolkit/internal/ffmpegutil"
+)
+
+// dataStreamContainers are the output containers that can carry data streams, Matroska only accepts audio, video
+// and subtitle streams.
+var dataStreamContainers = []string{".mp4", ".mov"}
+
+// planDataStreams returns the ffmpeg arguments copying the source's data streams e.g. GPS and gyro telemetry from
+// action cameras. Data streams are dropped unless copyData is set and the output container supports them.
+func planDataStreams(probeData ffmpegutil.ProbeData, copyData bool, outputFileName string) ([]string, []encodelog.StreamDecision) {
+	var args []string
+	var decisions []encodelog.StreamDecision
+
+	containerOK := slices.Contains(dataStreamContainers, strings.ToLower(filepath.Ext(outputFileName)))
+	for idx, stream := range probeData.Streams {
+		if !stream.IsData() {
+			continue
+		}
+		specifier := fmt.Sprintf("0:d:%d", probeData.MapStreamIdx("data", idx))
+		desc := stream.CodecName
+		if desc == "" {
+			desc = "data"
+		}
+
+		switch {
+		case !copyData:
+			decisions = append(decisions, encodelog.StreamDecision{Stream: specifier, Action: "drop", Reason: desc + " data stream, -copy-data-streams not set"})
+		case !containerOK:
+			decisions = append(decisions, encodelog.StreamDecision{Stream: specifier, Action: "drop", Reason: fmt.Sprintf("%s data stream, %s outputs can't carry data streams", desc, filepath.Ext(outputFileName))})
+		default:
+			args = append(args, "-map", specifier)
+			decisions = append(decisions, encodelog.StreamDecision{Stream: specifier, Action: "copy", Reason: desc + " data stream"})
+		}
+	}
+
+	if len(args) > 0 {
+		args = append(args, "-c:d", "copy")
+	}
+	return args, decisions
+}
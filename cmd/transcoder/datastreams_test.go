@@ -0,0 +1,52 @@
+package main
+
+import (
+	"slices"
+	"testing"
+)
+
+const actionCamProbe = `{
+	"format": {"bit_rate": "60000000"},
+	"streams": [
+		{"codec_type": "video", "codec_name": "hevc", "width": 3840, "height": 2160},
+		{"codec_type": "audio", "codec_name": "aac", "channels": 2},
+		{"codec_type": "data", "codec_tag_string": "tmcd"},
+		{"codec_type": "data", "codec_name": "bin_data", "codec_tag_string": "gpmd"}
+	]
+}`
+
+func TestPlanDataStreams(t *testing.T) {
+	pd := mustParseProbe(t, actionCamProbe)
+
+	tests := []struct {
+		name     string
+		copyData bool
+		outfile  string
+		wantArgs []string
+		wantCopy int
+	}{
+		{name: "dropped by default", copyData: false, outfile: "/media/GX010001-svtav1enc.mp4"},
+		{name: "copied into mp4", copyData: true, outfile: "/media/GX010001-svtav1enc.mp4", wantArgs: []string{"-map", "0:d:0", "-map", "0:d:1", "-c:d", "copy"}, wantCopy: 2},
+		{name: "mkv can't carry data", copyData: true, outfile: "/media/GX010001-svtav1enc.mkv"},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			args, decisions := planDataStreams(pd, tc.copyData, tc.outfile)
+			if !slices.Equal(args, tc.wantArgs) {
+				t.Errorf("planDataStreams() args = %v, want %v", args, tc.wantArgs)
+			}
+			if len(decisions) != 2 {
+				t.Fatalf("planDataStreams() returned %d decisions, want 2: %v", len(decisions), decisions)
+			}
+			copies := 0
+			for _, d := range decisions {
+				if d.Action == "copy" {
+					copies++
+				}
+			}
+			if copies != tc.wantCopy {
+				t.Errorf("planDataStreams() copied %d streams, want %d: %v", copies, tc.wantCopy, decisions)
+			}
+		})
+	}
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// resolveDockerUser resolves a -docker-user spec to a numeric uid and gid. The spec "self" resolves to the
+// invoking user, looking through sudo via SUDO_UID/SUDO_GID so that outputs are not owned by root.
+func resolveDockerUser(spec string) (int, int, error) {
+	if spec == "self" {
+		sudoUID, sudoGID := os.Getenv("SUDO_UID"), os.Getenv("SUDO_GID")
+		if sudoUID != "" && sudoGID != "" {
+			spec = sudoUID + ":" + sudoGID
+		} else {
+			return os.Getuid(), os.Getgid(), nil
+		}
+	}
+
+	uidStr, gidStr, ok := strings.Cut(spec, ":")
+	if !ok {
+		return 0, 0, fmt.Errorf("docker user %q must be \"self\" or uid:gid", spec)
+	}
+	uid, err := strconv.Atoi(uidStr)
+	if err != nil {
+		return 0, 0, fmt.Errorf("docker user %q has invalid uid: %w", spec, err)
+	}
+	gid, err := strconv.Atoi(gidStr)
+	if err != nil {
+		return 0, 0, fmt.Errorf("docker user %q has invalid gid: %w", spec, err)
+	}
+	return uid, gid, nil
+}
+
+// dockerAccessArgs returns the docker run arguments granting the container access to the host. Software encodes
+// need none, --privileged is only passed when asked for and hardware acceleration should map just the devices it
+// needs e.g. /dev/dri for VAAPI.
+func dockerAccessArgs(privileged bool, devices string) []string {
+	var args []string
+	if privileged {
+		args = append(args, "--privileged")
+	}
+	for _, device := range strings.Split(devices, ",") {
+		if device = strings.TrimSpace(device); device != "" {
+			args = append(args, "--device", device)
+		}
+	}
+	return args
+}
+
+// dockerMount is a host file or directory mounted into the -docker-image container.
+type dockerMount struct {
+	Host, Container string
+	Writable        bool // the container writes to it, so the -docker-user must own it
+}
+
+// dockerRunArgs returns the docker run arguments up to and including -docker-image, mounting mounts and applying
+// the -docker-* flags. Writable mounts are chowned to -docker-user unless this is a dry run.
+func dockerRunArgs(mounts []dockerMount) ([]string, error) {
+	var uid, gid int
+	if *dockerUser != "" {
+		var err error
+		uid, gid, err = resolveDockerUser(*dockerUser)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	args := []string{"docker", "run", "--rm"}
+	for _, mount := range mounts {
+		if mount.Writable && *dockerUser != "" && !*dryRun {
+			if err := os.Chown(mount.Host, uid, gid); err != nil {
+				return nil, fmt.Errorf("failed to chown %q for docker user: %w", mount.Host, err)
+			}
+		}
+		args = append(args, "-v", mount.Host+":"+mount.Container)
+	}
+	args = append(args, dockerAccessArgs(*dockerPrivileged, *dockerDevices)...)
+	args = append(args, dockerEnvArgs(*encodeEnv)...)
+	if *dockerCpus != "" {
+		args = append(args, "--cpuset-cpus", *dockerCpus)
+	}
+	if *dockerUser != "" {
+		args = append(args, "--user", fmt.Sprintf("%d:%d", uid, gid))
+	}
+	return append(args, *dockerImage), nil
+}
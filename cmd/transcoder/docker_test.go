@@ -0,0 +1,83 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+func TestResolveDockerUser(t *testing.T) {
+	t.Setenv("SUDO_UID", "1000")
+	t.Setenv("SUDO_GID", "100")
+
+	tests := []struct {
+		spec     string
+		uid, gid int
+		wantErr  bool
+	}{
+		{spec: "self", uid: 1000, gid: 100},
+		{spec: "1234:5678", uid: 1234, gid: 5678},
+		{spec: "1234", wantErr: true},
+		{spec: "media:media", wantErr: true},
+	}
+	for _, tc := range tests {
+		uid, gid, err := resolveDockerUser(tc.spec)
+		if (err != nil) != tc.wantErr {
+			t.Errorf("resolveDockerUser(%q) error = %v, wantErr %v", tc.spec, err, tc.wantErr)
+			continue
+		}
+		if uid != tc.uid || gid != tc.gid {
+			t.Errorf("resolveDockerUser(%q) = %d:%d, want %d:%d", tc.spec, uid, gid, tc.uid, tc.gid)
+		}
+	}
+}
+
+func TestDockerArgsIncludeUser(t *testing.T) {
+	setFlag(t, dockerImage, "ffmpeg")
+	setFlag(t, dockerUser, fmt.Sprintf("%d:%d", os.Getuid(), os.Getgid()))
+
+	dir := t.TempDir()
+	pd := mustParseProbe(t, threeLanguageProbe)
+	args, _, err := createFfmpegCommand(pd, filepath.Join(dir, "in.mkv"), filepath.Join(dir, "out.mkv"))
+	if err != nil {
+		t.Fatalf("createFfmpegCommand() error: %v", err)
+	}
+
+	idx := slices.Index(args, "--user")
+	if idx == -1 || idx+1 >= len(args) {
+		t.Fatalf("createFfmpegCommand() args missing --user: %v", args)
+	}
+	if want := fmt.Sprintf("%d:%d", os.Getuid(), os.Getgid()); args[idx+1] != want {
+		t.Errorf("--user = %q, want %q", args[idx+1], want)
+	}
+	if imageIdx := slices.Index(args, "ffmpeg"); imageIdx < idx {
+		t.Errorf("--user must come before the image name: %v", args)
+	}
+}
+
+func TestDockerAccessArgs(t *testing.T) {
+	tests := []struct {
+		privileged bool
+		devices    string
+		want       []string
+	}{
+		{want: nil},
+		{privileged: true, want: []string{"--privileged"}},
+		{devices: "/dev/dri, /dev/nvidia0", want: []string{"--device", "/dev/dri", "--device", "/dev/nvidia0"}},
+	}
+	for _, tc := range tests {
+		if got := dockerAccessArgs(tc.privileged, tc.devices); !slices.Equal(got, tc.want) {
+			t.Errorf("dockerAccessArgs(%v, %q) = %v, want %v", tc.privileged, tc.devices, got, tc.want)
+		}
+	}
+}
+
+// setFlag overrides a flag value for the duration of a test.
+func setFlag[T any](t *testing.T, flag *T, value T) {
+	t.Helper()
+	old := *flag
+	*flag = value
+	t.Cleanup(func() { *flag = old })
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"strings"
+
+	"github.com/garethgeorge/media-toolkit/internal/ffmpegutil"
+	"go.uber.org/zap"
+)
+
+// dryRunMatch logs what transcodeMatch would do for infile without locking, encoding or writing anything. The
+// existing output and temp file are checked the same way so that the preview matches a real run.
+func dryRunMatch(probeData ffmpegutil.ProbeData, infile, outfile string, replacePreview bool) {
+	defer forgetAutocrop(infile)
+	tmpfile := tempFilename(outfile)
+	plan := planOverwriteFor(outfile, tmpfile, replacePreview)
+	if plan.Skip != "" {
+		zap.S().Infof("Item %q dry run, would skip: %s\n", infile, plan.Skip)
+		return
+	}
+	if plan.VerifyFinal {
+		zap.S().Infof("Item %q dry run, would verify the existing output %q and only encode if it fails\n", infile, outfile)
+	}
+	if plan.RemoveTemp {
+		zap.S().Infof("Item %q dry run, would remove the stale temp file %q unless it is still being written\n", infile, tmpfile)
+	}
+
+	var pass encodePass
+	if twoPassEnabled() {
+		// the real stats directory is a fresh temp directory per encode, * stands in for its random part
+		pass = encodePass{Pass: 2, StatsDir: statsDirPattern(tmpfile)}
+		args, _, err := createFfmpegPassCommand(probeData, infile, tmpfile, encodePass{Pass: 1, StatsDir: pass.StatsDir})
+		if err != nil {
+			zap.S().Errorf("Item %q error forming analysis pass command: %v\n", infile, err)
+			return
+		}
+		zap.S().Infof("Item %q dry run, would run the analysis pass: %s\n", infile, strings.Join(args, " "))
+	}
+	args, decisions, err := createFfmpegPassCommand(probeData, infile, tmpfile, pass)
+	if err != nil {
+		zap.S().Errorf("Item %q error forming ffmpeg command: %v\n", infile, err)
+		return
+	}
+	for _, decision := range decisions {
+		zap.S().Infof("Item %q stream %s\n", infile, decision)
+	}
+	zap.S().Infof("Item %q dry run, would run: %s\n", infile, strings.Join(args, " "))
+	zap.S().Infof("Item %q dry run, would rename %q to %q\n", infile, tmpfile, outfile)
+	if copies, err := sidecarCopies(infile, outfile); err != nil {
+		zap.S().Warnf("Item %q error listing sidecar files: %v", infile, err)
+	} else {
+		for src, dst := range copies {
+			zap.S().Infof("Item %q dry run, would copy sidecar %q to %q\n", infile, src, dst)
+		}
+	}
+	summary.Encoded(0, 0)
+}
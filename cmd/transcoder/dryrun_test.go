@@ -0,0 +1,37 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/garethgeorge/media-toolkit/internal/ffmpegutil"
+)
+
+func TestDryRunWritesNothing(t *testing.T) {
+	setFlag(t, dryRun, true)
+	setFlag(t, dockerImage, "ffmpeg")
+	dir := t.TempDir()
+	logFile := filepath.Join(dir, "transcode.log")
+	outfile := filepath.Join(dir, "out", "movie-svtav1enc.mkv")
+
+	recordSkip(logFile, "movie.mkv", outfile, "already AV1", false)
+	recordProbeFailure(logFile, "movie.mkv", outfile, nil, fmt.Errorf("%w: exit status 1", ffmpegutil.ErrProbeRejected))
+	if _, err := os.Stat(logFile); !os.IsNotExist(err) {
+		t.Errorf("dry run wrote the log, stat error: %v", err)
+	}
+
+	pd := mustParseProbe(t, threeLanguageProbe)
+	dryRunMatch(pd, filepath.Join(dir, "movie.mkv"), outfile, false)
+	args, _, err := createFfmpegCommand(pd, filepath.Join(dir, "movie.mkv"), outfile)
+	if err != nil {
+		t.Fatalf("createFfmpegCommand() error: %v", err)
+	}
+	if !containsSeq(args, "-y", "/output.mkv") {
+		t.Errorf("createFfmpegCommand() in docker mode = %v, want the container output path", args)
+	}
+	if _, err := os.Stat(filepath.Dir(outfile)); !os.IsNotExist(err) {
+		t.Errorf("dry run created the output directory, stat error: %v", err)
+	}
+}
@@ -0,0 +1,186 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+)
+
+// Video encoders for -encoder. svtav1 encodes in software, the others use the AV1 encoder of a GPU through NVENC
+// (Nvidia), Quick Sync (Intel) or VAAPI (Intel and AMD on Linux).
+const (
+	encoderSVTAV1 = "svtav1"
+	encoderNVENC  = "av1_nvenc"
+	encoderQSV    = "av1_qsv"
+	encoderVAAPI  = "av1_vaapi"
+)
+
+func validateEncoder(encoder string) error {
+	switch encoder {
+	case encoderSVTAV1, encoderNVENC, encoderQSV, encoderVAAPI:
+		return nil
+	}
+	return fmt.Errorf("%q must be svtav1, av1_nvenc, av1_qsv or av1_vaapi", encoder)
+}
+
+// videoSettings are the encoder independent inputs of the video encoding arguments.
+type videoSettings struct {
+	Preset   int        // SVT-AV1 preset 0-13, hardware encoders map it onto their own speed scale
+	CRF      int        // SVT-AV1 CRF 0-63, hardware encoders map it onto their own quality scale
+	Pass     encodePass // pass of a -two-pass encode, only supported by svtav1
+	StatsDir string     // Pass.StatsDir as ffmpeg sees it
+
+	HDR         bool // the output is HDR
+	DolbyVision bool // carry the source's Dolby Vision metadata, only supported by svtav1
+}
+
+// videoEncoderArgs returns the -c:v argument and codec parameters of an encoder.
+func videoEncoderArgs(encoder string, settings videoSettings) ([]string, error) {
+	switch encoder {
+	case encoderNVENC:
+		return nvencArgs(settings), nil
+	case encoderQSV:
+		return qsvArgs(settings), nil
+	case encoderVAAPI:
+		return vaapiArgs(settings), nil
+	}
+	return svtav1Args(settings)
+}
+
+// Documentation on SVTAV1 params https://gitlab.com/AOMediaCodec/SVT-AV1/-/blob/master/Docs/Ffmpeg.md#example-2-encoding-for-personal-use
+func svtav1Args(settings videoSettings) ([]string, error) {
+	args := []string{"-c:v", "libsvtav1", "-crf", strconv.Itoa(settings.CRF), "-preset", strconv.Itoa(settings.Preset)}
+
+	var params svtav1Params
+	params.Set("tune", strconv.Itoa(*tune))
+	if settings.Preset <= 6 {
+		params.Set("film-grain", "8") // detect and add / film grain.
+	} else {
+		params.Set("film-grain", "0") // do nothing with film grain.
+	}
+	// shorter keyframe intervals seek faster e.g. for streaming, longer intervals compress better e.g. for archival
+	if *keyint != "" {
+		params.Set("keyint", *keyint)
+	}
+	if videoThreadCount > 0 {
+		params.Set("lp", strconv.Itoa(videoThreadCount))
+	}
+	if settings.HDR {
+		params.Set("enable-hdr", "1") // write the mastering display and content light level metadata
+	}
+	keyframeArgs, err := forceKeyframesArgs(*forceKeyframes, &params)
+	if err != nil {
+		return nil, err
+	}
+	args = append(args, "-svtav1-params", params.String())
+	if settings.DolbyVision {
+		args = append(args, "-dolbyvision", "1")
+	}
+	args = append(args, keyframeArgs...)
+	return append(args, settings.Pass.passArgs(settings.StatsDir)...), nil
+}
+
+// NVENC's constant quality mode takes -cq 1-51 and presets p1 (fastest) to p7 (slowest).
+func nvencArgs(settings videoSettings) []string {
+	preset := 7 - settings.Preset*6/13
+	return append([]string{
+		"-c:v", "av1_nvenc", "-rc", "vbr", "-cq", strconv.Itoa(hardwareQuality(settings.CRF, 51)), "-preset", fmt.Sprintf("p%d", preset),
+	}, hardwareKeyframeArgs()...)
+}
+
+// Quick Sync's intelligent constant quality mode takes -global_quality 1-51 and x264 style preset names.
+func qsvArgs(settings videoSettings) []string {
+	presets := []string{"veryslow", "slower", "slow", "medium", "fast", "faster", "veryfast"}
+	preset := presets[min(settings.Preset*len(presets)/14, len(presets)-1)]
+	return append([]string{
+		"-c:v", "av1_qsv", "-global_quality", strconv.Itoa(hardwareQuality(settings.CRF, 51)), "-preset", preset,
+	}, hardwareKeyframeArgs()...)
+}
+
+// VAAPI has no preset and its constant quantizer mode takes the AV1 quantizer index 0-255, which SVT-AV1's CRF
+// roughly maps onto at 4 index steps per CRF step.
+func vaapiArgs(settings videoSettings) []string {
+	return append([]string{
+		"-c:v", "av1_vaapi", "-rc_mode", "CQP", "-qp", strconv.Itoa(min(settings.CRF*4, 255)),
+	}, hardwareKeyframeArgs()...)
+}
+
+// hardwareQuality maps a CRF 0-63 onto a 1-scale quality level.
+func hardwareQuality(crf, scale int) int {
+	return max(1, (crf*scale+31)/63)
+}
+
+// hardwareKeyframeArgs returns the -force-keyframes arguments hardware encoders support, only the interval form
+// works as scene cut detection is an SVT-AV1 parameter.
+func hardwareKeyframeArgs() []string {
+	args, _ := forceKeyframesArgs(*forceKeyframes, &svtav1Params{}) // validated at startup
+	return args
+}
+
+// encoderInputArgs returns the options placed before -i that initialize the hardware device. Decoding uses the
+// device where one is needed but frames are filtered in system memory so that every filter keeps working.
+func encoderInputArgs(encoder string) []string {
+	switch encoder {
+	case encoderNVENC:
+		return []string{"-hwaccel", "cuda"}
+	case encoderQSV:
+		return []string{"-hwaccel", "qsv"}
+	case encoderVAAPI:
+		return []string{"-vaapi_device", *vaapiDevice}
+	}
+	return nil
+}
+
+// encoderPixelFormat returns the 8 or 10 bit pixel format an encoder takes from system memory, empty if frames must
+// be uploaded to the device instead, see encoderUploadFilter.
+func encoderPixelFormat(encoder string, depth int) string {
+	switch encoder {
+	case encoderNVENC, encoderQSV:
+		if depth == 8 {
+			return "nv12"
+		}
+		return "p010le"
+	case encoderVAAPI:
+		return ""
+	}
+	if depth == 8 {
+		return "yuv420p"
+	}
+	return "yuv420p10le"
+}
+
+// encoderUploadFilter returns the filter moving frames of the given bit depth from system memory onto the
+// encoder's device, if needed.
+func encoderUploadFilter(encoder string, depth int) string {
+	if encoder == encoderVAAPI {
+		if depth == 8 {
+			return "format=nv12,hwupload"
+		}
+		return "format=p010,hwupload"
+	}
+	return ""
+}
+
+// encoderFlagWarnings lists the flags that are set but ignored by a hardware encoder. They are only warned about so
+// that the same command line can be used with every encoder.
+func encoderFlagWarnings(encoder string) []string {
+	if encoder == encoderSVTAV1 {
+		return nil
+	}
+	var warnings []string
+	if *tune != tuneVQ {
+		warnings = append(warnings, "-tune is an SVT-AV1 parameter and is ignored")
+	}
+	if *keyint != "" {
+		warnings = append(warnings, "-keyint is an SVT-AV1 parameter and is ignored, use -force-keyframes with an interval instead")
+	}
+	if *forceKeyframes == forceKeyframesSceneCut {
+		warnings = append(warnings, "-force-keyframes scenecut is an SVT-AV1 parameter and is ignored")
+	}
+	if *videoThreads != "" {
+		warnings = append(warnings, "-video-threads is an SVT-AV1 parameter and is ignored")
+	}
+	if *twoPass {
+		warnings = append(warnings, "-two-pass is only supported by svtav1 and is ignored")
+	}
+	return warnings
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestHardwareEncoderCommands(t *testing.T) {
+	pd := mustParseProbe(t, threeLanguageProbe)
+	setFlag(t, crf, 24)
+	setFlag(t, preset, 6)
+
+	tests := []struct {
+		encoder string
+		want    [][]string
+		absent  []string
+	}{
+		{
+			encoder: encoderSVTAV1,
+			want:    [][]string{{"-c:v", "libsvtav1", "-crf", "24", "-preset", "6"}, {"-pix_fmt", "yuv420p10le"}},
+		},
+		{
+			encoder: encoderNVENC,
+			want:    [][]string{{"-hwaccel", "cuda"}, {"-c:v", "av1_nvenc", "-rc", "vbr", "-cq", "19", "-preset", "p5"}, {"-pix_fmt", "p010le"}},
+			absent:  []string{"-crf", "-svtav1-params"},
+		},
+		{
+			encoder: encoderQSV,
+			want:    [][]string{{"-hwaccel", "qsv"}, {"-c:v", "av1_qsv", "-global_quality", "19", "-preset", "medium"}},
+			absent:  []string{"-crf", "-svtav1-params"},
+		},
+		{
+			encoder: encoderVAAPI,
+			want:    [][]string{{"-vaapi_device", "/dev/dri/renderD128"}, {"-vf", "format=p010,hwupload"}, {"-c:v", "av1_vaapi", "-rc_mode", "CQP", "-qp", "96"}},
+			absent:  []string{"-crf", "-svtav1-params", "-pix_fmt"},
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.encoder, func(t *testing.T) {
+			setFlag(t, encoder, tc.encoder)
+			args, _, err := createFfmpegCommand(pd, "in.mkv", "out.mkv")
+			if err != nil {
+				t.Fatalf("createFfmpegCommand() error: %v", err)
+			}
+			for _, seq := range tc.want {
+				if !containsSeq(args, seq...) {
+					t.Errorf("createFfmpegCommand() missing %v: %v", seq, args)
+				}
+			}
+			for _, arg := range tc.absent {
+				if slices.Contains(args, arg) {
+					t.Errorf("createFfmpegCommand() has %s: %v", arg, args)
+				}
+			}
+		})
+	}
+
+	if err := validateEncoder("libaom"); err == nil {
+		t.Errorf("validateEncoder(\"libaom\") succeeded, want an error")
+	}
+}
+
+func TestEncoderFlagWarnings(t *testing.T) {
+	setFlag(t, tune, tunePSNR)
+	setFlag(t, twoPass, true)
+	if warnings := encoderFlagWarnings(encoderSVTAV1); len(warnings) != 0 {
+		t.Errorf("encoderFlagWarnings(svtav1) = %v, want none", warnings)
+	}
+	if warnings := encoderFlagWarnings(encoderNVENC); len(warnings) != 2 {
+		t.Errorf("encoderFlagWarnings(av1_nvenc) = %v, want -tune and -two-pass", warnings)
+	}
+
+	setFlag(t, encoder, encoderNVENC)
+	if twoPassEnabled() {
+		t.Errorf("twoPassEnabled() with av1_nvenc = true, want false")
+	}
+}
@@ -0,0 +1,43 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"strings"
+)
+
+// envFlag collects repeated KEY=VALUE flags.
+type envFlag []string
+
+func (e *envFlag) String() string {
+	if e == nil {
+		return ""
+	}
+	return strings.Join(*e, " ")
+}
+
+func (e *envFlag) Set(value string) error {
+	key, _, ok := strings.Cut(value, "=")
+	if !ok || key == "" || strings.ContainsAny(key, " \t") {
+		return fmt.Errorf("%q must be KEY=VALUE", value)
+	}
+	*e = append(*e, value)
+	return nil
+}
+
+// envVar defines a repeatable KEY=VALUE flag.
+func envVar(name, usage string) *envFlag {
+	e := &envFlag{}
+	flag.Var(e, name, usage)
+	return e
+}
+
+// dockerEnvArgs passes environment variables into the container, setting them on the docker command itself
+// would only affect the docker client.
+func dockerEnvArgs(env []string) []string {
+	var args []string
+	for _, kv := range env {
+		args = append(args, "-e", kv)
+	}
+	return args
+}
@@ -0,0 +1,25 @@
+package main
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestEnvFlag(t *testing.T) {
+	var env envFlag
+	for _, valid := range []string{"SVT_LOG=1", "OMP_NUM_THREADS=4", "EMPTY="} {
+		if err := env.Set(valid); err != nil {
+			t.Errorf("Set(%q) error: %v", valid, err)
+		}
+	}
+	for _, invalid := range []string{"SVT_LOG", "=1", "BAD KEY=1"} {
+		if err := env.Set(invalid); err == nil {
+			t.Errorf("Set(%q) expected an error", invalid)
+		}
+	}
+
+	want := []string{"-e", "SVT_LOG=1", "-e", "OMP_NUM_THREADS=4", "-e", "EMPTY="}
+	if got := dockerEnvArgs(env); !slices.Equal(got, want) {
+		t.Errorf("dockerEnvArgs() = %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,168 @@
+package main
+
+import (
+	"cmp"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"time"
+
+	"github.com/garethgeorge/media-toolkit/internal/encodelog"
+	"github.com/garethgeorge/media-toolkit/internal/ffmpegutil"
+	"github.com/garethgeorge/media-toolkit/internal/fsutil"
+	"go.uber.org/zap"
+)
+
+const (
+	encodedAudioBitrate = 192000 // assumed bitrate of encoded audio tracks if -audio-bitrate is empty
+	copiedAudioBitrate  = 640000 // assumed bitrate of copied surround tracks, typical of AC3 5.1
+)
+
+// fileEstimate is the projected outcome of encoding a single file.
+type fileEstimate struct {
+	InputBytes  int64
+	OutputBytes int64
+	EncodeTime  time.Duration
+}
+
+// estimateFile projects the output size and encode time of a file. The output size assumes the encode lands
+// near the resolution scaled minimum bitrate, encodeSpeed is the assumed encode speed as a multiple of realtime.
+func estimateFile(probeData ffmpegutil.ProbeData, inputBytes int64, encodeSpeed float64) fileEstimate {
+	duration := probeData.GetDurationSeconds()
+	videoStream := probeData.GetPrimaryVideoStream()
+
+	displayWidth, displayHeight := videoStream.DisplayDimensions()
+	bitrate := scaleBitrateToResolution(bitrateTarget, displayWidth, displayHeight)
+	encodedBitrate, err := parseBitrate(*audioBitrate)
+	if err != nil {
+		encodedBitrate = encodedAudioBitrate
+	}
+	audioPlan, _ := planAudioTracks(probeData, audioOptionsFromFlags())
+	for _, track := range audioPlan {
+		if track.Copy {
+			bitrate += copiedAudioBitrate
+		} else {
+			bitrate += encodedBitrate
+		}
+	}
+
+	est := fileEstimate{
+		InputBytes:  inputBytes,
+		OutputBytes: int64(float64(bitrate) * duration / 8),
+	}
+	if est.OutputBytes > inputBytes {
+		est.OutputBytes = inputBytes
+	}
+	if encodeSpeed > 0 {
+		est.EncodeTime = time.Duration(duration / encodeSpeed * float64(time.Second))
+	}
+	return est
+}
+
+// candidateEstimate is the estimate for a single file that would be encoded.
+type candidateEstimate struct {
+	fileEstimate
+	Path       string
+	BitrateBPS int
+}
+
+// estimateCandidates probes every file that hasn't been dealt with according to the log and estimates those
+// that would be encoded, without encoding anything.
+func estimateCandidates(matches []string, logFile string) []candidateEstimate {
+	logged := make(map[string]bool)
+	if err := encodelog.ScanLog(logFile, func(entry encodelog.LogFileEntry) error {
+		logged[entry.InputPath] = !entry.Retry
+		return nil
+	}); err != nil && !os.IsNotExist(err) {
+		zap.S().Warnf("Error reading transcode log: %v", err)
+	}
+
+	var candidates []candidateEstimate
+	for _, match := range matches {
+		match, err := filepath.Abs(match)
+		if err != nil {
+			zap.S().Errorf("Error resolving absolute path: %v", err)
+			continue
+		}
+		if isEncodedFile(match) || logged[match] {
+			continue
+		}
+
+		info, err := os.Stat(match)
+		if err != nil {
+			zap.S().Errorf("Item %q stat error: %v", match, err)
+			continue
+		}
+		ffprobeData, err := ffmpegutil.GetFfprobeInfo(match)
+		if err != nil {
+			zap.S().Errorf("Item %q ffprobe error: %v", match, err)
+			continue
+		}
+		if !ffprobeData.HasRealVideo() || ffprobeData.GetBitrateBPS() < lowBitrateThreshold {
+			continue
+		}
+		if bpp := ffprobeData.GetBitsPerPixel(); *minBPP > 0 && bpp > 0 && bpp < *minBPP {
+			continue
+		}
+		if duration := ffprobeData.GetDurationSeconds(); *minDuration > 0 && duration > 0 && duration < minDuration.Seconds() {
+			continue
+		}
+
+		est := estimateFile(ffprobeData, info.Size(), *estimateSpeed)
+		zap.S().Debugf("Item %q estimate: %s -> %s in %s", match, fsutil.FormatBytes(est.InputBytes), fsutil.FormatBytes(est.OutputBytes), est.EncodeTime.Round(time.Second))
+		candidates = append(candidates, candidateEstimate{fileEstimate: est, Path: match, BitrateBPS: ffprobeData.GetBitrateBPS()})
+	}
+	return candidates
+}
+
+// runEstimateTotal prints the aggregate projected encode time and space savings of every candidate file.
+func runEstimateTotal(matches []string, logFile string) {
+	candidates := estimateCandidates(matches, logFile)
+	var total fileEstimate
+	for _, candidate := range candidates {
+		total.InputBytes += candidate.InputBytes
+		total.OutputBytes += candidate.OutputBytes
+		total.EncodeTime += candidate.EncodeTime
+	}
+
+	fmt.Printf("Files to encode:     %d of %d\n", len(candidates), len(matches))
+	fmt.Printf("Input size:          %s\n", fsutil.FormatBytes(total.InputBytes))
+	fmt.Printf("Estimated output:    %s\n", fsutil.FormatBytes(total.OutputBytes))
+	fmt.Printf("Estimated reclaimed: %s\n", fsutil.FormatBytes(total.InputBytes-total.OutputBytes))
+	fmt.Printf("Estimated time:      %.1f hours at %.2fx realtime\n", total.EncodeTime.Hours(), *estimateSpeed)
+}
+
+// -report-by values
+const (
+	reportBySize    = "size"
+	reportByBitrate = "bitrate"
+)
+
+// rankCandidates sorts candidates largest or highest bitrate first and returns at most n of them.
+func rankCandidates(candidates []candidateEstimate, by string, n int) []candidateEstimate {
+	slices.SortStableFunc(candidates, func(a, b candidateEstimate) int {
+		if by == reportByBitrate {
+			return cmp.Compare(b.BitrateBPS, a.BitrateBPS)
+		}
+		return cmp.Compare(b.InputBytes, a.InputBytes)
+	})
+	return candidates[:min(n, len(candidates))]
+}
+
+// runReportCandidates prints the top n candidates for encoding with their estimated savings so that the highest
+// value files can be tackled first.
+func runReportCandidates(matches []string, logFile string, n int, by string) {
+	candidates := estimateCandidates(matches, logFile)
+	top := rankCandidates(candidates, by, n)
+
+	fmt.Printf("Top %d of %d candidates by %s\n", len(top), len(candidates), by)
+	fmt.Printf("%4s  %10s  %10s  %10s  %s\n", "#", "SIZE", "BITRATE", "SAVINGS", "PATH")
+	var savings int64
+	for idx, candidate := range top {
+		saved := candidate.InputBytes - candidate.OutputBytes
+		savings += saved
+		fmt.Printf("%4d  %10s  %7.1f Mb  %10s  %s\n", idx+1, fsutil.FormatBytes(candidate.InputBytes), float64(candidate.BitrateBPS)/1e6, fsutil.FormatBytes(saved), candidate.Path)
+	}
+	fmt.Printf("Estimated reclaimed by these files: %s\n", fsutil.FormatBytes(savings))
+}
@@ -0,0 +1,36 @@
+package main
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestRankCandidates(t *testing.T) {
+	candidates := func() []candidateEstimate {
+		return []candidateEstimate{
+			{Path: "small-high-bitrate.mkv", BitrateBPS: 40000000, fileEstimate: fileEstimate{InputBytes: 2 << 30}},
+			{Path: "large.mkv", BitrateBPS: 20000000, fileEstimate: fileEstimate{InputBytes: 30 << 30}},
+			{Path: "medium.mkv", BitrateBPS: 10000000, fileEstimate: fileEstimate{InputBytes: 8 << 30}},
+		}
+	}
+
+	tests := []struct {
+		by   string
+		n    int
+		want []string
+	}{
+		{by: reportBySize, n: 2, want: []string{"large.mkv", "medium.mkv"}},
+		{by: reportByBitrate, n: 2, want: []string{"small-high-bitrate.mkv", "large.mkv"}},
+		{by: reportBySize, n: 10, want: []string{"large.mkv", "medium.mkv", "small-high-bitrate.mkv"}},
+	}
+	for _, tc := range tests {
+		top := rankCandidates(candidates(), tc.by, tc.n)
+		var got []string
+		for _, candidate := range top {
+			got = append(got, candidate.Path)
+		}
+		if !slices.Equal(got, tc.want) {
+			t.Errorf("rankCandidates(%s, %d) = %v, want %v", tc.by, tc.n, got, tc.want)
+		}
+	}
+}
@@ -0,0 +1,28 @@
+package main
+
+import (
+	"flag"
+	"strings"
+)
+
+// globFlag collects repeated glob flags.
+type globFlag []string
+
+func (g *globFlag) String() string {
+	if g == nil {
+		return ""
+	}
+	return strings.Join(*g, " ")
+}
+
+func (g *globFlag) Set(value string) error {
+	*g = append(*g, value)
+	return nil
+}
+
+// globVar defines a repeatable glob flag.
+func globVar(name, usage string) *globFlag {
+	g := &globFlag{}
+	flag.Var(g, name, usage)
+	return g
+}
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"cmp"
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// filterStage determines where a filter is placed in a FilterChain.
+type filterStage int
+
+// Filter stages in the order they are applied. Geometry is fixed up first so that later filters work on the
+// picture that will actually be encoded, and subtitles are burnt in last so that they are not cropped, scaled,
+// denoised or tonemapped.
+const (
+	stageDeinterlace filterStage = iota
+	stageCrop
+	stageScale
+	stageDenoise
+	stageTonemap
+	stageExtra // -vf-extra, applied to the picture as encoded but before subtitles are burnt in
+	stageSubtitleBurn
+	stageUpload // moves frames onto the hardware encoder's device, must be last
+)
+
+type stagedFilter struct {
+	stage  filterStage
+	filter string
+}
+
+// FilterChain assembles the video filters requested by independent features into a single -vf argument, passing
+// -vf more than once would make ffmpeg keep only the last one. Filters are ordered by stage regardless of the
+// order they are added in, filters within the same stage keep their insertion order.
+type FilterChain struct {
+	filters []stagedFilter
+}
+
+// Add adds a filter at the given stage, empty filters are ignored.
+func (fc *FilterChain) Add(stage filterStage, filter string) {
+	if filter != "" {
+		fc.filters = append(fc.filters, stagedFilter{stage: stage, filter: filter})
+	}
+}
+
+func (fc *FilterChain) String() string {
+	ordered := slices.Clone(fc.filters)
+	slices.SortStableFunc(ordered, func(a, b stagedFilter) int {
+		return cmp.Compare(a.stage, b.stage)
+	})
+	filters := make([]string, 0, len(ordered))
+	for _, f := range ordered {
+		filters = append(filters, f.filter)
+	}
+	return strings.Join(filters, ",")
+}
+
+// StreamArgs returns the filter argument applying the chain to a single output stream e.g. v:0, for when other
+// video streams are stream copied, or nil if it is empty.
+func (fc *FilterChain) StreamArgs(specifier string) []string {
+	if len(fc.filters) == 0 {
+		return nil
+	}
+	return []string{"-filter:" + specifier, fc.String()}
+}
+
+// Args returns the -vf argument for the chain or nil if it is empty.
+func (fc *FilterChain) Args() []string {
+	if len(fc.filters) == 0 {
+		return nil
+	}
+	return []string{"-vf", fc.String()}
+}
+
+// validateExtraFilters checks a -vf-extra filter chain. It is passed to ffmpeg as given, but it is appended to the
+// single -vf chain so it must be a plain comma separated chain: labels and ; would make it a filtergraph, and
+// hardware uploads are added by the encoder's own stage.
+func validateExtraFilters(chain string) error {
+	if strings.TrimSpace(chain) == "" {
+		return nil
+	}
+	if strings.HasPrefix(strings.TrimSpace(chain), "-") {
+		return fmt.Errorf("%q is a filter chain e.g. deblock=filter=strong, not ffmpeg options", chain)
+	}
+	if strings.ContainsAny(chain, "[];") {
+		return fmt.Errorf("%q must be a comma separated filter chain without labels or ;", chain)
+	}
+	for _, filter := range strings.Split(chain, ",") {
+		name, _, _ := strings.Cut(strings.TrimSpace(filter), "=")
+		if name == "" {
+			return fmt.Errorf("%q has an empty filter", chain)
+		}
+		if name == "hwupload" || name == "hwupload_cuda" {
+			return fmt.Errorf("%q uploads to the hardware encoder's device, which -encoder does itself", chain)
+		}
+	}
+	return nil
+}
+
+// denoiseFilter returns the filter for a -denoise mode. Denoising trades fine detail for size and is meant for
+// noisy sources e.g. low light camcorder footage where the encoder would otherwise spend bits on the noise. A
+// strength of 0 uses the filter's defaults.
+func denoiseFilter(mode string, strength float64) (string, error) {
+	switch mode {
+	case "":
+		return "", nil
+	case "hqdn3d":
+		if strength > 0 {
+			return fmt.Sprintf("hqdn3d=luma_spatial=%g", strength), nil
+		}
+		return "hqdn3d", nil
+	case "nlmeans":
+		if strength > 0 {
+			return fmt.Sprintf("nlmeans=s=%g", strength), nil
+		}
+		return "nlmeans", nil
+	default:
+		return "", fmt.Errorf("unknown denoise filter %q, must be hqdn3d or nlmeans", mode)
+	}
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestFilterChainCombinesFilters(t *testing.T) {
+	denoise, err := denoiseFilter("hqdn3d", 6)
+	if err != nil {
+		t.Fatalf("denoiseFilter() error: %v", err)
+	}
+
+	var fc FilterChain
+	fc.Add(stageDenoise, denoise)
+	fc.Add(stageCrop, "crop=1920:800:0:140")
+	fc.Add(stageScale, "")
+
+	want := []string{"-vf", "crop=1920:800:0:140,hqdn3d=luma_spatial=6"}
+	if got := fc.Args(); !slices.Equal(got, want) {
+		t.Errorf("FilterChain.Args() = %v, want %v", got, want)
+	}
+
+	var empty FilterChain
+	if got := empty.Args(); got != nil {
+		t.Errorf("empty FilterChain.Args() = %v, want nil", got)
+	}
+}
+
+func TestFilterChainOrdering(t *testing.T) {
+	var fc FilterChain
+	fc.Add(stageSubtitleBurn, "subtitles=in.mkv")
+	fc.Add(stageTonemap, "tonemap=hable")
+	fc.Add(stageDenoise, "hqdn3d")
+	fc.Add(stageScale, "scale=-2:1080")
+	fc.Add(stageCrop, "crop=1920:800:0:140")
+	fc.Add(stageDeinterlace, "bwdif")
+	fc.Add(stageScale, "setsar=1")
+
+	want := "bwdif,crop=1920:800:0:140,scale=-2:1080,setsar=1,hqdn3d,tonemap=hable,subtitles=in.mkv"
+	if got := fc.String(); got != want {
+		t.Errorf("FilterChain.String() = %q, want %q", got, want)
+	}
+}
+
+func TestDenoiseFilter(t *testing.T) {
+	tests := []struct {
+		mode     string
+		strength float64
+		want     string
+		wantErr  bool
+	}{
+		{mode: "", want: ""},
+		{mode: "hqdn3d", want: "hqdn3d"},
+		{mode: "nlmeans", strength: 1.5, want: "nlmeans=s=1.5"},
+		{mode: "bilateral", wantErr: true},
+	}
+	for _, tc := range tests {
+		got, err := denoiseFilter(tc.mode, tc.strength)
+		if (err != nil) != tc.wantErr {
+			t.Errorf("denoiseFilter(%q) error = %v, wantErr %v", tc.mode, err, tc.wantErr)
+			continue
+		}
+		if got != tc.want {
+			t.Errorf("denoiseFilter(%q, %v) = %q, want %q", tc.mode, tc.strength, got, tc.want)
+		}
+	}
+}
+
+func TestValidateExtraFilters(t *testing.T) {
+	for chain, wantErr := range map[string]bool{
+		"":                         false,
+		"deblock=filter=strong":    false,
+		"unsharp,eq=contrast=1.05": false,
+		"-vf unsharp":              true,
+		"[0:v]unsharp[out]":        true,
+		"unsharp;hqdn3d":           true,
+		"unsharp,,hqdn3d":          true,
+		"format=nv12,hwupload":     true,
+	} {
+		if err := validateExtraFilters(chain); (err != nil) != wantErr {
+			t.Errorf("validateExtraFilters(%q) error = %v, want error %v", chain, err, wantErr)
+		}
+	}
+}
+
+func TestExtraFiltersOrder(t *testing.T) {
+	pd := mustParseProbe(t, threeLanguageProbe)
+	setFlag(t, denoise, "hqdn3d")
+	setFlag(t, vfExtra, "deblock=filter=strong")
+	setFlag(t, encoder, encoderVAAPI)
+
+	args, _, err := createFfmpegCommand(pd, "in.mkv", "out.mkv")
+	if err != nil {
+		t.Fatalf("createFfmpegCommand() error: %v", err)
+	}
+	if !containsSeq(args, "-vf", "hqdn3d,deblock=filter=strong,format=p010,hwupload") {
+		t.Errorf("createFfmpegCommand() with -vf-extra = %v, want it after -denoise and before the hardware upload", args)
+	}
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"github.com/bmatcuk/doublestar/v4"
+	"github.com/garethgeorge/media-toolkit/internal/encodelog"
+	"github.com/garethgeorge/media-toolkit/internal/ffmpegutil"
+)
+
+// Dynamic range overrides from -force-hdr and -force-sdr.
+const (
+	dynamicRangeHDR = "hdr"
+	dynamicRangeSDR = "sdr"
+)
+
+// validateGlobs checks a comma separated list of doublestar globs.
+func validateGlobs(globs string) error {
+	for _, glob := range strings.Split(globs, ",") {
+		if glob = strings.TrimSpace(glob); glob != "" && !doublestar.ValidatePathPattern(glob) {
+			return fmt.Errorf("invalid glob %q", glob)
+		}
+	}
+	return nil
+}
+
+// matchesAnyGlob reports whether path matches one of a comma separated list of doublestar globs. Globs without a
+// path separator are matched against the file name alone.
+func matchesAnyGlob(globs, path string) (bool, error) {
+	for _, glob := range strings.Split(globs, ",") {
+		glob = strings.TrimSpace(glob)
+		if glob == "" {
+			continue
+		}
+		target := path
+		if !strings.ContainsRune(glob, filepath.Separator) {
+			target = filepath.Base(path)
+		}
+		match, err := doublestar.PathMatch(glob, target)
+		if err != nil {
+			return false, fmt.Errorf("invalid glob %q: %w", glob, err)
+		}
+		if match {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// dolbyVisionPreserved reports whether Dolby Vision metadata is carried into encodes, only svtav1 can with -dolby-vision.
+func dolbyVisionPreserved() bool {
+	return *dolbyVision && *encoder == encoderSVTAV1
+}
+
+// dynamicHDRDecisions describes what happens to the source's dynamic HDR metadata. Dolby Vision is kept if
+// dolbyVisionPreserved, HDR10+ can't be carried by any encoder and is always dropped, the static HDR10 metadata of
+// both is kept.
+func dynamicHDRDecisions(probeData ffmpegutil.ProbeData, isHDR bool) []encodelog.StreamDecision {
+	if !isHDR {
+		return nil
+	}
+	var decisions []encodelog.StreamDecision
+	if probeData.HasDolbyVision() {
+		profile := probeData.DolbyVisionProfile()
+		switch {
+		case dolbyVisionPreserved():
+			decisions = append(decisions, encodelog.StreamDecision{Stream: "0:v", Action: "copy", Reason: fmt.Sprintf("Dolby Vision profile %d metadata carried with -dolbyvision", profile)})
+		case *encoder != encoderSVTAV1:
+			decisions = append(decisions, encodelog.StreamDecision{Stream: "0:v", Action: "drop", Reason: fmt.Sprintf("Dolby Vision profile %d metadata dropped, %s can't carry it, keeping the HDR10 base layer", profile, *encoder)})
+		default:
+			decisions = append(decisions, encodelog.StreamDecision{Stream: "0:v", Action: "drop", Reason: fmt.Sprintf("Dolby Vision profile %d metadata dropped, keeping the HDR10 base layer, -dolby-vision carries it", profile)})
+		}
+	}
+	if probeData.HasHDR10Plus() {
+		decisions = append(decisions, encodelog.StreamDecision{Stream: "0:v", Action: "drop", Reason: "HDR10+ dynamic metadata dropped, no AV1 encoder carries it, keeping the static HDR10 metadata"})
+	}
+	return decisions
+}
+
+// resolveDynamicRange decides whether a file is encoded as HDR. ffprobe's color metadata is unreliable on some
+// sources so -force-hdr and -force-sdr override the detection, the override is returned as a decision for the log.
+func resolveDynamicRange(probeData ffmpegutil.ProbeData, infile string) (bool, *encodelog.StreamDecision, error) {
+	detected := probeData.HasHDR()
+	forceHDR, err := matchesAnyGlob(*forceHDRGlobs, infile)
+	if err != nil {
+		return false, nil, err
+	}
+	forceSDR, err := matchesAnyGlob(*forceSDRGlobs, infile)
+	if err != nil {
+		return false, nil, err
+	}
+
+	switch {
+	case forceHDR && forceSDR:
+		return false, nil, fmt.Errorf("matched by both -force-hdr and -force-sdr")
+	case forceHDR:
+		return true, &encodelog.StreamDecision{Stream: "0:v", Action: "force-" + dynamicRangeHDR, Reason: fmt.Sprintf("-force-hdr override, detected hdr=%v", detected)}, nil
+	case forceSDR:
+		return false, &encodelog.StreamDecision{Stream: "0:v", Action: "force-" + dynamicRangeSDR, Reason: fmt.Sprintf("-force-sdr override, detected hdr=%v", detected)}, nil
+	}
+	return detected, nil, nil
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/garethgeorge/media-toolkit/internal/encodelog"
+)
+
+func TestResolveDynamicRange(t *testing.T) {
+	sdrProbe := mustParseProbe(t, threeLanguageProbe)
+	hdrProbe := mustParseProbe(t, `{"streams": [{"codec_type": "video", "codec_name": "hevc", "color_space": "bt2020nc", "color_transfer": "smpte2084"}]}`)
+
+	tests := []struct {
+		name         string
+		forceHDR     string
+		forceSDR     string
+		probe        string
+		infile       string
+		wantHDR      bool
+		wantOverride bool
+	}{
+		{name: "detected sdr", infile: "/media/Movies/Film/film.mkv"},
+		{name: "forced hdr by path", forceHDR: "/media/Movies/**/film.mkv", infile: "/media/Movies/Film/film.mkv", wantHDR: true, wantOverride: true},
+		{name: "forced hdr by name", forceHDR: "other.mkv, film*.mkv", infile: "/media/Movies/Film/film.mkv", wantHDR: true, wantOverride: true},
+		{name: "not matched", forceHDR: "/media/TV/**", infile: "/media/Movies/Film/film.mkv"},
+		{name: "detected hdr", probe: "hdr", infile: "/media/Movies/Film/film.mkv", wantHDR: true},
+		{name: "forced sdr", probe: "hdr", forceSDR: "*.mkv", infile: "/media/Movies/Film/film.mkv", wantOverride: true},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			setFlag(t, forceHDRGlobs, tc.forceHDR)
+			setFlag(t, forceSDRGlobs, tc.forceSDR)
+			pd := sdrProbe
+			if tc.probe == "hdr" {
+				pd = hdrProbe
+			}
+			isHDR, override, err := resolveDynamicRange(pd, tc.infile)
+			if err != nil {
+				t.Fatalf("resolveDynamicRange() error: %v", err)
+			}
+			if isHDR != tc.wantHDR || (override != nil) != tc.wantOverride {
+				t.Errorf("resolveDynamicRange() = %v, %v, want hdr %v override %v", isHDR, override, tc.wantHDR, tc.wantOverride)
+			}
+		})
+	}
+
+	setFlag(t, forceHDRGlobs, "*.mkv")
+	setFlag(t, forceSDRGlobs, "film.mkv")
+	if _, _, err := resolveDynamicRange(sdrProbe, "/media/film.mkv"); err == nil {
+		t.Errorf("resolveDynamicRange() matched by both overrides expected an error")
+	}
+}
+
+func TestDynamicHDRMetadata(t *testing.T) {
+	pd := mustParseProbe(t, `{
+		"streams": [{"codec_type": "video", "codec_name": "hevc", "width": 3840, "height": 2160, "color_space": "bt2020nc", "color_transfer": "smpte2084",
+			"side_data_list": [{"side_data_type": "DOVI configuration record", "dv_profile": 8}]}],
+		"frames": [{"side_data_list": [{"side_data_type": "HDR Dynamic Metadata SMPTE2094-40 (HDR10+)"}]}]
+	}`)
+
+	args, decisions, err := createFfmpegCommand(pd, "in.mkv", "out.mkv")
+	if err != nil {
+		t.Fatalf("createFfmpegCommand() error: %v", err)
+	}
+	if slices.Contains(args, "-dolbyvision") || !strings.Contains(strings.Join(args, " "), "enable-hdr=1") {
+		t.Errorf("createFfmpegCommand() without -dolby-vision = %v, want enable-hdr=1 and no -dolbyvision", args)
+	}
+	drops := 0
+	for _, decision := range decisions {
+		if decision.Action == "drop" {
+			drops++
+		}
+	}
+	if drops != 2 {
+		t.Errorf("createFfmpegCommand() decisions = %v, want Dolby Vision and HDR10+ dropped", decisions)
+	}
+
+	setFlag(t, dolbyVision, true)
+	args, decisions, err = createFfmpegCommand(pd, "in.mkv", "out.mkv")
+	if err != nil {
+		t.Fatalf("createFfmpegCommand() error: %v", err)
+	}
+	if !containsSeq(args, "-dolbyvision", "1") {
+		t.Errorf("createFfmpegCommand() with -dolby-vision missing -dolbyvision 1: %v", args)
+	}
+	if !slices.ContainsFunc(decisions, func(d encodelog.StreamDecision) bool {
+		return d.Action == "copy" && strings.Contains(d.Reason, "Dolby Vision")
+	}) {
+		t.Errorf("createFfmpegCommand() decisions = %v, want Dolby Vision carried", decisions)
+	}
+
+	setFlag(t, encoder, encoderNVENC)
+	if dolbyVisionPreserved() {
+		t.Errorf("dolbyVisionPreserved() with av1_nvenc = true, want false")
+	}
+}
+
+func TestValidateGlobs(t *testing.T) {
+	if err := validateGlobs("/media/**/*.mkv, film.mkv"); err != nil {
+		t.Errorf("validateGlobs() error: %v", err)
+	}
+	if err := validateGlobs("film[.mkv"); err == nil {
+		t.Errorf("validateGlobs() of an unterminated class expected an error")
+	}
+}
@@ -0,0 +1,197 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// jobsController adapts the number of concurrent encodes to the observed aggregate throughput. It hill climbs:
+// while adding an encode raises throughput by more than the plateau tolerance it keeps adding, once throughput stops
+// rising or falls it backs off to the best concurrency seen and settles there. SVT-AV1 has diminishing returns
+// past some thread count so the best concurrency depends on the machine and the content.
+type jobsController struct {
+	minJobs, maxJobs int
+	tolerance        float64 // relative throughput gain below which adding an encode is considered not worth it
+
+	current        int
+	best           int
+	bestThroughput float64
+	settled        bool
+}
+
+func newJobsController(maxJobs int) *jobsController {
+	return &jobsController{
+		minJobs:   1,
+		maxJobs:   max(1, maxJobs),
+		tolerance: 0.05,
+		current:   1,
+		best:      1,
+	}
+}
+
+// Jobs returns the number of encodes that should currently run concurrently.
+func (c *jobsController) Jobs() int {
+	return c.current
+}
+
+// Observe records the aggregate throughput, in seconds of media encoded per second summed over all concurrent
+// encodes, measured while running Jobs() encodes and returns the new concurrency.
+func (c *jobsController) Observe(throughput float64) int {
+	if c.settled || throughput <= 0 {
+		return c.current
+	}
+
+	switch {
+	case c.bestThroughput == 0 || throughput > c.bestThroughput*(1+c.tolerance):
+		c.best, c.bestThroughput = c.current, throughput
+		if c.current < c.maxJobs {
+			c.current++
+			zap.S().Infof("Throughput %.2fx realtime with %d concurrent encodes, trying %d", throughput, c.best, c.current)
+		} else {
+			c.settled = true
+			zap.S().Infof("Throughput %.2fx realtime with %d concurrent encodes, staying at the maximum", throughput, c.current)
+		}
+	default:
+		zap.S().Infof("Throughput %.2fx realtime with %d concurrent encodes is no better than %.2fx with %d, settling on %d", throughput, c.current, c.bestThroughput, c.best, c.best)
+		c.current = max(c.minJobs, c.best)
+		c.settled = true
+	}
+	return c.current
+}
+
+// encodeSpeed returns the speed of an encode as a multiple of realtime.
+func encodeSpeed(mediaSeconds, elapsedSeconds float64) float64 {
+	if elapsedSeconds <= 0 {
+		return 0
+	}
+	return mediaSeconds / elapsedSeconds
+}
+
+// -jobs value that adapts the number of concurrent encodes to the observed throughput.
+const jobsAuto = "auto"
+
+// parseJobs converts a -jobs value into the maximum number of concurrent encodes, with auto the maximum is a
+// quarter of the cores as SVT-AV1 makes poor use of fewer than 4 threads per encode.
+func parseJobs(spec string, cores int) (maxJobs int, auto bool, err error) {
+	if spec == jobsAuto {
+		return max(1, cores/4), true, nil
+	}
+	n, err := strconv.Atoi(spec)
+	if err != nil || n < 1 {
+		return 0, false, fmt.Errorf("jobs %q must be a positive number or auto", spec)
+	}
+	return n, false, nil
+}
+
+// jobPool bounds the number of concurrently running encodes. With a controller the bound follows it: each time
+// as many encodes as are allowed to run have finished, their aggregate throughput since the bound last changed is
+// reported to the controller. Throughput is measured over the time at least one encode was running, so time spent
+// probing and skipping files or waiting for the machine to cool down doesn't count against it.
+type jobPool struct {
+	mu      sync.Mutex
+	cond    *sync.Cond
+	limit   int
+	running int
+
+	controller   *jobsController
+	encoding     int           // encodes between StartEncode and FinishEncode
+	busySince    time.Time     // when encoding last became non-zero
+	windowBusy   time.Duration // time with encodes running in the window, up to busySince if still encoding
+	windowMedia  float64       // seconds of media encoded in the window
+	windowEncode int           // encodes finished in the window
+}
+
+func newJobPool(limit int, controller *jobsController) *jobPool {
+	p := &jobPool{limit: max(1, limit), controller: controller}
+	if controller != nil {
+		p.limit = controller.Jobs()
+	}
+	p.cond = sync.NewCond(&p.mu)
+	return p
+}
+
+// Acquire blocks until another encode may start.
+func (p *jobPool) Acquire() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for p.running >= p.limit {
+		p.cond.Wait()
+	}
+	p.running++
+}
+
+// Release frees the slot of a finished job.
+func (p *jobPool) Release() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.running--
+	p.cond.Broadcast()
+}
+
+// StartEncode marks the start of an encode, each call must be followed by FinishEncode.
+func (p *jobPool) StartEncode() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.encoding == 0 {
+		p.busySince = time.Now()
+	}
+	p.encoding++
+}
+
+// FinishEncode marks the end of an encode, mediaSeconds of media if it succeeded, and reports the window's
+// throughput to the controller once it is complete.
+func (p *jobPool) FinishEncode(mediaSeconds float64, succeeded bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.encoding--
+	if p.encoding == 0 {
+		p.windowBusy += time.Since(p.busySince)
+	}
+	if p.controller == nil || !succeeded {
+		return
+	}
+	p.windowMedia += mediaSeconds
+	p.windowEncode++
+	if p.windowEncode < p.limit {
+		return
+	}
+	busy := p.windowBusy
+	if p.encoding > 0 {
+		busy += time.Since(p.busySince)
+	}
+	throughput := encodeSpeed(p.windowMedia, busy.Seconds())
+	if limit := p.controller.Observe(throughput); limit != p.limit {
+		p.limit = limit
+		p.cond.Broadcast()
+	}
+	p.windowBusy, p.windowMedia, p.windowEncode = 0, 0, 0
+	if p.encoding > 0 {
+		p.busySince = time.Now()
+	}
+}
+
+// queueProgress tracks which matches have finished when they finish out of order, so that the checkpoint only
+// ever records a position before which every match is done. It is not safe for concurrent use.
+type queueProgress struct {
+	done     []bool
+	frontier int // index of the first match that hasn't finished
+}
+
+func newQueueProgress(n, start int) *queueProgress {
+	return &queueProgress{done: make([]bool, n), frontier: start}
+}
+
+// Finish marks the match at idx finished and returns the index of the last match of the finished prefix, ok is
+// false if the prefix didn't grow.
+func (q *queueProgress) Finish(idx int) (last int, ok bool) {
+	q.done[idx] = true
+	prev := q.frontier
+	for q.frontier < len(q.done) && q.done[q.frontier] {
+		q.frontier++
+	}
+	return q.frontier - 1, q.frontier > prev
+}
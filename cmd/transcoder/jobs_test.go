@@ -0,0 +1,111 @@
+package main
+
+import (
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestJobsController(t *testing.T) {
+	tests := []struct {
+		name       string
+		maxJobs    int
+		throughput []float64 // aggregate throughput observed at each successive concurrency
+		want       []int     // concurrency after each observation
+	}{
+		{name: "plateau", maxJobs: 8, throughput: []float64{1.0, 1.8, 2.4, 2.45}, want: []int{2, 3, 4, 3}},
+		{name: "regression", maxJobs: 8, throughput: []float64{1.0, 0.9}, want: []int{2, 1}},
+		{name: "capped", maxJobs: 2, throughput: []float64{1.0, 1.9}, want: []int{2, 2}},
+		{name: "settled ignores later samples", maxJobs: 8, throughput: []float64{1.0, 1.0, 5.0}, want: []int{2, 1, 1}},
+	}
+	for _, tc := range tests {
+		c := newJobsController(tc.maxJobs)
+		for i, throughput := range tc.throughput {
+			if got := c.Observe(throughput); got != tc.want[i] {
+				t.Errorf("%s: Observe(%v) step %d = %d, want %d", tc.name, throughput, i, got, tc.want[i])
+				break
+			}
+		}
+	}
+}
+
+func TestParseJobs(t *testing.T) {
+	tests := []struct {
+		spec    string
+		maxJobs int
+		auto    bool
+		wantErr bool
+	}{
+		{spec: "1", maxJobs: 1},
+		{spec: "3", maxJobs: 3},
+		{spec: "auto", maxJobs: 8, auto: true},
+		{spec: "0", wantErr: true},
+		{spec: "many", wantErr: true},
+	}
+	for _, tc := range tests {
+		maxJobs, auto, err := parseJobs(tc.spec, 32)
+		if (err != nil) != tc.wantErr || maxJobs != tc.maxJobs || auto != tc.auto {
+			t.Errorf("parseJobs(%q, 32) = %d, %v, %v, want %d, %v, error %v", tc.spec, maxJobs, auto, err, tc.maxJobs, tc.auto, tc.wantErr)
+		}
+	}
+}
+
+func TestJobPoolLimitsConcurrency(t *testing.T) {
+	pool := newJobPool(2, nil)
+	var mu sync.Mutex
+	running, peak := 0, 0
+	var wg sync.WaitGroup
+	for range 10 {
+		pool.Acquire()
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer pool.Release()
+			mu.Lock()
+			running++
+			peak = max(peak, running)
+			mu.Unlock()
+			time.Sleep(time.Millisecond)
+			mu.Lock()
+			running--
+			mu.Unlock()
+		}()
+	}
+	wg.Wait()
+	if peak > 2 {
+		t.Errorf("peak concurrency %d, want at most 2", peak)
+	}
+}
+
+func TestQueueProgress(t *testing.T) {
+	q := newQueueProgress(5, 1)
+	steps := []struct {
+		finish int
+		last   int
+		ok     bool
+	}{
+		{finish: 2, ok: false}, // 1 is still running
+		{finish: 1, last: 2, ok: true},
+		{finish: 4, ok: false},
+		{finish: 3, last: 4, ok: true},
+	}
+	for _, step := range steps {
+		last, ok := q.Finish(step.finish)
+		if ok != step.ok || (ok && last != step.last) {
+			t.Errorf("Finish(%d) = %d, %v, want %d, %v", step.finish, last, ok, step.last, step.ok)
+		}
+	}
+}
+
+func TestJobPoolThroughputIgnoresIdleTime(t *testing.T) {
+	pool := newJobPool(1, newJobsController(4))
+	time.Sleep(200 * time.Millisecond) // probing and skipping files, no encode running
+	pool.StartEncode()
+	time.Sleep(20 * time.Millisecond)
+	pool.FinishEncode(1, true)
+
+	// 1s of media in about 20ms of encoding is ~50x realtime, counting the idle time would give under 5x
+	if pool.controller.bestThroughput < 10 {
+		t.Errorf("throughput = %.1fx, want only the time encoding counted", pool.controller.bestThroughput)
+	}
+}
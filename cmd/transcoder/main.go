@@ -1,20 +1,29 @@
 package main
 
 import (
+	"context"
 	"errors"
 	"flag"
 	"fmt"
+	"io"
+	"math"
+	"net"
 	"os"
-	"os/exec"
 	"path/filepath"
+	"runtime"
+	"slices"
+	"strconv"
 	"strings"
+	"sync"
 	"time"
 
+	"github.com/garethgeorge/media-toolkit/internal/config"
 	"github.com/garethgeorge/media-toolkit/internal/encodelog"
 	"github.com/garethgeorge/media-toolkit/internal/ffmpegutil"
 	"github.com/garethgeorge/media-toolkit/internal/flags"
 	"github.com/garethgeorge/media-toolkit/internal/fsutil"
 	"github.com/garethgeorge/media-toolkit/internal/lockutil"
+	"github.com/garethgeorge/media-toolkit/internal/metrics"
 	"go.uber.org/zap"
 	"go.uber.org/zap/zapcore"
 )
@@ -24,36 +33,387 @@ var (
 )
 
 var (
-	dockerImage = flag.String("docker-image", "", "Docker image to use for ffmpeg")
-	dockerCpus  = flag.String("docker-cpus", "", "CPU set CPUs to use for encoding e.g. by index 0,1,2,3,....")
+	configFile = flag.String("config", "", "YAML config file of settings named after the flags e.g. preset: 4, see internal/config. Flags given on the command line override it.")
 
+	dockerImage      = flag.String("docker-image", "", "Docker image to use for ffmpeg")
+	dockerCpus       = flag.String("docker-cpus", "", "CPU set CPUs to use for encoding e.g. by index 0,1,2,3,....")
+	dockerPrivileged = flag.Bool("docker-privileged", false, "Run the docker container with --privileged, software encodes don't need it, prefer -docker-devices for hardware acceleration")
+	dockerDevices    = flag.String("docker-devices", "", "Comma separated host devices to pass to the docker container e.g. /dev/dri for VAAPI hardware acceleration")
+	dockerUser       = flag.String("docker-user", "", "Run the docker container as this user so outputs aren't owned by root, either uid:gid or \"self\" for the invoking (sudo) user")
+
+	excludeGlobs = globVar("exclude", "Glob of input paths to skip, matched against the path relative to the input directory e.g. **/Extras/** or *sample*. A glob without a / matches file and directory names. Repeatable.")
+	presetMap    = presetMapVar("preset-map", "Preset by source height as height:preset pairs e.g. 2160:6,1080:8,480:10, the tallest height a source reaches picks its preset overriding -preset. Sources shorter than every height use -preset.")
+	encodeEnv    = envVar("env", "KEY=VALUE environment variable set for each ffmpeg encode e.g. SVT_LOG=1, passed into the container in docker mode. Repeatable.")
+
+	encoder     = flag.String("encoder", encoderSVTAV1, "Video encoder: svtav1 (software), av1_nvenc (Nvidia), av1_qsv (Intel Quick Sync) or av1_vaapi. -crf and -preset are mapped onto each hardware encoder's own scales, SVT-AV1 parameters such as -tune, -keyint and -two-pass are ignored with a warning.")
+	bitDepth    = flag.String("bit-depth", bitDepth10, "Bit depth of the encoded video: 10, 8 for players that can't decode 10 bit AV1, or source to match the source's. HDR is always encoded at 10 bit.")
+	vaapiDevice = flag.String("vaapi-device", "/dev/dri/renderD128", "DRM render node used by -encoder av1_vaapi, pass it to the container with -docker-devices in docker mode")
+
+	tune   = flag.Int("tune", tuneVQ, "SVT-AV1 tune: 0 (visual quality, sharper looking output, best for viewing), 1 (PSNR, optimizes an objective metric, can look softer) or 2 (SSIM)")
 	preset = flag.Int("preset", 6, "Preset to use for encoding. Preset = 8 is fast and disables filmgrain detection / synthesis. Preset = 6 is good for movies and provides a good quality balance.")
 
-	// files with these suffixes are already encoded and are ignored
-	encoderSuffixes []string = []string{
-		"svtav1enc.mkv",
-		"svtav1enc.mp4",
-		".transcode.mkv",
-	}
+	crf             = flag.Int("crf", 24, "SVT-AV1 CRF from 0 to 63, lower is higher quality and larger files")
+	adaptiveCRF     = flag.Bool("adaptive-crf", false, "Adjust -crf by resolution, one step up per halving of the pixel count below 1080p and one step down per doubling above it, e.g. 480p +2 and 4K -2, within -adaptive-crf-range")
+	adaptiveCRFMax  = flag.Int("adaptive-crf-range", 4, "Most -adaptive-crf moves the CRF up or down")
+	encodeMode      = flag.String("mode", modeQuality, "quality, or preview for a fast low quality placeholder encode (preset 12, crf 45) that -upgrade-previews can later replace")
+	upgradePreviews = flag.Bool("upgrade-previews", false, "Encode files that only have a -mode preview encode again at quality, replacing the preview")
+	masterCRF       = flag.Int("master-crf", 0, "Encode a visually lossless master at this CRF e.g. 10 instead of a distribution copy. Masters are written as <name>-svtav1master<ext> beside any distribution copy and finalize never removes their original. 0 disables.")
+
+	sampleDuration = flag.Duration("sample-duration", 0, "Only encode the first part of each file e.g. 2m to cheaply compare -crf and -preset settings. Samples are written as <name>-svtav1enc.sample<ext>, replacing earlier samples, and aren't logged so a later full run still encodes the file. 0 encodes whole files.")
+
+	estimateTotal = flag.Bool("estimate-total", false, "Probe all files and print the estimated total encode time and space reclaimed without encoding")
+	estimateSpeed = flag.Float64("estimate-speed", 1.0, "Encode speed assumed by -estimate-total as a multiple of realtime")
+
+	reportCandidates = flag.Int("report-candidates", 0, "Probe all files and print the top N candidates for encoding with their estimated savings without encoding")
+	reportBy         = flag.String("report-by", reportBySize, "Rank -report-candidates by size or bitrate")
+
+	metricsAddr = flag.String("metrics-addr", "", "Serve Prometheus metrics at /metrics on this address e.g. :9090, such as files processed, bytes saved and encode durations")
+
+	jsonSummary = flag.String("json-summary", "", "Also write the summary printed at the end of the run, or of each -watch batch, to this file as JSON")
+
+	dryRun = flag.Bool("dry-run", false, "Probe and decide as usual but only log the ffmpeg command each file would be encoded with, without encoding, locking or writing the log")
+
+	reencodeAV1 = flag.Bool("reencode-av1", false, "Encode files whose video is already AV1 instead of skipping them, e.g. to re-encode them at a different CRF.")
+
+	minBPP = flag.Float64("min-bpp", 0, "Skip files already encoded at fewer bits per pixel per frame than this, computed as bitrate / (width * height * fps). Unlike the bitrate threshold it is comparable across resolutions, 1080p24 at 8 Mbps is about 0.16. 0 disables the check.")
+
+	minDuration = flag.Duration("min-duration", 0, "Skip files shorter than this e.g. 2m such as sample clips and trailers. Files of unknown duration are not skipped. 0 disables the check.")
+
+	minAge = flag.Duration("min-age", 0, "Skip files modified more recently than this e.g. 10m, avoids picking up files that are still being written")
+
+	minSourceAge = flag.Duration("min-source-age", 0, "Only encode files last modified longer ago than this e.g. 8760h, leaving recent content pristine for a retention period. Skips are recorded and retried on later runs. 0 disables the check.")
+
+	growthCheck = flag.Duration("growth-check", 0, "Sample the files' sizes this far apart e.g. 10s, all files at once before processing them, and skip files that are still growing such as live DVR recordings, retried on the next run. 0 disables the check.")
+
+	stripMetadata        = flag.Bool("strip-metadata", false, "Drop the source's global and stream metadata e.g. titles and encoder tags instead of copying it, audio language tags are kept")
+	noChapters           = flag.Bool("no-chapters", false, "Drop the source's chapter markers instead of copying them to the output")
+	preserveCreationTime = flag.Bool("preserve-creation-time", false, "Copy the source's creation_time container tag to the output instead of letting ffmpeg reset it")
+
+	probeAnalyzeDuration = flag.Duration("probe-analyzeduration", ffmpegutil.ThoroughAnalyzeDuration, "ffprobe -analyzeduration used for containers without reliable headers e.g. .ts recordings")
+	probeSize            = flag.Int64("probe-size", ffmpegutil.ThoroughProbeSize, "ffprobe -probesize in bytes used for containers without reliable headers e.g. .ts recordings")
+
+	qualityMetric = flag.String("quality-metric", "", "Score each encode against its source after encoding with vmaf or ssim and record it in the log, off by default as it costs an extra decode of both files")
+	verifyVMAF    = flag.Bool("verify-vmaf", false, "Shorthand for -quality-metric vmaf, combine with -min-vmaf to fail encodes that score too low")
+	qualitySample = flag.Int("quality-sample", 10, "Only compare every Nth frame when computing -quality-metric")
+	minVMAF       = flag.Float64("min-vmaf", 0, "Fail encodes whose VMAF score is below this, requires -quality-metric vmaf or -verify-vmaf")
+
+	subtitleSyncCheck = flag.Bool("subtitle-sync-check", false, "After encoding compare the first and last subtitle times of each copied subtitle track against the source and fail the encode if they drifted")
+
+	subCodecs     = flag.String("sub-codecs", "", "Comma separated subtitle codecs to copy e.g. subrip,ass,hdmv_pgs_subtitle, others are dropped. Empty copies all subtitles.")
+	subtitleLangs = flag.String("subtitle-langs", "", "Comma separated ISO 639-2 languages of the subtitles to copy e.g. eng,und, und matches untagged subtitles. Empty copies every language.")
+	subtitleMode  = flag.String("subtitle-mode", subtitleModeCopy, "Which subtitles to copy: copy (all), text-only (drop image based PGS and VOBSUB subtitles, for containers that can't carry them) or none")
+
+	denoise         = flag.String("denoise", "", "Denoise filter applied before encoding: hqdn3d or nlmeans. Trades fine detail for size, use sparingly on noisy sources.")
+	denoiseStrength = flag.Float64("denoise-strength", 0, "Strength of the -denoise filter, 0 uses the filter's default")
+	vfExtra         = flag.String("vf-extra", "", "Advanced: comma separated ffmpeg video filters appended after the built-in ones e.g. deblock=filter=strong or unsharp, before subtitles are burnt in. Passed to ffmpeg mostly unvalidated.")
+
+	autocrop = flag.Bool("autocrop", false, "Detect black bars with ffmpeg's cropdetect over a few clips spread across each file and crop them off, only if every clip agrees on the crop. Costs a short decode per clip.")
+
+	outputDir = flag.String("output-dir", "", "Write outputs under this directory, mirroring each source's path relative to the input, so that nothing is written to the source tree. Empty writes outputs beside their sources.")
+
+	tempLocation = flag.String("temp-location", tempHidden, "Where to write the output while encoding so media scanners don't pick it up early: beside, hidden (leading dot) or subdir (.gtranscoder-tmp directory)")
+
+	onlyMissingAudioLang = flag.String("only-missing-audio-lang", "", "Instead of encoding, remux audio tracks in this language e.g. eng from the sources into existing outputs that lack them. Only outputs with a successful encode in the log are remuxed.")
+
+	keyint         = flag.String("keyint", "", "Keyframe interval in frames e.g. 240 or seconds e.g. 10s. Shorter seeks faster, longer compresses better. Empty uses the encoder default.")
+	forceKeyframes = flag.String("force-keyframes", "", "Force keyframes at scene changes (scenecut) or at a fixed interval e.g. 5s")
+
+	frameCheck = flag.Bool("frame-check", true, "Count the output's video frames after encoding and fail the encode if they don't match the source's, catches truncated outputs with a plausible duration")
+
+	decodeCheck     = flag.String("decode-check", "", "Fully decode files to find corrupt frames: source (skip corrupt sources), output (fail corrupt encodes) or both. Off by default as it costs a full decode.")
+	maxDecodeErrors = flag.Int("max-decode-errors", 0, "Maximum number of decode errors tolerated by -decode-check")
+
+	thermalSensor = flag.String("thermal-sensor", "", "Linux only: sysfs temperature file e.g. /sys/class/thermal/thermal_zone0/temp, encoding pauses between files while it reads above -thermal-max")
+	thermalMax    = flag.Float64("thermal-max", 85, "Temperature in °C at which to pause encoding, requires -thermal-sensor")
+	thermalResume = flag.Float64("thermal-resume", 70, "Temperature in °C at which to resume encoding after a pause, requires -thermal-sensor")
+
+	sidecarFormat = flag.String("sidecar", "", "Write a metadata sidecar next to each output for media managers: json or nfo (Kodi fileinfo). Off by default.")
+	copySidecars  = flag.String("copy-sidecars", "", "Comma separated extensions of files named after the source to copy next to the output after encoding e.g. srt,ass,nfo,jpg, renamed after the output such as movie.en.srt to movie-svtav1enc.en.srt. Empty copies none.")
+
+	twoPass = flag.Bool("two-pass", false, "Run an analysis pass before each encode so the encoder can distribute bits better, for more predictable sizes at the cost of a second decode. Needs an ffmpeg whose libsvtav1 supports -pass.")
+
+	fragmented = flag.Bool("fragmented", false, "Write fragmented mp4 suitable for HLS/DASH, only applies to mp4 outputs. Some players handle fragmented files poorly e.g. slow seeking.")
+
+	audioCodec           = flag.String("audio-codec", defaultAudioEncoding.Codec, "ffmpeg encoder for audio tracks that aren't copied e.g. libopus, aac or libfdk_aac")
+	audioBitrate         = flag.String("audio-bitrate", defaultAudioEncoding.Bitrate, "Bitrate of encoded audio tracks e.g. 192k, empty leaves the encoder default")
+	audioDownmixChannels = flag.Int("audio-downmix-channels", defaultAudioEncoding.Channels, "Channels encoded audio tracks are downmixed to, 0 keeps the source's channel count. Surround downmixes of -surround stereo and copy+stereo are stereo unless this is fewer than the source's channels.")
+
+	audioTracks = flag.String("audio-tracks", "", "Comma separated zero-based audio stream indices to keep e.g. 1 or 0,2, overriding the language and channel heuristics. Files with fewer audio streams fail.")
+
+	audioLangs = flag.String("audio-langs", "eng,und", "Comma separated ISO 639-2 languages of the audio tracks to keep, und matches untagged tracks. If no track matches the first one is kept. Empty keeps every language.")
+
+	preferChannels = flag.String("prefer-channels", "", "Keep only one audio track per language, the one with the most or fewest channels. Empty keeps every track.")
+
+	mapExpr = flag.String("map-expr", "", "Advanced: comma separated ffmpeg -map specifiers e.g. 0:a:1,0:s:0 replacing the automatic audio and subtitle selection. Mapped audio and subtitles are stream copied, video is still encoded to AV1. Passed to ffmpeg mostly unvalidated.")
+
+	coverArt = flag.String("cover-art", coverArtCopy, "What to do with attached pictures e.g. embedded posters: copy them into the output untouched, or drop them. Always dropped for webm outputs.")
+
+	copyDataStreams = flag.Bool("copy-data-streams", false, "Copy data streams e.g. GPS and gyro telemetry from action cameras into the output, only possible for mp4 and mov outputs. Dropped by default.")
+
+	forceHDRGlobs = flag.String("force-hdr", "", "Comma separated globs e.g. '**/Planet Earth*/*' of files to encode as HDR (bt2020/PQ) even though their color metadata doesn't say so")
+	forceSDRGlobs = flag.String("force-sdr", "", "Comma separated globs of files to encode as SDR even though their color metadata looks HDR")
+	dolbyVision   = flag.Bool("dolby-vision", false, "Carry Dolby Vision metadata into svtav1 encodes with ffmpeg's -dolbyvision option, needs ffmpeg 7.0 or newer. Otherwise it is dropped leaving the HDR10 base layer, and profile 5 files which have no HDR10 base layer are skipped.")
+
+	verifyExisting = flag.Bool("verify-existing", false, "Re-probe outputs that already exist without a log entry and encode again if they look truncated or broken, instead of trusting them. Same as -overwrite-final verify.")
+	overwriteFinal = flag.String("overwrite-final", overwriteNever, "What to do with an output that already exists without a log entry: never (skip the file), verify (encode again if it fails verification) or always (encode again and replace it)")
+	overwriteTemp  = flag.Bool("overwrite-temp", true, "Remove a leftover temp file from an interrupted encode and encode again, otherwise skip the file until the temp file is gone. Temp files still being written are never removed.")
+
+	watch       = flag.Bool("watch", false, "After processing the input directory keep running and process new files as they arrive, once they've seen no writes for -watch-settle")
+	watchSettle = flag.Duration("watch-settle", time.Minute, "How long a new file must go without writes before -watch processes it")
+
+	lockMaxAge = flag.Duration("lock-max-age", 48*time.Hour, "Treat transcode locks older than this as stale if their PID now belongs to a different program, e.g. a recycled PID of a crashed run. 0 only reclaims locks whose PID is gone.")
+
+	encodeTimeout = flag.Duration("timeout", 0, "Stop an encode that runs longer than this e.g. 6h, such as ffmpeg hanging on a corrupt input, and record it as failed. Applies to each attempt, 0 disables the timeout.")
+
+	maxRetries   = flag.Int("max-retries", 0, "Retry an encode up to this many times when ffmpeg fails for a transient reason, e.g. it was killed for running out of memory or the docker daemon was unreachable. Failures caused by the input are never retried.")
+	retryBackoff = flag.Duration("retry-backoff", 30*time.Second, "Wait this long before the first retry of a failed encode, doubling with each further retry")
+
+	maxProbeFailures = flag.Int("max-probe-failures", 3, "After ffprobe rejects the same unchanged file this many times, skip it permanently until its size or modification time changes")
+
+	resume = flag.Bool("resume", false, "Skip ahead to the queue position recorded by an interrupted run instead of starting from the first file, independent of the encode log")
+
+	jobs = flag.String("jobs", "1", "Number of files to encode concurrently, or auto to keep adding concurrent encodes while throughput rises, up to a quarter of the cores. The output of concurrent ffmpeg processes is interleaved.")
+
+	videoThreads = flag.String("video-threads", "", "SVT-AV1 threads (lp) per encode: a number, auto to divide the machine's cores among concurrent encodes, or empty for the encoder default")
+	audioThreads = flag.Int("audio-threads", 0, "Threads per audio encode, 0 leaves ffmpeg's default which is plenty for opus")
+
+	surroundPolicy = flag.String("surround", surroundCopyStereo, "How to handle surround audio tracks: copy, copy+stereo (copy and add a stereo downmix companion) or stereo (downmix only)")
+
+	outputExt = flag.String("output-ext", ".mkv", "Output container: .mkv, .mp4 or .webm. Audio and subtitles the container can't carry are converted or dropped, .webm requires -audio-codec libopus or libvorbis.")
 )
 
+// encoderVersions is detected once per run and recorded in every log entry for provenance.
+var encoderVersions ffmpegutil.EncoderVersions
+
+// videoThreadCount is the SVT-AV1 lp given to each encode, resolved from -video-threads at startup. 0 leaves the
+// encoder default.
+var videoThreadCount int
+
 const (
 	bitrateTarget       = 4000000 // target bitrate if re-encoding is 2 Mbps AV1 at 1080p
 	lowBitrateThreshold = 5000000 // don't encode anything that's already below this at 1080p
+
+	tempSuffix = ".transcode" // temporary outputs are named <output>.transcode<output ext> while encoding
+
+	// -decode-check values
+	decodeCheckSource = "source"
+	decodeCheckOutput = "output"
+	decodeCheckBoth   = "both"
+
+	// -temp-location values
+	tempBeside     = "beside"           // next to the output
+	tempHidden     = "hidden"           // next to the output with a leading dot so media scanners ignore it
+	tempSubdir     = "subdir"           // in a hidden subdirectory of the output's directory
+	tempSubdirName = ".gtranscoder-tmp" // name of the subdirectory used by tempSubdir
+
+	tempGrowthInterval = 5 * time.Second // how long existing temp files are watched for writes before removing them
 )
 
 func main() {
 	flag.Parse()
 	if flag.NArg() < 1 {
-		fmt.Printf("Usage: %s <input directory>\n", os.Args[0])
+		fmt.Printf("Usage: %s <input directory or glob e.g. '/media/**/*S01*.mkv'>\n", os.Args[0])
 		return
 	}
 
+	if *configFile != "" {
+		cfg, err := config.Load(*configFile)
+		if err != nil {
+			zap.S().Fatalf("Error loading config: %v", err)
+		}
+		if err := config.Apply(flag.CommandLine, cfg); err != nil {
+			zap.S().Fatalf("Invalid config %q: %v", *configFile, err)
+		}
+	}
+
+	if !slices.Contains(surroundPolicies, *surroundPolicy) {
+		zap.S().Fatalf("Invalid -surround policy %q, must be one of %v", *surroundPolicy, surroundPolicies)
+	}
+
+	if *dockerUser != "" {
+		if _, _, err := resolveDockerUser(*dockerUser); err != nil {
+			zap.S().Fatalf("Invalid -docker-user: %v", err)
+		}
+	}
+
+	if *qualityMetric != "" && *qualityMetric != ffmpegutil.MetricVMAF && *qualityMetric != ffmpegutil.MetricSSIM {
+		zap.S().Fatalf("Invalid -quality-metric %q, must be vmaf or ssim", *qualityMetric)
+	}
+	if *verifyVMAF && *qualityMetric == ffmpegutil.MetricSSIM {
+		zap.S().Fatalf("-verify-vmaf can't be combined with -quality-metric ssim")
+	}
+	if *minVMAF > 0 && activeQualityMetric() != ffmpegutil.MetricVMAF {
+		zap.S().Fatalf("-min-vmaf requires -quality-metric vmaf or -verify-vmaf")
+	}
+
+	if _, err := denoiseFilter(*denoise, *denoiseStrength); err != nil {
+		zap.S().Fatalf("Invalid -denoise: %v", err)
+	}
+	if err := validateExtraFilters(*vfExtra); err != nil {
+		zap.S().Fatalf("Invalid -vf-extra: %v", err)
+	}
+	if *vfExtra != "" && *onlyMissingAudioLang != "" {
+		zap.S().Fatalf("-vf-extra can't be combined with -only-missing-audio-lang, which copies the video without filtering it")
+	}
+
+	if *tempLocation != tempBeside && *tempLocation != tempHidden && *tempLocation != tempSubdir {
+		zap.S().Fatalf("Invalid -temp-location %q, must be beside, hidden or subdir", *tempLocation)
+	}
+
+	if err := validateEncoder(*encoder); err != nil {
+		zap.S().Fatalf("Invalid -encoder: %v", err)
+	}
+	if err := validateBitDepth(*bitDepth); err != nil {
+		zap.S().Fatalf("Invalid -bit-depth: %v", err)
+	}
+	if err := validateCoverArt(*coverArt); err != nil {
+		zap.S().Fatalf("Invalid -cover-art: %v", err)
+	}
+	for _, warning := range encoderFlagWarnings(*encoder) {
+		zap.S().Warnf("-encoder %s: %s", *encoder, warning)
+	}
+	if err := validateTune(*tune); err != nil {
+		zap.S().Fatalf("Invalid -tune: %v", err)
+	}
+	if *keyint != "" {
+		if err := validateKeyint(*keyint); err != nil {
+			zap.S().Fatalf("Invalid -keyint: %v", err)
+		}
+	}
+	if _, err := forceKeyframesArgs(*forceKeyframes, &svtav1Params{}); err != nil {
+		zap.S().Fatalf("Invalid -force-keyframes: %v", err)
+	}
+
+	if !slices.Contains([]string{"", decodeCheckSource, decodeCheckOutput, decodeCheckBoth}, *decodeCheck) {
+		zap.S().Fatalf("Invalid -decode-check %q, must be source, output or both", *decodeCheck)
+	}
+
+	if *thermalSensor != "" {
+		if *thermalResume >= *thermalMax {
+			zap.S().Fatalf("-thermal-resume (%.1f) must be below -thermal-max (%.1f)", *thermalResume, *thermalMax)
+		}
+		if _, err := readThermalSensor(*thermalSensor); err != nil {
+			zap.S().Fatalf("Invalid -thermal-sensor: %v", err)
+		}
+	}
+	if *encodeMode != modeQuality && *encodeMode != modePreview {
+		zap.S().Fatalf("Invalid -mode %q, must be quality or preview", *encodeMode)
+	}
+	if *upgradePreviews && *encodeMode == modePreview {
+		zap.S().Fatalf("-upgrade-previews replaces previews with quality encodes and can't be combined with -mode preview")
+	}
+	if *crf < 0 || *crf > 63 {
+		zap.S().Fatalf("Invalid -crf %d, must be between 0 and 63", *crf)
+	}
+	if *adaptiveCRFMax < 0 || *adaptiveCRFMax > 63 {
+		zap.S().Fatalf("-adaptive-crf-range must be between 0 and 63")
+	}
+	if *masterCRF < 0 || *masterCRF > 63 {
+		zap.S().Fatalf("-master-crf must be between 1 and 63, or 0 to disable")
+	}
+	if *masterCRF > 0 && (*encodeMode != modeQuality || *upgradePreviews) {
+		zap.S().Fatalf("-master-crf can't be combined with -mode preview or -upgrade-previews")
+	}
+	if *sampleDuration > 0 && activeMode() == modeMaster {
+		zap.S().Fatalf("-sample-duration can't be combined with -master-crf")
+	}
+	if *encodeTimeout < 0 {
+		zap.S().Fatalf("-timeout must not be negative")
+	}
+	if *maxRetries < 0 {
+		zap.S().Fatalf("-max-retries must not be negative")
+	}
+	if *maxProbeFailures < 1 {
+		zap.S().Fatalf("-max-probe-failures must be at least 1")
+	}
+	if *watch {
+		if info, err := os.Stat(flag.Arg(0)); err != nil || !info.IsDir() {
+			zap.S().Fatalf("-watch requires the input to be a directory")
+		}
+		if *watchSettle <= 0 {
+			zap.S().Fatalf("-watch-settle must be positive")
+		}
+	}
+	if *sidecarFormat != "" && *sidecarFormat != sidecarJSON && *sidecarFormat != sidecarNFO {
+		zap.S().Fatalf("Invalid -sidecar %q, must be json or nfo", *sidecarFormat)
+	}
+	if *reportBy != reportBySize && *reportBy != reportByBitrate {
+		zap.S().Fatalf("Invalid -report-by %q, must be size or bitrate", *reportBy)
+	}
+	if *preferChannels != "" && *preferChannels != preferMostChannels && *preferChannels != preferFewestChannels {
+		zap.S().Fatalf("Invalid -prefer-channels %q, must be most or fewest", *preferChannels)
+	}
+	for name, globs := range map[string]string{"-force-hdr": *forceHDRGlobs, "-force-sdr": *forceSDRGlobs} {
+		if err := validateGlobs(globs); err != nil {
+			zap.S().Fatalf("Invalid %s: %v", name, err)
+		}
+	}
+	if err := audioEncodingFromFlags().validate(); err != nil {
+		zap.S().Fatalf("Invalid audio encoding: %v", err)
+	}
+	if _, err := parseAudioTracks(*audioTracks); err != nil {
+		zap.S().Fatalf("Invalid -audio-tracks: %v", err)
+	}
+	if err := validateOutputContainer(outputExtension(), *audioCodec); err != nil {
+		zap.S().Fatalf("Invalid -output-ext: %v", err)
+	}
+	for _, warning := range containerWarnings(containerFor(outputExtension())) {
+		zap.S().Warnf("-output-ext %s: %s", outputExtension(), warning)
+	}
+	if err := validateSubtitleMode(*subtitleMode); err != nil {
+		zap.S().Fatalf("Invalid -subtitle-mode: %v", err)
+	}
+	if err := validateOverwriteFinal(*overwriteFinal); err != nil {
+		zap.S().Fatalf("Invalid -overwrite-final: %v", err)
+	}
+	if err := fsutil.ValidateExcludes(*excludeGlobs); err != nil {
+		zap.S().Fatalf("Invalid -exclude: %v", err)
+	}
+	if *mapExpr != "" {
+		if _, err := parseMapExpr(*mapExpr); err != nil {
+			zap.S().Fatalf("Invalid -map-expr: %v", err)
+		}
+	}
+
+	cores := runtime.NumCPU()
+	maxJobs, autoJobs, err := parseJobs(*jobs, cores)
+	if err != nil {
+		zap.S().Fatalf("Invalid -jobs: %v", err)
+	}
+	// auto divides the cores among the most encodes that may run at once
+	videoThreadCount, err = resolveVideoThreads(*videoThreads, cores, maxJobs)
+	if err != nil {
+		zap.S().Fatalf("Invalid -video-threads: %v", err)
+	}
+	if *audioThreads < 0 {
+		zap.S().Fatalf("-audio-threads must not be negative")
+	}
+	if videoThreadCount > 0 {
+		zap.S().Infof("Using %d SVT-AV1 threads per encode (%d cores, up to %d concurrent encodes)", videoThreadCount, cores, maxJobs)
+	}
+
+	ffmpegutil.ThoroughAnalyzeDuration = *probeAnalyzeDuration
+	ffmpegutil.ThoroughProbeSize = *probeSize
+
 	fmt.Printf("Using docker image %q\n", *dockerImage)
 
-	inDir := flag.Arg(0)
+	input := flag.Arg(0)
+	inDir := fsutil.InputBaseDir(input)
+	if inputRoot, err = filepath.Abs(inDir); err != nil {
+		zap.S().Fatalf("Error resolving input: %v", err)
+	}
+	outDir := inDir
+	if *outputDir != "" {
+		if *outputDir, err = filepath.Abs(*outputDir); err != nil {
+			zap.S().Fatalf("Error resolving -output-dir: %v", err)
+		}
+		if err := os.MkdirAll(*outputDir, 0755); err != nil {
+			zap.S().Fatalf("Error creating -output-dir: %v", err)
+		}
+		outDir = *outputDir
+	}
 
-	zap.S().Infof("Input directory: %s\n", inDir)
+	zap.S().Infof("Input: %s\n", input)
 
 	logFile := flags.LogFilePath()
 
@@ -61,101 +421,385 @@ func main() {
 		zap.S().Fatalf("Error creating log directory: %v", err)
 	}
 
-	matches, err := fsutil.MediaInDir(inDir)
+	matches, err := fsutil.MediaForInput(input, *excludeGlobs...)
 	if err != nil {
-		zap.S().Fatalf("Error listing input directory: %v", err)
+		zap.S().Fatalf("Error listing input: %v", err)
 	}
 
 	zap.S().Infof("Found %d video files\n", len(matches))
 
-	// refresh the transcode log every minute from disk. This should do a reasonably good job of catching new entries.
-	type tlogDictKey struct {
-		InputPath  string
-		OutputPath string
+	if *estimateTotal {
+		runEstimateTotal(matches, logFile)
+		return
+	}
+	if *reportCandidates > 0 {
+		runReportCandidates(matches, logFile, *reportCandidates, *reportBy)
+		return
 	}
+
+	// outputs are written alongside the inputs or under -output-dir, fail fast rather than failing every file if
+	// that isn't possible
+	if err := fsutil.CheckWritable(outDir); err != nil {
+		zap.S().Fatalf("Output directory %q is not writable, check the mount and permissions: %v", outDir, err)
+	}
+
+	// Ctrl-C or SIGTERM stops starting new files and interrupts running encodes, which are not recorded in the log
+	ctx, stopShutdown := notifyShutdown()
+	defer stopShutdown()
+
+	if *onlyMissingAudioLang != "" {
+		if *dryRun {
+			zap.S().Fatalf("-dry-run isn't supported with -only-missing-audio-lang")
+		}
+		runAddMissingAudio(ctx, matches, *onlyMissingAudioLang, logFile)
+		return
+	}
+
+	var versionCmdPrefix []string
+	if *dockerImage != "" {
+		versionCmdPrefix = []string{"docker", "run", "--rm", *dockerImage}
+	}
+	encoderVersions, err = ffmpegutil.DetectVersions(versionCmdPrefix)
+	if err != nil {
+		zap.S().Warnf("Error detecting encoder versions, they won't be recorded in the log: %v", err)
+	}
+	zap.S().Infof("Using ffmpeg %s, SVT-AV1 %s", encoderVersions.FFmpeg, encoderVersions.SvtAv1)
+
+	// refresh the transcode log every minute from disk. This should do a reasonably good job of catching new entries.
 	lastTranscodeLogUpdate := time.Time{}
-	transcodeLogDict := make(map[tlogDictKey]encodelog.LogFileEntry)
+	transcodeLogDict := make(map[encodelog.Key]encodelog.LogFileEntry)
 
 	refreshTranscodeLog := func() {
 		if time.Since(lastTranscodeLogUpdate) > 60*time.Second {
 			zap.S().Infof("Refreshing transcode log")
-			updated, err := encodelog.ReadLog(logFile)
+			index, err := encodelog.ScanIndex(logFile)
 			if err != nil {
 				zap.S().Warnf("Error reading transcode log: %v", err)
 				return
 			}
-			for _, entry := range updated {
-				key := tlogDictKey{
-					InputPath:  entry.InputPath,
-					OutputPath: entry.OutputPath,
-				}
-				transcodeLogDict[key] = entry
-			}
+			transcodeLogDict = index
 			zap.S().Infof("Refreshed transcode log, loaded %d entries", len(transcodeLogDict))
 			lastTranscodeLogUpdate = time.Now()
 		}
 	}
 
-	for _, match := range matches {
+	// workers look up and refresh the log concurrently
+	var transcodeLogMu sync.Mutex
+	lookupTranscodeLog := func(key encodelog.Key) (encodelog.LogFileEntry, bool) {
+		transcodeLogMu.Lock()
+		defer transcodeLogMu.Unlock()
+		refreshTranscodeLog()
+		entry, ok := transcodeLogDict[key]
+		return entry, ok
+	}
+
+	if n, err := newLockSet().Reclaim(); err != nil {
+		zap.S().Warnf("Error reclaiming stale transcode locks: %v", err)
+	} else if n > 0 {
+		zap.S().Infof("Reclaimed %d stale transcode locks", n)
+	}
+
+	// a checkpoint of the queue position is kept next to the log so that -resume can skip ahead after a crash
+	checkpointFile := checkpointPath(logFile)
+	inputAbs, err := filepath.Abs(input)
+	if err != nil {
+		zap.S().Fatalf("Error resolving input: %v", err)
+	}
+	start := 0
+	if *resume {
+		cp, ok, err := readCheckpoint(checkpointFile)
+		if err != nil {
+			zap.S().Fatalf("Error reading checkpoint %q: %v", checkpointFile, err)
+		}
+		if ok {
+			start = resumeIndex(cp, inputAbs, matches)
+			zap.S().Infof("Resuming after %q, skipping %d of %d files\n", cp.Path, start, len(matches))
+		} else {
+			zap.S().Infof("No checkpoint found, starting from the first file\n")
+		}
+	}
+
+	if *metricsAddr != "" {
+		ln, err := net.Listen("tcp", *metricsAddr)
+		if err != nil {
+			zap.S().Fatalf("Error listening on -metrics-addr: %v", err)
+		}
+		zap.S().Infof("Serving metrics at http://%s/metrics", ln.Addr())
+		go func() {
+			if err := metrics.Serve(ln); err != nil {
+				zap.S().Errorf("Metrics server stopped: %v", err)
+			}
+		}()
+	}
+
+	var controller *jobsController
+	if autoJobs {
+		controller = newJobsController(maxJobs)
+	}
+	pool := newJobPool(maxJobs, controller)
+
+	processMatch := func(match string, growth fsutil.Growth) {
+		if ctx.Err() != nil {
+			return
+		}
+
 		// resolve absolute paths
 		match, err := filepath.Abs(match)
 		if err != nil {
 			fmt.Printf("Error resolving absolute path: %v\n", err)
+			summary.Failed()
 			return
 		}
 
 		// skip files that are already encoded
-		if isEncodedFile(match) {
-			continue
+		if isEncodedFile(match) || inOutputTree(match) {
+			return
 		}
 
 		outfile := deriveFilename(match)
 		zap.S().Infof("Item %q", match)
 
-		// skip previously transcoded files
-		refreshTranscodeLog()
-		found, ok := transcodeLogDict[tlogDictKey{
+		// skip previously transcoded files, including those encoded beside the source before -output-dir was used
+		found, ok := lookupTranscodeLog(encodelog.Key{
 			InputPath:  match,
 			OutputPath: outfile,
-		}]
-		if ok {
+		})
+		if beside := besideFilename(match); !ok && beside != outfile {
+			found, ok = lookupTranscodeLog(encodelog.Key{
+				InputPath:  match,
+				OutputPath: beside,
+			})
+		}
+		if ok && found.ProbeFailures > 0 && !found.Retry {
+			if info, err := os.Stat(match); err == nil && !sameSourceFile(info, found) {
+				zap.S().Infof("Item %q previously failed to probe but has changed since, examining again\n", match)
+				ok = false
+			}
+		}
+		upgradingPreview := ok && *upgradePreviews && found.Mode == modePreview && found.Error == "" && found.Skipped == ""
+		if upgradingPreview {
+			zap.S().Infof("Item %q only has a preview encode, encoding it again at quality\n", match)
+		} else if ok && found.Retry {
+			zap.S().Infof("Item %q was previously deferred, examining again\n", match)
+		} else if ok {
 			if found.Error != "" {
 				zap.S().Infof("Item %q was previously attempted but failed, skipping: %s\n", match, found.Error)
-				continue
+				summary.AlreadyDone()
+				return
 			}
 			if found.Skipped != "" {
 				zap.S().Infof("Item %q was previously skipped: %s\n", match, found.Skipped)
-				continue
+				summary.AlreadyDone()
+				return
 			}
 			if found.Duration != "" {
 				zap.S().Infof("Item %q was previously transcoded: took %s\n", match, found.Duration)
-				continue
+				summary.AlreadyDone()
+				return
 			}
 			zap.S().Infof("Item %q was previously transcoded, skipping\n", match)
-			continue
+			summary.AlreadyDone()
+			return
+		}
+
+		// an output left beside the source by a run without -output-dir counts as an existing output
+		if beside := besideFilename(match); beside != outfile && fileExists(beside) && finalOverwritePolicy() == overwriteNever {
+			zap.S().Infof("Item %q already has an output beside it %q, skipping\n", match, beside)
+			recordSkip(logFile, match, outfile, "output exists beside the source", false)
+			return
+		}
+
+		// skip files a downloader is still writing, which leave a marker such as movie.mkv.part next to them
+		if marker, ok := fsutil.PartialDownloadMarker(match); ok {
+			zap.S().Infof("Item %q is still downloading, found %q, skipping\n", match, filepath.Base(marker))
+			recordSkip(logFile, match, outfile, "partial download", true)
+			return
+		}
+
+		// skip files that may still be written to e.g. by a downloader, or that are within the retention period
+		if *minAge > 0 || *minSourceAge > 0 {
+			info, err := os.Stat(match)
+			if err != nil {
+				zap.S().Errorf("Item %q stat error: %v\n", match, err)
+				summary.Failed()
+				return
+			}
+			age := time.Since(info.ModTime())
+			if age < *minAge {
+				zap.S().Infof("Item %q was modified %s ago, skipping until it is older than %s\n", match, age.Round(time.Second), *minAge)
+				recordSkip(logFile, match, outfile, fmt.Sprintf("modified within %s", *minAge), true)
+				return
+			}
+			if age < *minSourceAge {
+				zap.S().Infof("Item %q is %s old, keeping it pristine until it is older than %s\n", match, age.Round(time.Second), *minSourceAge)
+				recordSkip(logFile, match, outfile, fmt.Sprintf("source younger than retention period %s", *minSourceAge), true)
+				return
+			}
+		}
+
+		// skip files that are actively being appended to e.g. live recordings, more reliable than -min-age for DVRs
+		if *growthCheck > 0 {
+			growing, err := growth.IsGrowing(match)
+			if err != nil {
+				zap.S().Errorf("Item %q stat error: %v\n", match, err)
+				summary.Failed()
+				return
+			}
+			if growing {
+				zap.S().Infof("Item %q is still growing, skipping until the recording finishes\n", match)
+				recordSkip(logFile, match, outfile, "still recording", true)
+				return
+			}
 		}
 
 		// examine whether we should encode the file or not
 		ffprobeData, err := ffmpegutil.GetFfprobeInfo(match)
 		if err != nil {
 			zap.S().Errorf("Item %q ffprobe error: %v\n", match, err)
-			continue
+			var previous *encodelog.LogFileEntry
+			if ok {
+				previous = &found
+			}
+			recordProbeFailure(logFile, match, outfile, previous, err)
+			return
+		}
+		if !ffprobeData.HasRealVideo() {
+			zap.S().Infof("Item %q has no video stream other than cover art, skipping\n", match)
+			recordSkip(logFile, match, outfile, "no video stream, only cover art or audio", false)
+			return
+		}
+		if duration := ffprobeData.GetDurationSeconds(); *minDuration > 0 && duration > 0 && duration < minDuration.Seconds() {
+			zap.S().Infof("Item %q is only %.1fs long, skipping files shorter than %s\n", match, duration, *minDuration)
+			recordSkip(logFile, match, outfile, fmt.Sprintf("shorter than %s (%.1fs)", *minDuration, duration), false)
+			return
+		}
+		if ffprobeData.DolbyVisionProfile() == 5 && !dolbyVisionPreserved() {
+			zap.S().Warnf("Item %q is Dolby Vision profile 5 which has no HDR10 base layer, its colors would be wrong without the Dolby Vision metadata, skipping\n", match)
+			recordSkip(logFile, match, outfile, "Dolby Vision profile 5 can't be preserved, see -dolby-vision", false)
+			return
+		}
+		if ffprobeData.VideoCodec() == "av1" && !*reencodeAV1 {
+			zap.S().Infof("Item %q is already AV1, skipping\n", match)
+			recordSkip(logFile, match, outfile, "already AV1", false)
+			return
 		}
 		if ffprobeData.GetBitrateBPS() < lowBitrateThreshold {
 			zap.S().Infof("Item %q is already low bitrate (%d bps), skipping\n", match, ffprobeData.GetBitrateBPS())
-			encodelog.AppendLog(logFile, encodelog.LogFileEntry{
-				InputPath:  match,
-				OutputPath: outfile,
-				Skipped:    fmt.Sprintf("already low bitrate (%d bps)", ffprobeData.GetBitrateBPS()),
-			})
-			continue
+			recordSkip(logFile, match, outfile, fmt.Sprintf("already low bitrate (%d bps)", ffprobeData.GetBitrateBPS()), false)
+			return
+		}
+
+		if *minBPP > 0 {
+			if bpp := ffprobeData.GetBitsPerPixel(); bpp > 0 && bpp < *minBPP {
+				zap.S().Infof("Item %q is already efficiently encoded (%.3f bits per pixel), skipping\n", match, bpp)
+				recordSkip(logFile, match, outfile, fmt.Sprintf("already efficient (%.3f bits per pixel)", bpp), false)
+				return
+			}
+		}
+
+		// optionally verify that the source decodes cleanly before spending hours encoding it
+		if *decodeCheck == decodeCheckSource || *decodeCheck == decodeCheckBoth {
+			errCount, err := ffmpegutil.CountDecodeErrors(match)
+			if err != nil {
+				zap.S().Errorf("Item %q decode check error: %v\n", match, err)
+				summary.Failed()
+				return
+			}
+			if errCount > *maxDecodeErrors {
+				zap.S().Warnf("Item %q has %d decode errors, skipping\n", match, errCount)
+				recordSkip(logFile, match, outfile, fmt.Sprintf("%d decode errors in source", errCount), false)
+				return
+			}
 		}
 
 		zap.S().Infof("Item %q is high bitrate (%d bps), encoding it to AV1\n", match, ffprobeData.GetBitrateBPS())
-		transcodeMatch(ffprobeData, match, outfile)
+		if *dryRun {
+			dryRunMatch(ffprobeData, match, outfile, upgradingPreview)
+			return
+		}
+		waitForCooldown(ctx)
+		if ctx.Err() != nil {
+			return
+		}
+		pool.StartEncode()
+		encoded := transcodeMatch(ctx, ffprobeData, match, outfile, upgradingPreview, growth)
+		pool.FinishEncode(ffprobeData.GetDurationSeconds(), encoded)
+	}
+
+	growth := checkGrowth(matches[start:])
+	progress := newQueueProgress(len(matches), start)
+	var checkpointMu sync.Mutex
+	var wg sync.WaitGroup
+	for idx := start; idx < len(matches); idx++ {
+		pool.Acquire()
+		if ctx.Err() != nil {
+			pool.Release()
+			break
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer pool.Release()
+			processMatch(matches[idx], growth)
+			if ctx.Err() != nil || *dryRun {
+				return
+			}
+
+			// every file up to here has been dealt with one way or another, record it as the resume point
+			checkpointMu.Lock()
+			defer checkpointMu.Unlock()
+			if last, ok := progress.Finish(idx); ok {
+				if err := writeCheckpoint(checkpointFile, checkpoint{Input: inputAbs, Index: last, Path: matches[last]}); err != nil {
+					zap.S().Warnf("Error writing checkpoint: %v", err)
+				}
+			}
+		}()
 	}
+	wg.Wait()
 
+	if ctx.Err() != nil {
+		printSummary()
+		zap.S().Warnf("Shut down gracefully, run again with -resume to continue from the checkpoint")
+		os.Exit(130)
+	}
+
+	if *dryRun {
+		// leave the checkpoint of an earlier real run alone
+	} else if err := os.Remove(checkpointFile); err != nil && !errors.Is(err, os.ErrNotExist) {
+		zap.S().Warnf("Error removing checkpoint: %v", err)
+	}
 	zap.S().Infof("All items processed")
+	printSummary()
+
+	if *watch {
+		// each batch of new files gets its own summary, the -metrics-addr metrics keep the totals. Batches run
+		// through the same pool as the initial walk so -jobs still applies.
+		processBatch := func(matches []string) {
+			if ctx.Err() != nil {
+				return
+			}
+			summary.Reset()
+			growth := checkGrowth(matches)
+			for _, match := range matches {
+				pool.Acquire()
+				if ctx.Err() != nil {
+					pool.Release()
+					break
+				}
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					defer pool.Release()
+					processMatch(match, growth)
+				}()
+			}
+			wg.Wait()
+			printSummary()
+		}
+		if err := watchDir(inDir, *watchSettle, processBatch, ctx.Done()); err != nil {
+			zap.S().Fatalf("Error watching %q: %v", inDir, err)
+		}
+	}
 }
 
 func init() {
@@ -166,14 +810,94 @@ func init() {
 	zap.ReplaceGlobals(consoleLogger)
 }
 
+// recordSkip appends a skip entry to the transcode log. Retryable skips are examined again on the next run.
+func recordSkip(logFile, infile, outfile, reason string, retry bool) {
+	summary.Skipped()
+	if *dryRun {
+		zap.S().Infof("Item %q dry run, would record skip: %s\n", infile, reason)
+		return
+	}
+	if sampling() {
+		return
+	}
+	if err := encodelog.AppendLog(logFile, encodelog.LogFileEntry{
+		InputPath:  infile,
+		OutputPath: outfile,
+		StartTime:  time.Now().Format(time.RFC3339),
+		Skipped:    reason,
+		Retry:      retry,
+	}); err != nil {
+		zap.S().Warnf("Log write error %q: %v", infile, err)
+	}
+}
+
+// deriveFilename returns the output path of a source, beside it or mirrored under -output-dir.
 func deriveFilename(inFile string) string {
+	return mirroredPath(besideFilename(inFile))
+}
+
+// besideFilename returns the output path of a source in its own directory.
+func besideFilename(inFile string) string {
 	ext := filepath.Ext(inFile)
 	inFile = strings.TrimSuffix(inFile, ext)
-	return fmt.Sprintf("%s-svtav1enc.mkv", inFile)
+	if activeMode() == modeMaster {
+		return fmt.Sprintf("%s-svtav1master%s", inFile, outputExtension())
+	}
+	if sampling() {
+		return fmt.Sprintf("%s-svtav1enc%s%s", inFile, sampleInfix, outputExtension())
+	}
+	return fmt.Sprintf("%s-svtav1enc%s", inFile, outputExtension())
+}
+
+// tempFilename returns the name ffmpeg writes to before the output is renamed into place. It keeps the output's
+// extension so that the muxer ffmpeg picks from the name matches the final container. Depending on -temp-location
+// the file is hidden from media scanners by a leading dot or by placing it in a hidden subdirectory.
+func tempFilename(outFile string) string {
+	dir, base := filepath.Split(outFile)
+	name := base + tempSuffix + filepath.Ext(outFile)
+	switch *tempLocation {
+	case tempHidden:
+		return filepath.Join(dir, "."+name)
+	case tempSubdir:
+		return filepath.Join(dir, tempSubdirName, name)
+	default:
+		return filepath.Join(dir, name)
+	}
+}
+
+// checkGrowth samples matches for -growth-check, and the temp files left by earlier encodes of them, all at once
+// so that a run waits once rather than once per file, and never while holding an encode lock.
+func checkGrowth(matches []string) fsutil.Growth {
+	var paths []string
+	var interval time.Duration
+	for _, match := range matches {
+		match, err := filepath.Abs(match)
+		if err != nil || isEncodedFile(match) || inOutputTree(match) {
+			continue
+		}
+		if *growthCheck > 0 {
+			paths = append(paths, match)
+			interval = max(interval, *growthCheck)
+		}
+		if *dryRun || !*overwriteTemp {
+			continue // the temp file is left alone
+		}
+		if tmpfile := tempFilename(deriveFilename(match)); fileExists(tmpfile) {
+			paths = append(paths, tmpfile)
+			interval = max(interval, tempGrowthInterval)
+		}
+	}
+	if len(paths) > 0 {
+		zap.S().Infof("Checking %d file(s) for writes over %s", len(paths), interval)
+	}
+	return fsutil.CheckGrowth(paths, interval)
 }
 
 func isEncodedFile(filename string) bool {
-	for _, suffix := range encoderSuffixes {
+	if strings.HasSuffix(strings.TrimSuffix(filename, filepath.Ext(filename)), tempSuffix) {
+		return true
+	}
+	for _, suffix := range encodedSuffixes() {
 		if strings.HasSuffix(filename, suffix) {
 			return true
 		}
@@ -181,49 +905,108 @@ func isEncodedFile(filename string) bool {
 	return false
 }
 
-func transcodeMatch(probeData ffmpegutil.ProbeData, infile, outfile string) {
-	// Check if the output file already exists
-	if _, err := os.Stat(outfile); err == nil {
-		zap.S().Warnf("Outfile for item %q already exists, skipping\n", infile)
-		return
-	}
-
-	namedLockSet := &lockutil.NamedLockSet{File: os.TempDir() + "/gtranscoder.lockset"}
+// transcodeMatch encodes infile to outfile and reports whether it did. What happens to an existing outfile or
+// temp file is decided by planOverwrite, an outfile is always replaced if replacePreview is set. Cancelling ctx
+// interrupts the encode, which is then discarded without a log entry so that it is attempted again on the next run.
+func transcodeMatch(ctx context.Context, probeData ffmpegutil.ProbeData, infile, outfile string, replacePreview bool, growth fsutil.Growth) bool {
+	namedLockSet := newLockSet()
 	if err := namedLockSet.TryAcquire(infile); err != nil {
 		if errors.Is(err, lockutil.ErrLockAlreadyHeld) {
 			fmt.Printf("Item %q already transcoding by another proces: %v\n", infile, err)
-			return
+			summary.Skipped()
+			return false
 		}
 		fmt.Printf("Item %q failed to acquire lock unknown error: %v\n", infile, err)
-		return
+		summary.Failed()
+		return false
 	}
 	defer namedLockSet.Release(infile)
+	defer forgetAutocrop(infile)
 
-	if _, err := os.Stat(outfile); err == nil {
-		fmt.Printf("Item %q already transcoded\n", infile)
-		return
+	// Check for an existing output and temp file under the lock so another transcoder can't be writing them. The
+	// output has no log entry or it wouldn't have been considered.
+	tmpfile := tempFilename(outfile)
+	plan := planOverwriteFor(outfile, tmpfile, replacePreview)
+	if plan.Skip != "" {
+		zap.S().Warnf("Item %q skipping: %s\n", infile, plan.Skip)
+		recordSkip(flags.LogFilePath(), infile, outfile, plan.Skip, plan.SkipRetry)
+		return false
+	}
+	if plan.VerifyFinal {
+		if err := verifyExistingOutput(probeData, infile, outfile); err != nil {
+			zap.S().Warnf("Outfile for item %q already exists but failed verification, encoding it again: %v\n", infile, err)
+		} else {
+			zap.S().Infof("Outfile for item %q already exists and passed verification, skipping\n", infile)
+			recordSkip(flags.LogFilePath(), infile, outfile, "output exists, verified", false)
+			return false
+		}
+	}
+	if plan.RemoveTemp {
+		// a tool outside the lock set may still be writing it, leave it alone until it stops changing
+		if growing, err := growth.IsGrowing(tmpfile); err == nil && growing {
+			zap.S().Warnf("Item %q temp file %q is still being written by another process, skipping\n", infile, tmpfile)
+			recordSkip(flags.LogFilePath(), infile, outfile, "temp file is being written", true)
+			return false
+		}
+		zap.S().Infof("Item %q removing stale temp file %q\n", infile, tmpfile)
+		if err := os.Remove(tmpfile); err != nil && !errors.Is(err, os.ErrNotExist) {
+			fmt.Printf("Item %q error removing stale temp file: %v\n", infile, err)
+			summary.Failed()
+			return false
+		}
 	}
 
 	if err := os.MkdirAll(filepath.Dir(outfile), 0755); err != nil {
+		if fsutil.IsWriteDenied(err) {
+			zap.S().Errorf("Item %q output directory is not writable, skipping: %v\n", infile, err)
+			recordSkip(flags.LogFilePath(), infile, outfile, fmt.Sprintf("output not writable: %v", err), false)
+			return false
+		}
 		fmt.Printf("Item %q error: %v\n", infile, err)
-		return
+		summary.Failed()
+		return false
 	}
 
-	args, err := createFfmpegCommand(probeData, infile, outfile+".transcode.mkv")
+	if err := os.MkdirAll(filepath.Dir(tmpfile), 0755); err != nil {
+		fmt.Printf("Item %q error creating temp directory: %v\n", infile, err)
+		summary.Failed()
+		return false
+	}
+	if *tempLocation == tempSubdir {
+		defer os.Remove(filepath.Dir(tmpfile)) // only succeeds once the temp directory is empty
+	}
+	var pass encodePass
+	if twoPassEnabled() {
+		statsDir, err := createStatsDir(tmpfile)
+		if err != nil {
+			fmt.Printf("Item %q error creating two-pass stats directory: %v\n", infile, err)
+			summary.Failed()
+			return false
+		}
+		defer os.RemoveAll(statsDir)
+		pass = encodePass{Pass: 2, StatsDir: statsDir}
+	}
+	args, decisions, err := createFfmpegPassCommand(probeData, infile, tmpfile, pass)
 	if err != nil {
 		if errors.Is(err, errSkip) {
-			return
+			return false
+		}
+		if fsutil.IsWriteDenied(err) {
+			zap.S().Errorf("Item %q output is not writable, skipping: %v\n", infile, err)
+			recordSkip(flags.LogFilePath(), infile, outfile, fmt.Sprintf("output not writable: %v", err), false)
+			return false
 		}
 		fmt.Printf("Item %q error forming ffmpeg command: %v\n", infile, err)
-		return
+		summary.Failed()
+		return false
 	}
 
+	for _, decision := range decisions {
+		zap.S().Infof("Item %q stream %s\n", infile, decision)
+	}
 	zap.S().Infof("Item %q command: %s\n", infile, strings.Join(args, " "))
 
 	startTime := time.Now()
-	cmd := exec.Command(args[0], args[1:]...)
-	cmd.Stdout = os.Stdout
-	cmd.Stderr = os.Stderr
 
 	baseLog := encodelog.LogFileEntry{
 		InputPath:  infile,
@@ -231,134 +1014,427 @@ func transcodeMatch(probeData ffmpegutil.ProbeData, infile, outfile string) {
 		StartTime:  time.Now().Format(time.RFC3339),
 		Duration:   "0s",
 		Args:       args,
+		Decisions:  decisions,
+
+		FFmpegVersion: encoderVersions.FFmpeg,
+		SvtAv1Version: encoderVersions.SvtAv1,
+	}
+	if mode := activeMode(); mode != modeQuality {
+		baseLog.Mode = mode
+	}
+	baseLog.TwoPass = twoPassEnabled()
+	if crop, ok := appliedCrop(probeData, infile); ok {
+		baseLog.Crop = crop.Filter()
 	}
 
-	if err := cmd.Run(); err != nil {
+	metrics.EncodesInFlight.Inc()
+	for attempt := 1; ; attempt++ {
+		err = withEncodeTimeout(ctx, *encodeTimeout, func(ctx context.Context) error {
+			if twoPassEnabled() {
+				if err := runAnalysisPass(ctx, probeData, infile, tmpfile, pass.StatsDir); err != nil {
+					return err
+				}
+			}
+			return runEncoder(ctx, infile, args, encodedSeconds(probeData))
+		})
+		if *maxRetries > 0 {
+			baseLog.Attempts = attempt
+		}
+		if err == nil || ctx.Err() != nil || attempt > *maxRetries || !transientFailure(err) {
+			break
+		}
+		delay := retryDelay(attempt)
+		zap.S().Warnf("Item %q encode failed with a transient error, retrying in %s (retry %d of %d): %v\n", infile, delay, attempt, *maxRetries, err)
+		select {
+		case <-ctx.Done():
+		case <-time.After(delay):
+		}
+	}
+	metrics.EncodesInFlight.Dec()
+	if err != nil && ctx.Err() != nil {
+		zap.S().Warnf("Item %q encode interrupted by shutdown, removing partial output %q\n", infile, tmpfile)
+		if err := os.Remove(tmpfile); err != nil && !errors.Is(err, os.ErrNotExist) {
+			fmt.Printf("Item %q failure cleanup error: %v\n", infile, err)
+		}
+		return false
+	} else if err != nil {
 		fmt.Printf("Item %q error: %v\n", infile, err)
 		baseLog.Error = err.Error()
 		baseLog.Duration = time.Since(startTime).String()
-		if err := encodelog.AppendLog(flags.LogFilePath(), baseLog); err != nil {
-			fmt.Printf("Log write error %q: %v\n", infile, err)
-		}
+		appendEncodeLog(flags.LogFilePath(), baseLog)
 
-		if err := os.Remove(outfile + ".transcode.mkv"); err != nil {
+		if err := os.Remove(tmpfile); err != nil {
 			fmt.Printf("Item %q failure cleanup error: %v\n", infile, err)
 		}
-		return
+		summary.Failed()
+		return false
 	} else {
 		fmt.Printf("Item %q transcoded\n", infile)
 		baseLog.Duration = time.Since(startTime).String()
-		if err := encodelog.AppendLog(flags.LogFilePath(), baseLog); err != nil {
-			fmt.Printf("Log write error %q: %v\n", infile, err)
+
+		if err := verifyEncode(&baseLog, probeData, infile, tmpfile); err != nil {
+			zap.S().Errorf("Item %q failed verification, keeping the original: %v\n", infile, err)
+			baseLog.Error = err.Error()
+			appendEncodeLog(flags.LogFilePath(), baseLog)
+			if err := os.Remove(tmpfile); err != nil {
+				fmt.Printf("Item %q failure cleanup error: %v\n", infile, err)
+			}
+			summary.Failed()
+			return false
 		}
+
+		recordSizes(&baseLog, infile, tmpfile)
+		appendEncodeLog(flags.LogFilePath(), baseLog)
 	}
 
-	if err := os.Rename(outfile+".transcode.mkv", outfile); err != nil {
+	if err := os.Rename(tmpfile, outfile); err != nil {
 		fmt.Printf("Item %q error: %v\n", infile, err)
+		summary.Failed()
+		return false
+	}
+	summary.Encoded(baseLog.InputSizeBytes, baseLog.OutputSizeBytes)
+	metrics.EncodeDuration.Observe(time.Since(startTime).Seconds())
+
+	if *sidecarFormat != "" {
+		if err := writeSidecar(*sidecarFormat, outfile); err != nil {
+			zap.S().Warnf("Item %q error writing sidecar: %v", infile, err)
+		}
+	}
+	if !sampling() {
+		copySidecarFiles(infile, outfile)
 	}
+	return true
 }
 
-func createFfmpegCommand(probeData ffmpegutil.ProbeData, videoFileName string, outputFileName string) ([]string, error) {
+// newLockSet returns the lock set shared by every transcoder process on the machine.
+func newLockSet() *lockutil.NamedLockSet {
+	return &lockutil.NamedLockSet{File: os.TempDir() + "/gtranscoder.lockset", MaxAge: *lockMaxAge}
+}
+
+// recordSizes records the sizes of the source and the encoded output on the log entry and logs the space saved.
+// Sizes that can't be read are left unset.
+func recordSizes(entry *encodelog.LogFileEntry, infile, tmpfile string) {
+	inInfo, inErr := os.Stat(infile)
+	outInfo, outErr := os.Stat(tmpfile)
+	if inErr != nil || outErr != nil {
+		zap.S().Warnf("Item %q error reading file sizes: %v", infile, errors.Join(inErr, outErr))
+		return
+	}
+	entry.InputSizeBytes = inInfo.Size()
+	entry.OutputSizeBytes = outInfo.Size()
+	saved := entry.InputSizeBytes - entry.OutputSizeBytes
+	if entry.InputSizeBytes > 0 {
+		zap.S().Infof("Item %q saved %s (%.0f%%)", infile, fsutil.FormatBytes(saved), 100*float64(saved)/float64(entry.InputSizeBytes))
+	}
+}
+
+// runEncoder runs an ffmpeg command with its log on the console, logging its -progress output periodically.
+// totalSeconds is the duration of the source used to compute a percentage, 0 if unknown.
+func runEncoder(ctx context.Context, infile string, args []string, totalSeconds float64) error {
+	progress, progressWriter := io.Pipe()
+	reported := make(chan struct{})
+	go func() {
+		defer close(reported)
+		reportProgress(progress, infile, totalSeconds)
+		io.Copy(io.Discard, progress) // keep draining if parsing stopped early
+	}()
+
+	cmd := encoderCommand(ctx, args)
+	cmd.Stdout = progressWriter
+	stderrTail := &tailBuffer{max: stderrTailSize}
+	cmd.Stderr = io.MultiWriter(os.Stderr, stderrTail)
+	if *dockerImage == "" && len(*encodeEnv) > 0 {
+		cmd.Env = append(os.Environ(), *encodeEnv...)
+	}
+	err := cmd.Run()
+	progressWriter.Close()
+	<-reported
+	if err != nil {
+		return &encodeFailure{err: err, stderr: stderrTail.String()}
+	}
+	return nil
+}
+
+// runAnalysisPass runs the first pass of a -two-pass encode, writing its stats into statsDir.
+func runAnalysisPass(ctx context.Context, probeData ffmpegutil.ProbeData, infile, tmpfile, statsDir string) error {
+	args, _, err := createFfmpegPassCommand(probeData, infile, tmpfile, encodePass{Pass: 1, StatsDir: statsDir})
+	if err != nil {
+		return fmt.Errorf("forming analysis pass command: %w", err)
+	}
+	zap.S().Infof("Item %q analysis pass command: %s\n", infile, strings.Join(args, " "))
+	if err := runEncoder(ctx, infile, args, encodedSeconds(probeData)); err != nil {
+		return fmt.Errorf("analysis pass: %w", err)
+	}
+	return nil
+}
+
+func createFfmpegCommand(probeData ffmpegutil.ProbeData, videoFileName string, outputFileName string) ([]string, []encodelog.StreamDecision, error) {
+	return createFfmpegPassCommand(probeData, videoFileName, outputFileName, encodePass{})
+}
+
+// createFfmpegPassCommand is createFfmpegCommand for one pass of a -two-pass encode. The analysis pass only encodes
+// video and discards the output.
+func createFfmpegPassCommand(probeData ffmpegutil.ProbeData, videoFileName string, outputFileName string, pass encodePass) ([]string, []encodelog.StreamDecision, error) {
+	sourceFileName := videoFileName // videoFileName is replaced by the path inside the container in docker mode
 	args := []string{
 		"nice", "-n", "19",
 		"ffmpeg",
+		"-progress", "pipe:1", // machine readable progress on stdout, see reportProgress
 	}
+	statsDir := pass.StatsDir
 
 	if *dockerImage != "" {
 		// touch output file path
-		if err := os.MkdirAll(filepath.Dir(outputFileName), 0755); err != nil {
-			return nil, fmt.Errorf("failed to create output directory: %w", err)
-		}
-		if err := os.WriteFile(outputFileName, []byte{}, 0644); err != nil {
-			return nil, fmt.Errorf("failed to create output file: %w", err)
+		if !*dryRun {
+			if err := os.MkdirAll(filepath.Dir(outputFileName), 0755); err != nil {
+				return nil, nil, fmt.Errorf("failed to create output directory: %w", err)
+			}
+			if err := os.WriteFile(outputFileName, []byte{}, 0644); err != nil {
+				return nil, nil, fmt.Errorf("failed to create output file: %w", err)
+			}
 		}
 
 		newVideoFileName := "/input" + filepath.Ext(videoFileName)
 		newOutputFileName := "/output" + filepath.Ext(outputFileName)
 
-		dockerArgs := []string{
-			"docker", "run", "--rm", "--privileged",
-			"-v", videoFileName + ":" + newVideoFileName,
-			"-v", outputFileName + ":" + newOutputFileName,
+		mounts := []dockerMount{
+			{Host: videoFileName, Container: newVideoFileName},
+			{Host: outputFileName, Container: newOutputFileName, Writable: true},
 		}
-		if *dockerCpus != "" {
-			dockerArgs = append(dockerArgs, "--cpuset-cpus", fmt.Sprintf("%s", *dockerCpus))
+		if pass.StatsDir != "" {
+			mounts = append(mounts, dockerMount{Host: pass.StatsDir, Container: dockerStatsDir, Writable: true})
+			statsDir = dockerStatsDir
+		}
+		dockerArgs, err := dockerRunArgs(mounts)
+		if err != nil {
+			return nil, nil, err
 		}
-		dockerArgs = append(dockerArgs,
-			*dockerImage,
-		)
 		args = append(dockerArgs, args...)
 
 		videoFileName = newVideoFileName
 		outputFileName = newOutputFileName
 	}
 
+	args = append(args, encoderInputArgs(*encoder)...)
+	// probe the input as thoroughly as ffprobe did so that stream indices line up with the probe data
+	args = append(args, ffmpegutil.ThoroughProbeArgs(videoFileName)...)
 	args = append(args,
 		"-i", videoFileName,
 	)
+	args = append(args, sampleArgs()...)
 
 	// Step 1: encode video
 	// map the video stream
-	videoStream := probeData.GetVideoStream()
-	if videoStream == (ffmpegutil.StreamData{}) {
-		return nil, fmt.Errorf("no video stream")
+	videoStream := probeData.GetPrimaryVideoStream()
+	if !videoStream.IsVideo() {
+		return nil, nil, fmt.Errorf("no video stream")
 	}
 
-	targetMinRateBPS := scaleBitrateToResolution(bitrateTarget, videoStream.Width, videoStream.Height)
-	zap.S().Debugf("Target min bitrate scaled for resolution %dx%d: %d", videoStream.Width, videoStream.Height, targetMinRateBPS)
+	// anamorphic video is scaled by the size it is displayed at rather than its smaller coded size
+	displayWidth, displayHeight := videoStream.DisplayDimensions()
+	targetMinRateBPS := scaleBitrateToResolution(bitrateTarget, displayWidth, displayHeight)
+	zap.S().Debugf("Target min bitrate scaled for resolution %dx%d: %d", displayWidth, displayHeight, targetMinRateBPS)
 
-	// Documentation on SVTAV1 params https://gitlab.com/AOMediaCodec/SVT-AV1/-/blob/master/Docs/Ffmpeg.md#example-2-encoding-for-personal-use
-	args = append(args,
-		"-map", "0:v", "-c:v", "libsvtav1", "-crf", "24", "-preset", fmt.Sprintf("%d", *preset),
-	)
+	svtPreset, crfValue := encodeSettings(activeMode())
+	if mapped, ok := presetMap.presetFor(displayWidth, displayHeight); ok && activeMode() != modePreview {
+		zap.S().Debugf("Item %q using preset %d for %dx%d from -preset-map", sourceFileName, mapped, displayWidth, displayHeight)
+		svtPreset = mapped
+	}
+	if *adaptiveCRF && activeMode() == modeQuality {
+		crfValue = scaleCRFToResolution(crfValue, *adaptiveCRFMax, displayWidth, displayHeight)
+	}
+	zap.S().Infof("Item %q encoding with %s crf %d preset %d", sourceFileName, *encoder, crfValue, svtPreset)
 
-	if *preset <= 6 {
-		args = append(args, "-svtav1-params", "tune=0:film-grain=8") // optimized for subjective visual quality and will detect and add / film grain.
-	} else {
-		args = append(args, "-svtav1-params", "tune=0:film-grain=0") // optimized for subjective visual quality and do nothing with film grain.
+	var decisions []encodelog.StreamDecision
+
+	// Handle HDR settings
+	isHDR, hdrDecision, err := resolveDynamicRange(probeData, sourceFileName)
+	if err != nil {
+		return nil, nil, err
+	}
+	if hdrDecision != nil {
+		zap.S().Infof("Item %q %s", sourceFileName, hdrDecision.Reason)
+		decisions = append(decisions, *hdrDecision)
+	}
+	dynamicDecisions := dynamicHDRDecisions(probeData, isHDR)
+	for _, decision := range dynamicDecisions {
+		if decision.Action == "drop" {
+			zap.S().Warnf("Item %q %s", sourceFileName, decision.Reason)
+		}
+	}
+	decisions = append(decisions, dynamicDecisions...)
+
+	videoArgs, err := videoEncoderArgs(*encoder, videoSettings{
+		Preset:      svtPreset,
+		CRF:         crfValue,
+		HDR:         isHDR,
+		DolbyVision: isHDR && probeData.HasDolbyVision() && dolbyVisionPreserved(),
+		Pass:        pass,
+		StatsDir:    statsDir,
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	videoMaps, encodedVideos := videoMapArgs(probeData)
+	args = append(args, videoMaps...)
+	args = append(args, videoArgs...)
+
+	// cover art is stream copied after the encoded videos, the filters and pixel format then only apply to the latter
+	var coverArtArgs []string
+	if !pass.analysisOnly() {
+		var coverArtDecisions []encodelog.StreamDecision
+		coverArtArgs, coverArtDecisions = planCoverArt(probeData, *coverArt, outputFileName, encodedVideos)
+		decisions = append(decisions, coverArtDecisions...)
 	}
 
 	args = append(args,
 		"-minrate", fmt.Sprintf("%dk", targetMinRateBPS/1000),
 		"-bufsize", fmt.Sprintf("%dk", targetMinRateBPS/1000))
 
-	// Handle HDR settings
-	if probeData.HasHDR() {
+	// Video filters are collected into a single chain ordered by stage, see filterStage: deinterlacing, -autocrop and
+	// the anamorphic setsar fix up the geometry first, then -denoise and tonemapping, then -vf-extra, so that user
+	// filters see the picture as it is encoded. The hardware upload comes last and -pix_fmt is an output option,
+	// ffmpeg converts to it after the whole chain. The video is always encoded, never stream copied, so the chain
+	// always applies.
+	var filters FilterChain
+	denoiseArg, err := denoiseFilter(*denoise, *denoiseStrength)
+	if err != nil {
+		return nil, nil, err
+	}
+	filters.Add(stageDenoise, denoiseArg)
+	cropArg, cropDecision := autocropFilter(probeData, sourceFileName)
+	filters.Add(stageCrop, cropArg)
+	if cropDecision != nil {
+		decisions = append(decisions, *cropDecision)
+	}
+	if videoStream.IsAnamorphic() {
+		// pin the source's pixel shape so that the output isn't played squashed if a filter or encoder drops it
+		filters.Add(stageScale, "setsar="+strings.Replace(videoStream.SampleAspectRatio, ":", "/", 1))
+	}
+	filters.Add(stageExtra, strings.TrimSpace(*vfExtra))
+	depth := outputBitDepth(*bitDepth, videoStream.BitDepth(), isHDR)
+	if depth == 8 {
+		decisions = append(decisions, encodelog.StreamDecision{Stream: "0:v", Action: "encode", Reason: fmt.Sprintf("8 bit, source is %s", describeBitDepth(videoStream.BitDepth()))})
+	}
+	filters.Add(stageUpload, encoderUploadFilter(*encoder, depth))
+	if len(coverArtArgs) > 0 {
+		for outIdx := range encodedVideos {
+			args = append(args, filters.StreamArgs(fmt.Sprintf("v:%d", outIdx))...)
+		}
+	} else {
+		args = append(args, filters.Args()...)
+	}
+
+	if isHDR {
 		args = append(args,
 			"-colorspace", "bt2020nc",
 			"-color_primaries", "bt2020",
 			"-color_trc", "smpte2084",
 			"-strict", "experimental",
 		)
-	} else {
-		// Let's always encode in 10 bit color
-		args = append(args, "-pix_fmt", "yuv420p10le")
+	}
+	if pixFmt := encoderPixelFormat(*encoder, depth); pixFmt != "" && len(coverArtArgs) > 0 {
+		for outIdx := range encodedVideos {
+			args = append(args, fmt.Sprintf("-pix_fmt:v:%d", outIdx), pixFmt)
+		}
+	} else if pixFmt != "" {
+		args = append(args, "-pix_fmt", pixFmt)
 	}
 
-	// Step 2: map and convert audio as needed, only maps audio if the language looks like it should be english.
-	outAudioIdx := 0
-	for idx, stream := range probeData.Streams {
-		if !stream.IsAudio() {
-			continue
+	if pass.analysisOnly() {
+		return append(args, "-an", "-sn", "-dn", "-f", "null", "-y", os.DevNull), decisions, nil
+	}
+
+	args = append(args, coverArtArgs...)
+
+	if *mapExpr != "" {
+		// Steps 2 & 3 are replaced by the user's own stream selection
+		specs, err := parseMapExpr(*mapExpr)
+		if err != nil {
+			return nil, nil, err
 		}
-		audioIdx := probeData.MapStreamIdx("audio", idx)
-		args = append(args, "-map", fmt.Sprintf("0:a:%d", audioIdx))
-		if stream.IsSurroundAudio() {
-			args = append(args, fmt.Sprintf("-c:a:%d", outAudioIdx), "copy") // copy any surround audio channel
-		} else {
-			args = append(args, fmt.Sprintf("-c:a:%d", outAudioIdx), "libopus", "-b:a", "192k", "-ac", "2")
+		mapArgs, mapDecisions := mapExprArgs(specs)
+		args = append(args, mapArgs...)
+		decisions = append(decisions, mapDecisions...)
+	} else {
+		// Step 2: map and convert audio, surround tracks are handled according to the surround policy.
+		container := containerFor(outputFileName)
+		audioOpts := audioOptionsFromFlags()
+		audioOpts.CopyCodecs = container.AudioCopyCodecs
+		if err := validateAudioTracks(probeData, audioOpts.Tracks); err != nil {
+			return nil, nil, err
+		}
+		audioPlan, audioDecisions := planAudioTracks(probeData, audioOpts)
+		args = append(args, audioTrackArgs(audioPlan, audioEncodingFromFlags())...)
+		args = append(args, audioMetadataArgs(audioPlan, *stripMetadata)...)
+		if *audioThreads > 0 {
+			args = append(args, "-threads:a", strconv.Itoa(*audioThreads))
 		}
-		outAudioIdx++
+		decisions = append(decisions, audioDecisions...)
+
+		// Step 3: copy subtitles, optionally limited to an allowlist of codecs and converted to fit the container
+		subtitleOpts := subtitleOptionsFromFlags()
+		subtitleOpts.Container = container
+		keepSubtitles, subtitleDecisions := planSubtitles(probeData, subtitleOpts)
+		args = append(args, subtitleArgs(keepSubtitles, container.SubtitleCodec)...)
+		decisions = append(decisions, subtitleDecisions...)
+
+		// Step 3b: data streams are dropped unless asked for and the container can carry them
+		dataArgs, dataDecisions := planDataStreams(probeData, *copyDataStreams, outputFileName)
+		args = append(args, dataArgs...)
+		decisions = append(decisions, dataDecisions...)
+	}
+
+	// Step 4: copy the source's metadata. ffmpeg resets the creation time, it is carried over separately so that
+	// media managers keep their sort order
+	if *stripMetadata {
+		args = append(args, "-map_metadata", "-1")
+	} else {
+		args = append(args, "-map_metadata", "0")
+	}
+	if *preserveCreationTime && probeData.Format.Tags.CreationTime != "" {
+		args = append(args, "-metadata", "creation_time="+probeData.Format.Tags.CreationTime)
+	}
+
+	// Step 4b: keep chapter markers, ffmpeg only copies them implicitly
+	if *noChapters {
+		args = append(args, "-map_chapters", "-1")
+	} else if probeData.HasChapters() {
+		args = append(args, "-map_chapters", "0")
 	}
 
-	// Step 3: copy all subtitles
-	if probeData.HasSubtitles() {
-		args = append(args, "-c:s", "copy")
+	// Step 5: fragment mp4 outputs for streaming, combine with -keyint to control the fragment length
+	if *fragmented {
+		if strings.EqualFold(filepath.Ext(outputFileName), ".mp4") {
+			args = append(args, "-movflags", "+frag_keyframe+empty_moov+default_base_moof")
+		} else {
+			zap.S().Debugf("Ignoring -fragmented for non-mp4 output %q", outputFileName)
+		}
 	}
 
 	args = append(args, "-y", outputFileName) // allow overwriting output
 
-	return args, nil
+	return args, decisions, nil
+}
+
+// scaleCRFToResolution nudges crf by resolution for -adaptive-crf: one step per factor of two in pixel count
+// relative to 1080p, up for smaller and down for larger frames, rounded to the nearest step:
+//
+//	480p (854x480)    +2
+//	720p (1280x720)   +1
+//	1080p (1920x1080)  0
+//	1440p (2560x1440) -1
+//	4K (3840x2160)    -2
+//
+// The adjustment is limited to maxOffset and the result to SVT-AV1's CRF range 1-63. An unknown resolution is
+// left unchanged.
+func scaleCRFToResolution(crf, maxOffset, videoWidth, videoHeight int) int {
+	if videoWidth <= 0 || videoHeight <= 0 {
+		return crf
+	}
+	offset := int(math.Round(-math.Log2(float64(videoWidth*videoHeight) / float64(1920*1080))))
+	offset = max(-maxOffset, min(offset, maxOffset))
+	return max(1, min(crf+offset, 63))
 }
 
 func scaleBitrateToResolution(bitrate int, videoWidth int, videoHeight int) int {
@@ -0,0 +1,332 @@
+package main
+
+import (
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/garethgeorge/media-toolkit/internal/ffmpegutil"
+)
+
+func TestTempFilename(t *testing.T) {
+	tests := []struct {
+		location string
+		outfile  string
+		want     string
+	}{
+		{location: tempBeside, outfile: "/media/movie-svtav1enc.mkv", want: "/media/movie-svtav1enc.mkv.transcode.mkv"},
+		{location: tempBeside, outfile: "/media/movie-svtav1enc.mp4", want: "/media/movie-svtav1enc.mp4.transcode.mp4"},
+		{location: tempHidden, outfile: "/media/movie-svtav1enc.mkv", want: "/media/.movie-svtav1enc.mkv.transcode.mkv"},
+		{location: tempSubdir, outfile: "/media/movie-svtav1enc.mkv", want: "/media/.gtranscoder-tmp/movie-svtav1enc.mkv.transcode.mkv"},
+	}
+	for _, tc := range tests {
+		setFlag(t, tempLocation, tc.location)
+		got := tempFilename(tc.outfile)
+		if got != tc.want {
+			t.Errorf("tempFilename(%q) with -temp-location %s = %q, want %q", tc.outfile, tc.location, got, tc.want)
+		}
+		if !isEncodedFile(got) {
+			t.Errorf("isEncodedFile(%q) = false, want true", got)
+		}
+	}
+}
+
+func TestDeriveFilenameOutputExt(t *testing.T) {
+	for _, tc := range []struct {
+		ext  string
+		want string
+	}{
+		{ext: ".mkv", want: "/media/movie-svtav1enc.mkv"},
+		{ext: ".mp4", want: "/media/movie-svtav1enc.mp4"},
+		{ext: "WEBM", want: "/media/movie-svtav1enc.webm"},
+	} {
+		setFlag(t, outputExt, tc.ext)
+		got := deriveFilename("/media/movie.ts")
+		if got != tc.want {
+			t.Errorf("deriveFilename() with -output-ext %s = %q, want %q", tc.ext, got, tc.want)
+		}
+		if !isEncodedFile(got) || !isEncodedFile(tempFilename(got)) {
+			t.Errorf("isEncodedFile(%q) = false, want true for the output and its temp file", got)
+		}
+		// outputs of earlier runs in another container are still recognized
+		if !isEncodedFile("/media/other-svtav1enc.mkv") {
+			t.Errorf("isEncodedFile() of a .mkv output with -output-ext %s = false, want true", tc.ext)
+		}
+	}
+
+	if err := validateOutputContainer(".avi", "libopus"); err == nil {
+		t.Errorf("validateOutputContainer(\".avi\") succeeded, want an error")
+	}
+	if err := validateOutputContainer(".webm", "aac"); err == nil {
+		t.Errorf("validateOutputContainer(\".webm\", \"aac\") succeeded, want an error")
+	}
+}
+
+func TestMp4OutputAdjustsStreams(t *testing.T) {
+	setFlag(t, surroundPolicy, surroundCopy)
+	pd := mustParseProbe(t, `{
+		"format": {"bit_rate": "8000000"},
+		"streams": [
+			{"codec_type": "video", "codec_name": "h264", "width": 1920, "height": 1080},
+			{"codec_type": "audio", "codec_name": "ac3", "channels": 6, "tags": {"language": "eng"}},
+			{"codec_type": "audio", "codec_name": "dts", "channels": 6, "tags": {"language": "eng"}},
+			{"codec_type": "subtitle", "codec_name": "hdmv_pgs_subtitle", "tags": {"language": "eng"}},
+			{"codec_type": "subtitle", "codec_name": "subrip", "tags": {"language": "eng"}}
+		]
+	}`)
+
+	args, _, err := createFfmpegCommand(pd, "in.mkv", "out.mp4")
+	if err != nil {
+		t.Fatalf("createFfmpegCommand() error: %v", err)
+	}
+	if !containsSeq(args, "-map", "0:a:0", "-c:a:0", "copy") {
+		t.Errorf("expected ac3 surround to be copied into mp4: %v", args)
+	}
+	if !containsSeq(args, "-map", "0:a:1", "-c:a:1", "libopus") {
+		t.Errorf("expected dts surround to be downmixed for mp4: %v", args)
+	}
+	if containsSeq(args, "-map", "0:s:0") || !containsSeq(args, "-map", "0:s:1", "-c:s", "mov_text") {
+		t.Errorf("expected PGS to be dropped and subrip converted to mov_text: %v", args)
+	}
+
+	args, _, err = createFfmpegCommand(pd, "in.mkv", "out.mkv")
+	if err != nil {
+		t.Fatalf("createFfmpegCommand() error: %v", err)
+	}
+	if !containsSeq(args, "-map", "0:a:1", "-c:a:1", "copy") || !containsSeq(args, "-map", "0:s:0", "-map", "0:s:1", "-c:s", "copy") {
+		t.Errorf("expected mkv to copy all audio and subtitles: %v", args)
+	}
+}
+
+func TestFragmentedOnlyForMp4(t *testing.T) {
+	setFlag(t, fragmented, true)
+	pd := mustParseProbe(t, threeLanguageProbe)
+
+	for _, tc := range []struct {
+		outfile string
+		want    bool
+	}{
+		{outfile: "out.mp4", want: true},
+		{outfile: "out.mkv", want: false},
+	} {
+		args, _, err := createFfmpegCommand(pd, "in.mkv", tc.outfile)
+		if err != nil {
+			t.Fatalf("createFfmpegCommand() error: %v", err)
+		}
+		if got := containsSeq(args, "-movflags", "+frag_keyframe+empty_moov+default_base_moof"); got != tc.want {
+			t.Errorf("createFfmpegCommand(%q) fragmentation flags present = %v, want %v: %v", tc.outfile, got, tc.want, args)
+		}
+	}
+}
+
+func TestTuneIndependentOfPreset(t *testing.T) {
+	pd := mustParseProbe(t, threeLanguageProbe)
+	for _, tc := range []struct {
+		tune, preset int
+		want         string
+	}{
+		{tune: tuneVQ, preset: 6, want: "tune=0:film-grain=8"},
+		{tune: tunePSNR, preset: 6, want: "tune=1:film-grain=8"},
+		{tune: tuneSSIM, preset: 8, want: "tune=2:film-grain=0"},
+	} {
+		setFlag(t, tune, tc.tune)
+		setFlag(t, preset, tc.preset)
+		args, _, err := createFfmpegCommand(pd, "in.mkv", "out.mkv")
+		if err != nil {
+			t.Fatalf("createFfmpegCommand() error: %v", err)
+		}
+		if !containsSeq(args, "-svtav1-params", tc.want) {
+			t.Errorf("createFfmpegCommand() with -tune %d -preset %d missing -svtav1-params %s: %v", tc.tune, tc.preset, tc.want, args)
+		}
+	}
+}
+
+func TestPreviewMode(t *testing.T) {
+	pd := mustParseProbe(t, threeLanguageProbe)
+	setFlag(t, preset, 6)
+	for _, tc := range []struct {
+		mode      string
+		crf       string
+		preset    string
+		filmGrain string
+	}{
+		{mode: modeQuality, crf: "24", preset: "6", filmGrain: "tune=0:film-grain=8"},
+		{mode: modePreview, crf: "45", preset: "12", filmGrain: "tune=0:film-grain=0"},
+	} {
+		setFlag(t, encodeMode, tc.mode)
+		args, _, err := createFfmpegCommand(pd, "in.mkv", "out.mkv")
+		if err != nil {
+			t.Fatalf("createFfmpegCommand() error: %v", err)
+		}
+		if !containsSeq(args, "-crf", tc.crf, "-preset", tc.preset) || !containsSeq(args, "-svtav1-params", tc.filmGrain) {
+			t.Errorf("createFfmpegCommand() with -mode %s = %v, want -crf %s -preset %s and %s", tc.mode, args, tc.crf, tc.preset, tc.filmGrain)
+		}
+	}
+}
+
+func TestMasterMode(t *testing.T) {
+	pd := mustParseProbe(t, threeLanguageProbe)
+	setFlag(t, preset, 6)
+	setFlag(t, masterCRF, 10)
+
+	outfile := deriveFilename("/media/movie.mkv")
+	if want := "/media/movie-svtav1master.mkv"; outfile != want {
+		t.Errorf("deriveFilename() with -master-crf = %q, want %q", outfile, want)
+	}
+	if !isEncodedFile(outfile) {
+		t.Errorf("isEncodedFile(%q) = false, want true", outfile)
+	}
+	args, _, err := createFfmpegCommand(pd, "in.mkv", outfile)
+	if err != nil {
+		t.Fatalf("createFfmpegCommand() error: %v", err)
+	}
+	if !containsSeq(args, "-crf", "10", "-preset", "6") {
+		t.Errorf("createFfmpegCommand() with -master-crf 10 = %v, want -crf 10 -preset 6", args)
+	}
+}
+
+func TestSampleDuration(t *testing.T) {
+	pd := mustParseProbe(t, threeLanguageProbe)
+	setFlag(t, sampleDuration, 90*time.Second)
+
+	outfile := deriveFilename("/media/movie.mkv")
+	if want := "/media/movie-svtav1enc.sample.mkv"; outfile != want {
+		t.Errorf("deriveFilename() with -sample-duration = %q, want %q", outfile, want)
+	}
+	if !isEncodedFile(outfile) {
+		t.Errorf("isEncodedFile(%q) = false, want true", outfile)
+	}
+	args, _, err := createFfmpegCommand(pd, "in.mkv", outfile)
+	if err != nil {
+		t.Fatalf("createFfmpegCommand() error: %v", err)
+	}
+	if !containsSeq(args, "-i", "in.mkv", "-t", "90") {
+		t.Errorf("createFfmpegCommand() with -sample-duration 90s = %v, want -t 90 after the input", args)
+	}
+	if got := encodedSeconds(ffmpegutil.ProbeData{}); got != 90 {
+		t.Errorf("encodedSeconds() of a source of unknown duration = %v, want 90", got)
+	}
+	if got := finalOverwritePolicy(); got != overwriteAlways {
+		t.Errorf("finalOverwritePolicy() with -sample-duration = %q, want samples replaced with %q", got, overwriteAlways)
+	}
+}
+
+func TestCRFFlag(t *testing.T) {
+	pd := mustParseProbe(t, threeLanguageProbe)
+	setFlag(t, crf, 30)
+	for _, tc := range []struct {
+		mode string
+		want string
+	}{
+		{mode: modeQuality, want: "30"},
+		{mode: modePreview, want: "45"},
+	} {
+		setFlag(t, encodeMode, tc.mode)
+		args, _, err := createFfmpegCommand(pd, "in.mkv", "out.mkv")
+		if err != nil {
+			t.Fatalf("createFfmpegCommand() error: %v", err)
+		}
+		if !containsSeq(args, "-crf", tc.want) {
+			t.Errorf("createFfmpegCommand() with -crf 30 -mode %s = %v, want -crf %s", tc.mode, args, tc.want)
+		}
+	}
+}
+
+func TestScaleCRFToResolution(t *testing.T) {
+	for _, tc := range []struct {
+		name          string
+		crf, maxRange int
+		width, height int
+		want          int
+	}{
+		{"480p", 24, 4, 854, 480, 26},
+		{"720p", 24, 4, 1280, 720, 25},
+		{"1080p", 24, 4, 1920, 1080, 24},
+		{"1440p", 24, 4, 2560, 1440, 23},
+		{"4K", 24, 4, 3840, 2160, 22},
+		{"240p limited by range", 24, 1, 426, 240, 25},
+		{"clamped to 63", 63, 4, 854, 480, 63},
+		{"clamped to 1", 1, 4, 3840, 2160, 1},
+		{"unknown resolution", 24, 4, 0, 0, 24},
+	} {
+		if got := scaleCRFToResolution(tc.crf, tc.maxRange, tc.width, tc.height); got != tc.want {
+			t.Errorf("scaleCRFToResolution(%s) = %d, want %d", tc.name, got, tc.want)
+		}
+	}
+}
+
+func TestAdaptiveCRFOnlyForQuality(t *testing.T) {
+	pd := mustParseProbe(t, `{"streams": [{"codec_type": "video", "codec_name": "h264", "width": 3840, "height": 2160}], "format": {"duration": "60"}}`)
+	setFlag(t, adaptiveCRF, true)
+	setFlag(t, crf, 30)
+	for _, tc := range []struct {
+		mode string
+		want string
+	}{
+		{mode: modeQuality, want: "28"},
+		{mode: modePreview, want: "45"},
+	} {
+		setFlag(t, encodeMode, tc.mode)
+		args, _, err := createFfmpegCommand(pd, "in.mkv", "out.mkv")
+		if err != nil {
+			t.Fatalf("createFfmpegCommand() error: %v", err)
+		}
+		if !containsSeq(args, "-crf", tc.want) {
+			t.Errorf("createFfmpegCommand() of 4K with -adaptive-crf -mode %s = %v, want -crf %s", tc.mode, args, tc.want)
+		}
+	}
+}
+
+func TestAnamorphicKeepsSampleAspect(t *testing.T) {
+	pd := mustParseProbe(t, `{"streams": [{"codec_type": "video", "codec_name": "mpeg2video", "width": 720, "height": 480, "sample_aspect_ratio": "32:27", "display_aspect_ratio": "16:9"}], "format": {"duration": "60"}}`)
+	args, _, err := createFfmpegCommand(pd, "in.mkv", "out.mkv")
+	if err != nil {
+		t.Fatalf("createFfmpegCommand() error: %v", err)
+	}
+	if !containsSeq(args, "-vf", "setsar=32/27") {
+		t.Errorf("createFfmpegCommand() of an anamorphic DVD = %v, want -vf setsar=32/27", args)
+	}
+}
+
+func TestChapters(t *testing.T) {
+	withChapters := mustParseProbe(t, `{"streams": [{"codec_type": "video", "codec_name": "h264", "width": 1920, "height": 1080}], "chapters": [{"id": 1, "start_time": "0.000000", "end_time": "60.000000"}], "format": {"duration": "60"}}`)
+	withoutChapters := mustParseProbe(t, threeLanguageProbe)
+	for _, tc := range []struct {
+		name       string
+		pd         ffmpegutil.ProbeData
+		noChapters bool
+		want       []string
+	}{
+		{name: "chapters", pd: withChapters, want: []string{"-map_chapters", "0"}},
+		{name: "chapters with -no-chapters", pd: withChapters, noChapters: true, want: []string{"-map_chapters", "-1"}},
+		{name: "no chapters", pd: withoutChapters},
+	} {
+		setFlag(t, noChapters, tc.noChapters)
+		args, _, err := createFfmpegCommand(tc.pd, "in.mkv", "out.mkv")
+		if err != nil {
+			t.Fatalf("createFfmpegCommand() error: %v", err)
+		}
+		if tc.want == nil {
+			if slices.Contains(args, "-map_chapters") {
+				t.Errorf("createFfmpegCommand(%s) = %v, want no -map_chapters", tc.name, args)
+			}
+		} else if !containsSeq(args, tc.want...) {
+			t.Errorf("createFfmpegCommand(%s) = %v, want %v", tc.name, args, tc.want)
+		}
+	}
+}
+
+func TestOutputDir(t *testing.T) {
+	setFlag(t, outputDir, "/mirror")
+	setFlag(t, &inputRoot, "/media")
+
+	if got, want := deriveFilename("/media/Movies/Movie (2020)/movie.mkv"), "/mirror/Movies/Movie (2020)/movie-svtav1enc.mkv"; got != want {
+		t.Errorf("deriveFilename() with -output-dir = %q, want %q", got, want)
+	}
+	if got, want := deriveFilename("/other/movie.mkv"), "/other/movie-svtav1enc.mkv"; got != want {
+		t.Errorf("deriveFilename() of a file outside the input = %q, want %q", got, want)
+	}
+	if !inOutputTree("/mirror/Movies/movie-svtav1enc.mkv") || inOutputTree("/media/Movies/movie.mkv") || inOutputTree("/mirror-old/movie.mkv") {
+		t.Errorf("inOutputTree() doesn't match only paths under -output-dir")
+	}
+}
@@ -0,0 +1,41 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/garethgeorge/media-toolkit/internal/encodelog"
+)
+
+// parseMapExpr splits a -map-expr value into ffmpeg -map specifiers. Validation is deliberately minimal, the
+// specifiers are passed to ffmpeg as-is and must refer to the only input e.g. 0:a:1 or -0:s:2 to exclude a stream.
+func parseMapExpr(expr string) ([]string, error) {
+	var specs []string
+	for _, spec := range strings.Split(expr, ",") {
+		spec = strings.TrimSpace(spec)
+		if spec == "" {
+			continue
+		}
+		if !strings.HasPrefix(strings.TrimPrefix(spec, "-"), "0") {
+			return nil, fmt.Errorf("map specifier %q must refer to input 0", spec)
+		}
+		specs = append(specs, spec)
+	}
+	if len(specs) == 0 {
+		return nil, fmt.Errorf("map expression %q has no specifiers", expr)
+	}
+	return specs, nil
+}
+
+// mapExprArgs maps the user's specifiers in place of the automatic audio and subtitle selection. Audio and subtitles
+// are stream copied since their codecs are unknown, any video streams mapped get the AV1 encode like the main one.
+func mapExprArgs(specs []string) ([]string, []encodelog.StreamDecision) {
+	var args []string
+	var decisions []encodelog.StreamDecision
+	for _, spec := range specs {
+		args = append(args, "-map", spec)
+		decisions = append(decisions, encodelog.StreamDecision{Stream: spec, Action: "map", Reason: "-map-expr"})
+	}
+	args = append(args, "-c:a", "copy", "-c:s", "copy")
+	return args, decisions
+}
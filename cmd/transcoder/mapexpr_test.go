@@ -0,0 +1,39 @@
+package main
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestMapExprOverridesSelection(t *testing.T) {
+	setFlag(t, mapExpr, "0:a:2, 0:s:0")
+
+	pd := mustParseProbe(t, threeLanguageProbe)
+	args, _, err := createFfmpegCommand(pd, "in.mkv", "out.mkv")
+	if err != nil {
+		t.Fatalf("createFfmpegCommand() error: %v", err)
+	}
+
+	if !containsSeq(args, "-map", "0:v") || !slices.Contains(args, "libsvtav1") {
+		t.Errorf("expected the AV1 video encode to be kept: %v", args)
+	}
+	if !containsSeq(args, "-map", "0:a:2", "-map", "0:s:0", "-c:a", "copy", "-c:s", "copy") {
+		t.Errorf("expected the custom maps to be stream copied: %v", args)
+	}
+	if containsSeq(args, "-map", "0:a:0") || slices.Contains(args, "libopus") {
+		t.Errorf("expected automatic audio selection to be overridden: %v", args)
+	}
+}
+
+func TestParseMapExpr(t *testing.T) {
+	if _, err := parseMapExpr("1:a:0"); err == nil {
+		t.Errorf("parseMapExpr() expected an error for a second input")
+	}
+	if _, err := parseMapExpr(" , "); err == nil {
+		t.Errorf("parseMapExpr() expected an error for an empty expression")
+	}
+	specs, err := parseMapExpr("0:a:1,-0:s:2")
+	if err != nil || !slices.Equal(specs, []string{"0:a:1", "-0:s:2"}) {
+		t.Errorf("parseMapExpr() = %v, %v", specs, err)
+	}
+}
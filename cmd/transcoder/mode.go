@@ -0,0 +1,34 @@
+package main
+
+// Encode modes for -mode. Previews are fast, low quality placeholders marked in the log so that a later
+// -upgrade-previews run can replace them with quality encodes. Masters are near lossless encodes made with
+// -master-crf, kept as a source for later encodes so finalize never removes their original.
+const (
+	modeQuality = "quality"
+	modePreview = "preview"
+	modeMaster  = "master"
+)
+
+const (
+	previewPreset = 12 // fastest SVT-AV1 preset
+	previewCRF    = 45
+)
+
+// activeMode returns the encode mode of this run, -master-crf takes precedence over -mode.
+func activeMode() string {
+	if *masterCRF > 0 {
+		return modeMaster
+	}
+	return *encodeMode
+}
+
+// encodeSettings returns the SVT-AV1 preset and CRF used for an encode mode.
+func encodeSettings(mode string) (svtPreset, crfValue int) {
+	switch mode {
+	case modePreview:
+		return previewPreset, previewCRF
+	case modeMaster:
+		return *preset, *masterCRF
+	}
+	return *preset, *crf
+}
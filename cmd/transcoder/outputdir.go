@@ -0,0 +1,41 @@
+package main
+
+import (
+	"path/filepath"
+	"strings"
+)
+
+// inputRoot is the absolute directory the input is resolved against, outputs mirror the paths of their sources
+// relative to it under -output-dir.
+var inputRoot string
+
+// mirroredPath maps a path in the input tree onto the same relative path under -output-dir. Without -output-dir,
+// or for a path outside the input tree, the path is returned unchanged.
+func mirroredPath(path string) string {
+	if *outputDir == "" || inputRoot == "" {
+		return path
+	}
+	rel, ok := relativeTo(path, inputRoot)
+	if !ok {
+		return path
+	}
+	return filepath.Join(*outputDir, rel)
+}
+
+// inOutputTree reports whether path is under -output-dir, e.g. because the output tree is nested in the input tree.
+func inOutputTree(path string) bool {
+	if *outputDir == "" {
+		return false
+	}
+	_, ok := relativeTo(path, *outputDir)
+	return ok
+}
+
+// relativeTo returns path relative to dir, false if it isn't under dir.
+func relativeTo(path, dir string) (string, bool) {
+	rel, err := filepath.Rel(dir, path)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", false
+	}
+	return rel, true
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"fmt"
+	"os"
+)
+
+// -overwrite-final policies for an output that already exists without a log entry.
+const (
+	overwriteNever  = "never"  // keep the existing output and skip the file
+	overwriteVerify = "verify" // keep it if it passes verification, otherwise encode again
+	overwriteAlways = "always" // always encode again and replace it
+)
+
+// overwritePlan is what to do about the temp file and final output already on disk before encoding.
+//
+//	temp  final  outcome
+//	no    no     encode
+//	yes   no     -overwrite-temp: remove the stale temp and encode, otherwise skip and retry next run
+//	no    yes    -overwrite-final never: skip, verify: verify the output first, always: encode and replace it
+//	yes   yes    the final output's policy applies first, then the temp's if the file is still to be encoded
+type overwritePlan struct {
+	Skip        string // reason to skip the file, empty to encode it
+	SkipRetry   bool   // the skip is transient and the file should be examined again next run
+	RemoveTemp  bool   // a stale temp file must be removed before encoding
+	VerifyFinal bool   // the existing output must be verified, it is only replaced if verification fails
+}
+
+func planOverwrite(tempExists, finalExists, overwriteTemp bool, finalPolicy string) overwritePlan {
+	var plan overwritePlan
+	if finalExists {
+		switch finalPolicy {
+		case overwriteVerify:
+			plan.VerifyFinal = true
+		case overwriteAlways:
+		default:
+			return overwritePlan{Skip: "output exists"}
+		}
+	}
+	if tempExists {
+		if !overwriteTemp {
+			return overwritePlan{Skip: "temp file exists", SkipRetry: true}
+		}
+		plan.RemoveTemp = true
+	}
+	return plan
+}
+
+// planOverwriteFor plans for the output and temp file currently on disk, an output that is a preview being
+// upgraded is always replaced.
+func planOverwriteFor(outfile, tmpfile string, replacePreview bool) overwritePlan {
+	finalPolicy := finalOverwritePolicy()
+	if replacePreview {
+		finalPolicy = overwriteAlways
+	}
+	return planOverwrite(fileExists(tmpfile), fileExists(outfile), *overwriteTemp, finalPolicy)
+}
+
+// validateOverwriteFinal checks a -overwrite-final policy.
+func validateOverwriteFinal(policy string) error {
+	switch policy {
+	case overwriteNever, overwriteVerify, overwriteAlways:
+		return nil
+	}
+	return fmt.Errorf("%q must be never, verify or always", policy)
+}
+
+// finalOverwritePolicy returns the -overwrite-final policy, -verify-existing upgrades never to verify. Samples are
+// always replaced so that trying other settings on the same files doesn't skip them.
+func finalOverwritePolicy() string {
+	if sampling() {
+		return overwriteAlways
+	}
+	if *verifyExisting && *overwriteFinal == overwriteNever {
+		return overwriteVerify
+	}
+	return *overwriteFinal
+}
+
+func fileExists(name string) bool {
+	_, err := os.Stat(name)
+	return err == nil
+}
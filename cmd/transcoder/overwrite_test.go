@@ -0,0 +1,32 @@
+package main
+
+import "testing"
+
+func TestPlanOverwrite(t *testing.T) {
+	tests := []struct {
+		name          string
+		temp, final   bool
+		overwriteTemp bool
+		policy        string
+		want          overwritePlan
+	}{
+		{name: "nothing on disk", policy: overwriteNever, want: overwritePlan{}},
+
+		{name: "stale temp removed", temp: true, overwriteTemp: true, policy: overwriteNever, want: overwritePlan{RemoveTemp: true}},
+		{name: "stale temp kept", temp: true, policy: overwriteNever, want: overwritePlan{Skip: "temp file exists", SkipRetry: true}},
+
+		{name: "final kept", final: true, policy: overwriteNever, want: overwritePlan{Skip: "output exists"}},
+		{name: "final verified", final: true, policy: overwriteVerify, want: overwritePlan{VerifyFinal: true}},
+		{name: "final replaced", final: true, policy: overwriteAlways, want: overwritePlan{}},
+
+		{name: "both, final kept first", temp: true, final: true, overwriteTemp: true, policy: overwriteNever, want: overwritePlan{Skip: "output exists"}},
+		{name: "both, replaced", temp: true, final: true, overwriteTemp: true, policy: overwriteAlways, want: overwritePlan{RemoveTemp: true}},
+		{name: "both, verified", temp: true, final: true, overwriteTemp: true, policy: overwriteVerify, want: overwritePlan{RemoveTemp: true, VerifyFinal: true}},
+		{name: "both, temp kept", temp: true, final: true, policy: overwriteAlways, want: overwritePlan{Skip: "temp file exists", SkipRetry: true}},
+	}
+	for _, tc := range tests {
+		if got := planOverwrite(tc.temp, tc.final, tc.overwriteTemp, tc.policy); got != tc.want {
+			t.Errorf("%s: planOverwrite(%v, %v, %v, %s) = %+v, want %+v", tc.name, tc.temp, tc.final, tc.overwriteTemp, tc.policy, got, tc.want)
+		}
+	}
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"cmp"
+	"flag"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// presetTier selects a preset for sources at least MinHeight lines tall.
+type presetTier struct {
+	MinHeight int
+	Preset    int
+}
+
+// presetMapFlag is a -preset-map of height:preset pairs e.g. 2160:6,1080:8,480:10, kept tallest first.
+type presetMapFlag []presetTier
+
+func (m *presetMapFlag) String() string {
+	if m == nil {
+		return ""
+	}
+	pairs := make([]string, len(*m))
+	for i, tier := range *m {
+		pairs[i] = fmt.Sprintf("%d:%d", tier.MinHeight, tier.Preset)
+	}
+	return strings.Join(pairs, ",")
+}
+
+func (m *presetMapFlag) Set(value string) error {
+	var tiers presetMapFlag
+	for _, pair := range strings.Split(value, ",") {
+		heightStr, presetStr, ok := strings.Cut(strings.TrimSpace(pair), ":")
+		height, err1 := strconv.Atoi(heightStr)
+		preset, err2 := strconv.Atoi(presetStr)
+		if !ok || err1 != nil || err2 != nil {
+			return fmt.Errorf("%q must be height:preset pairs e.g. 2160:6,1080:8", value)
+		}
+		if height <= 0 {
+			return fmt.Errorf("height %d must be positive", height)
+		}
+		if preset < 0 || preset > 13 {
+			return fmt.Errorf("preset %d for height %d must be between 0 and 13", preset, height)
+		}
+		if slices.ContainsFunc(tiers, func(t presetTier) bool { return t.MinHeight == height }) {
+			return fmt.Errorf("height %d is listed more than once", height)
+		}
+		tiers = append(tiers, presetTier{MinHeight: height, Preset: preset})
+	}
+	slices.SortFunc(tiers, func(a, b presetTier) int { return cmp.Compare(b.MinHeight, a.MinHeight) })
+	*m = tiers
+	return nil
+}
+
+// presetMapVar defines a -preset-map flag.
+func presetMapVar(name, usage string) *presetMapFlag {
+	m := &presetMapFlag{}
+	flag.Var(m, name, usage)
+	return m
+}
+
+// presetFor returns the preset of the tallest tier the source reaches. Widescreen sources are cropped to fewer
+// lines, so the height is taken as that of a 16:9 picture of the same width if larger e.g. 2160 for 3840x1608. It
+// reports false if the source is shorter than every tier or its size is unknown.
+func (m presetMapFlag) presetFor(width, height int) (int, bool) {
+	height = max(height, width*9/16)
+	for _, tier := range m {
+		if height > 0 && height >= tier.MinHeight {
+			return tier.Preset, true
+		}
+	}
+	return 0, false
+}
@@ -0,0 +1,52 @@
+package main
+
+import "testing"
+
+func TestPresetMapFlag(t *testing.T) {
+	var m presetMapFlag
+	if err := m.Set("1080:8, 2160:6,480:10"); err != nil {
+		t.Fatalf("Set() error: %v", err)
+	}
+	if got := m.String(); got != "2160:6,1080:8,480:10" {
+		t.Errorf("String() = %q, want tallest first", got)
+	}
+
+	for _, tc := range []struct {
+		name          string
+		width, height int
+		want          int
+		wantOK        bool
+	}{
+		{"4K", 3840, 2160, 6, true},
+		{"4K scope", 3840, 1608, 6, true},
+		{"1080p", 1920, 1080, 8, true},
+		{"720p", 1280, 720, 10, true},
+		{"480p", 854, 480, 10, true},
+		{"360p", 640, 360, 0, false},
+		{"unknown", 0, 0, 0, false},
+	} {
+		got, ok := m.presetFor(tc.width, tc.height)
+		if got != tc.want || ok != tc.wantOK {
+			t.Errorf("presetFor(%s) = %d, %v, want %d, %v", tc.name, got, ok, tc.want, tc.wantOK)
+		}
+	}
+
+	for _, bad := range []string{"", "1080", "1080:fast", "0:8", "1080:14", "1080:8,1080:6"} {
+		if err := new(presetMapFlag).Set(bad); err == nil {
+			t.Errorf("Set(%q) succeeded, want an error", bad)
+		}
+	}
+}
+
+func TestPresetMapOverridesPreset(t *testing.T) {
+	pd := mustParseProbe(t, threeLanguageProbe)
+	setFlag(t, preset, 6)
+	setFlag(t, presetMap, presetMapFlag{{MinHeight: 2160, Preset: 4}, {MinHeight: 1080, Preset: 8}})
+	args, _, err := createFfmpegCommand(pd, "in.mkv", "out.mkv")
+	if err != nil {
+		t.Fatalf("createFfmpegCommand() error: %v", err)
+	}
+	if !containsSeq(args, "-preset", "8") {
+		t.Errorf("createFfmpegCommand() of 1080p with -preset-map 2160:4,1080:8 = %v, want -preset 8", args)
+	}
+}
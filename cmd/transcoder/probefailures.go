@@ -0,0 +1,67 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/garethgeorge/media-toolkit/internal/encodelog"
+	"github.com/garethgeorge/media-toolkit/internal/ffmpegutil"
+	"go.uber.org/zap"
+)
+
+// sameSourceFile reports whether the file at path is still the one a log entry was written for, by size and
+// modification time.
+func sameSourceFile(info os.FileInfo, entry encodelog.LogFileEntry) bool {
+	return info.Size() == entry.InputSizeBytes && info.ModTime().UTC().Format(time.RFC3339Nano) == entry.InputModTime
+}
+
+// probeFailureEntry builds the log entry for a failed probe. Failures of the same file are counted across runs
+// and once -max-probe-failures is reached the skip becomes permanent until the file changes. previous is the
+// latest log entry for the file, if any.
+func probeFailureEntry(infile, outfile string, info os.FileInfo, previous *encodelog.LogFileEntry, probeErr error) encodelog.LogFileEntry {
+	failures := 1
+	if previous != nil && previous.ProbeFailures > 0 && sameSourceFile(info, *previous) {
+		failures = previous.ProbeFailures + 1
+	}
+	return encodelog.LogFileEntry{
+		InputPath:      infile,
+		OutputPath:     outfile,
+		StartTime:      time.Now().Format(time.RFC3339),
+		Skipped:        fmt.Sprintf("ffprobe failed %d time(s): %v", failures, probeErr),
+		Retry:          failures < *maxProbeFailures,
+		InputSizeBytes: info.Size(),
+		InputModTime:   info.ModTime().UTC().Format(time.RFC3339Nano),
+		ProbeFailures:  failures,
+	}
+}
+
+// recordProbeFailure logs a failed probe so that files that never probe stop being probed every run. Only
+// failures where ffprobe rejected the file are logged, others are retried next run without counting against it.
+func recordProbeFailure(logFile, infile, outfile string, previous *encodelog.LogFileEntry, probeErr error) {
+	summary.Failed()
+	if !errors.Is(probeErr, ffmpegutil.ErrProbeRejected) {
+		zap.S().Warnf("Item %q probe failed, not counting it against the file: %v\n", infile, probeErr)
+		return
+	}
+	if *dryRun {
+		zap.S().Infof("Item %q dry run, would record probe failure: %v\n", infile, probeErr)
+		return
+	}
+	if sampling() {
+		return
+	}
+	info, err := os.Stat(infile)
+	if err != nil {
+		zap.S().Errorf("Item %q stat error: %v\n", infile, err)
+		return
+	}
+	entry := probeFailureEntry(infile, outfile, info, previous, probeErr)
+	if !entry.Retry {
+		zap.S().Warnf("Item %q failed to probe %d times, skipping it until it changes\n", infile, entry.ProbeFailures)
+	}
+	if err := encodelog.AppendLog(logFile, entry); err != nil {
+		zap.S().Warnf("Log write error %q: %v", infile, err)
+	}
+}
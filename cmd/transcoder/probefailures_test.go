@@ -0,0 +1,80 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/garethgeorge/media-toolkit/internal/encodelog"
+	"github.com/garethgeorge/media-toolkit/internal/ffmpegutil"
+)
+
+func TestProbeFailureEntry(t *testing.T) {
+	setFlag(t, maxProbeFailures, 2)
+	path := filepath.Join(t.TempDir(), "junk.mkv")
+	if err := os.WriteFile(path, []byte("not a video"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	probeErr := errors.New("invalid data found when processing input")
+
+	first := probeFailureEntry(path, "out.mkv", info, nil, probeErr)
+	if first.ProbeFailures != 1 || !first.Retry {
+		t.Errorf("first failure = %d failures, retry %v, want 1 and retry", first.ProbeFailures, first.Retry)
+	}
+	second := probeFailureEntry(path, "out.mkv", info, &first, probeErr)
+	if second.ProbeFailures != 2 || second.Retry {
+		t.Errorf("second failure = %d failures, retry %v, want 2 and permanent", second.ProbeFailures, second.Retry)
+	}
+	if !sameSourceFile(info, second) {
+		t.Errorf("sameSourceFile() = false for the unchanged file")
+	}
+
+	// a replaced file at the same path gets a fresh count
+	if err := os.WriteFile(path, []byte("a different file"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chtimes(path, time.Now(), time.Now().Add(time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+	replaced, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sameSourceFile(replaced, second) {
+		t.Errorf("sameSourceFile() = true for a replaced file")
+	}
+	if entry := probeFailureEntry(path, "out.mkv", replaced, &second, probeErr); entry.ProbeFailures != 1 || !entry.Retry {
+		t.Errorf("failure of a replaced file = %d failures, retry %v, want 1 and retry", entry.ProbeFailures, entry.Retry)
+	}
+}
+
+func TestRecordProbeFailureOnlyRejected(t *testing.T) {
+	dir := t.TempDir()
+	logFile := filepath.Join(dir, "log.json")
+	path := filepath.Join(dir, "movie.mkv")
+	if err := os.WriteFile(path, []byte("not a video"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	recordProbeFailure(logFile, path, "out.mkv", nil, fmt.Errorf("ffprobe failed: %w", exec.ErrNotFound))
+	if _, err := os.Stat(logFile); !os.IsNotExist(err) {
+		t.Fatalf("a missing ffprobe was logged as a probe failure, stat error: %v", err)
+	}
+
+	recordProbeFailure(logFile, path, "out.mkv", nil, fmt.Errorf("%w: exit status 1", ffmpegutil.ErrProbeRejected))
+	entries, err := encodelog.ReadLog(logFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 || entries[0].ProbeFailures != 1 {
+		t.Errorf("log after a rejected probe = %+v, want one entry with 1 failure", entries)
+	}
+}
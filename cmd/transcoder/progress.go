@@ -0,0 +1,95 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// progressLogInterval is how often the progress of a running encode is logged.
+const progressLogInterval = 30 * time.Second
+
+// progressUpdate is one block of ffmpeg's -progress output.
+type progressUpdate struct {
+	Frame   int
+	FPS     float64
+	OutTime time.Duration // position in the output encoded so far
+	Speed   float64       // multiple of realtime, 0 if unknown
+	End     bool          // the last update of the encode
+}
+
+// parseProgress reads ffmpeg's -progress key=value stream and calls fn for every block, which ffmpeg terminates
+// with a progress=continue or progress=end line. Malformed lines and values are ignored.
+func parseProgress(r io.Reader, fn func(progressUpdate)) error {
+	var update progressUpdate
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		key, value, ok := strings.Cut(strings.TrimSpace(scanner.Text()), "=")
+		if !ok {
+			continue
+		}
+		value = strings.TrimSpace(value)
+		switch key {
+		case "frame":
+			if n, err := strconv.Atoi(value); err == nil {
+				update.Frame = n
+			}
+		case "fps":
+			if n, err := strconv.ParseFloat(value, 64); err == nil {
+				update.FPS = n
+			}
+		case "out_time_us":
+			if n, err := strconv.ParseInt(value, 10, 64); err == nil && n >= 0 {
+				update.OutTime = time.Duration(n) * time.Microsecond
+			}
+		case "speed":
+			if n, err := strconv.ParseFloat(strings.TrimSuffix(value, "x"), 64); err == nil {
+				update.Speed = n
+			}
+		case "progress":
+			update.End = value == "end"
+			fn(update)
+			update = progressUpdate{}
+		}
+	}
+	return scanner.Err()
+}
+
+// formatProgress describes an update for a human, as a percentage with an ETA if the duration of the source is
+// known or as the time encoded so far if not.
+func formatProgress(infile string, update progressUpdate, totalSeconds float64) string {
+	speed := "unknown speed"
+	if update.Speed > 0 {
+		speed = fmt.Sprintf("%.2fx speed", update.Speed)
+	}
+	if totalSeconds <= 0 {
+		return fmt.Sprintf("Item %q: %s encoded (%s)", infile, update.OutTime.Round(time.Second), speed)
+	}
+	done := update.OutTime.Seconds()
+	percent := min(100, 100*done/totalSeconds)
+	if update.Speed <= 0 {
+		return fmt.Sprintf("Item %q: %.0f%% (%s)", infile, percent, speed)
+	}
+	eta := time.Duration(max(0, totalSeconds-done) / update.Speed * float64(time.Second))
+	return fmt.Sprintf("Item %q: %.0f%% (%s, ETA %s)", infile, percent, speed, eta.Round(time.Second))
+}
+
+// reportProgress logs the progress parsed from r at most every progressLogInterval until r is closed.
+func reportProgress(r io.Reader, infile string, totalSeconds float64) {
+	var lastLog time.Time
+	err := parseProgress(r, func(update progressUpdate) {
+		if !update.End && time.Since(lastLog) < progressLogInterval {
+			return
+		}
+		lastLog = time.Now()
+		zap.S().Info(formatProgress(infile, update, totalSeconds))
+	})
+	if err != nil {
+		zap.S().Debugf("Item %q error reading encoder progress: %v", infile, err)
+	}
+}
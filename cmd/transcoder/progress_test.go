@@ -0,0 +1,59 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseProgress(t *testing.T) {
+	const output = `frame=240
+fps=48.00
+out_time_us=10000000
+speed=1.8x
+progress=continue
+garbage line
+frame=oops
+out_time_us=N/A
+speed=N/A
+progress=continue
+frame=1000
+out_time_us=41708333
+speed=2x
+progress=end
+`
+	var updates []progressUpdate
+	if err := parseProgress(strings.NewReader(output), func(u progressUpdate) { updates = append(updates, u) }); err != nil {
+		t.Fatalf("parseProgress() error: %v", err)
+	}
+	want := []progressUpdate{
+		{Frame: 240, FPS: 48, OutTime: 10 * time.Second, Speed: 1.8},
+		{},
+		{Frame: 1000, OutTime: 41708333 * time.Microsecond, Speed: 2, End: true},
+	}
+	if len(updates) != len(want) {
+		t.Fatalf("parseProgress() produced %d updates, want %d: %+v", len(updates), len(want), updates)
+	}
+	for i := range want {
+		if updates[i] != want[i] {
+			t.Errorf("update %d = %+v, want %+v", i, updates[i], want[i])
+		}
+	}
+}
+
+func TestFormatProgress(t *testing.T) {
+	tests := []struct {
+		update progressUpdate
+		total  float64
+		want   string
+	}{
+		{update: progressUpdate{OutTime: 42 * time.Second, Speed: 2}, total: 100, want: `Item "a.mkv": 42% (2.00x speed, ETA 29s)`},
+		{update: progressUpdate{OutTime: 42 * time.Second}, total: 100, want: `Item "a.mkv": 42% (unknown speed)`},
+		{update: progressUpdate{OutTime: 90 * time.Second, Speed: 1.5}, total: 0, want: `Item "a.mkv": 1m30s encoded (1.50x speed)`},
+	}
+	for _, tc := range tests {
+		if got := formatProgress("a.mkv", tc.update, tc.total); got != tc.want {
+			t.Errorf("formatProgress(%+v, %v) = %q, want %q", tc.update, tc.total, got, tc.want)
+		}
+	}
+}
@@ -0,0 +1,193 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/garethgeorge/media-toolkit/internal/encodelog"
+	"github.com/garethgeorge/media-toolkit/internal/ffmpegutil"
+	"go.uber.org/zap"
+)
+
+// audioIndicesWithLanguage returns the indices among the probe's audio streams (the N in 0:a:N) tagged with lang.
+func audioIndicesWithLanguage(probeData ffmpegutil.ProbeData, lang string) []int {
+	var indices []int
+	for idx, stream := range probeData.Streams {
+		if stream.IsAudio() && strings.EqualFold(stream.Tags.Language, lang) {
+			indices = append(indices, probeData.MapStreamIdx("audio", idx))
+		}
+	}
+	return indices
+}
+
+// runAddMissingAudio finds existing outputs that lack any audio track in lang while their source has one, and
+// remuxes the source's tracks in that language into the output. Video and existing tracks are stream copied so
+// nothing is re-encoded. Only outputs with a successful encode in the log are remuxed, the remux's log entry
+// carries that encode's details forward. Cancelling ctx interrupts the running remux and stops before the next file.
+func runAddMissingAudio(ctx context.Context, matches []string, lang, logFile string) {
+	index, err := encodelog.ScanIndex(logFile)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		zap.S().Errorf("Error reading transcode log: %v", err)
+		return
+	}
+	for _, match := range matches {
+		if ctx.Err() != nil {
+			return
+		}
+		match, err := filepath.Abs(match)
+		if err != nil {
+			zap.S().Errorf("Error resolving absolute path: %v", err)
+			continue
+		}
+		if isEncodedFile(match) {
+			continue
+		}
+		outfile := deriveFilename(match)
+		if _, err := os.Stat(outfile); err != nil {
+			continue
+		}
+		encode, ok := index[encodelog.Key{InputPath: match, OutputPath: outfile}]
+		if !ok || encode.Error != "" || encode.Skipped != "" {
+			zap.S().Warnf("Item %q output %q has no successful encode in the log, not adding %s audio", match, outfile, lang)
+			continue
+		}
+
+		if err := addMissingAudio(ctx, match, outfile, lang, logFile, encode); err != nil {
+			if errors.Is(err, errSkip) {
+				continue
+			}
+			zap.S().Errorf("Item %q error adding %s audio: %v", match, lang, err)
+		}
+	}
+}
+
+// addMissingAudio remuxes the tracks in lang of infile into outfile, whose latest log entry is encode.
+func addMissingAudio(ctx context.Context, infile, outfile, lang, logFile string, encode encodelog.LogFileEntry) error {
+	namedLockSet := newLockSet()
+	if err := namedLockSet.TryAcquire(infile); err != nil {
+		return err
+	}
+	defer namedLockSet.Release(infile)
+
+	outProbe, err := ffmpegutil.GetFfprobeInfo(outfile)
+	if err != nil {
+		return fmt.Errorf("probe output: %w", err)
+	}
+	if len(audioIndicesWithLanguage(outProbe, lang)) > 0 {
+		return errSkip
+	}
+	inProbe, err := ffmpegutil.GetFfprobeInfo(infile)
+	if err != nil {
+		return fmt.Errorf("probe source: %w", err)
+	}
+	missing := audioIndicesWithLanguage(inProbe, lang)
+	if len(missing) == 0 {
+		return errSkip
+	}
+	var crop ffmpegutil.Crop
+	if encode.Crop != "" {
+		if crop, err = ffmpegutil.ParseCrop(encode.Crop); err != nil {
+			return fmt.Errorf("logged crop: %w", err)
+		}
+	}
+
+	tmpfile := tempFilename(outfile)
+	if err := os.MkdirAll(filepath.Dir(tmpfile), 0755); err != nil {
+		return err
+	}
+	args, err := remuxAudioArgs(infile, outfile, tmpfile, missing)
+	if err != nil {
+		return err
+	}
+
+	zap.S().Infof("Item %q adding %d %s audio track(s) to %q: %s", infile, len(missing), lang, outfile, strings.Join(args, " "))
+	startTime := time.Now()
+	cmd := encoderCommand(ctx, args)
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	if *dockerImage == "" && len(*encodeEnv) > 0 {
+		cmd.Env = append(os.Environ(), *encodeEnv...)
+	}
+	if err := cmd.Run(); err != nil {
+		os.Remove(tmpfile)
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		return err
+	}
+	remuxProbe, err := ffmpegutil.GetFfprobeInfo(tmpfile)
+	if err == nil {
+		err = ffmpegutil.VerifyOutput(inProbe, remuxProbe, crop)
+	}
+	if err != nil {
+		os.Remove(tmpfile)
+		return fmt.Errorf("verify remux: %w", err)
+	}
+	info, err := os.Stat(tmpfile)
+	if err != nil {
+		return err
+	}
+	if err := os.Rename(tmpfile, outfile); err != nil {
+		return err
+	}
+
+	var added []encodelog.StreamDecision
+	for _, idx := range missing {
+		added = append(added, encodelog.StreamDecision{
+			Stream: fmt.Sprintf("0:a:%d", idx),
+			Action: "copy",
+			Reason: fmt.Sprintf("%s track missing from the output, added by -only-missing-audio-lang", lang),
+		})
+	}
+	return encodelog.AppendLog(logFile, remuxLogEntry(encode, args, startTime, time.Since(startTime), info.Size(), added))
+}
+
+// remuxLogEntry returns the log entry of an output remuxed by addMissingAudio. It supersedes encode, the entry of
+// the output's encode, so it keeps everything encode recorded e.g. its mode, sizes and scores and only replaces
+// what the remux changed.
+func remuxLogEntry(encode encodelog.LogFileEntry, args []string, start time.Time, duration time.Duration, outputSize int64, added []encodelog.StreamDecision) encodelog.LogFileEntry {
+	entry := encode
+	entry.Args = args
+	entry.StartTime = start.Format(time.RFC3339)
+	entry.Duration = duration.String()
+	entry.OutputSizeBytes = outputSize
+	entry.Decisions = append(slices.Clip(encode.Decisions), added...)
+	return entry
+}
+
+// remuxAudioArgs returns the ffmpeg command writing tmpfile with everything in outfile and the audio tracks missing
+// of infile, the N in 0:a:N. It runs in the -docker-image container if one is set, like encodes do.
+func remuxAudioArgs(infile, outfile, tmpfile string, missing []int) ([]string, error) {
+	existing, source, output := outfile, infile, tmpfile
+	var args []string
+	if *dockerImage != "" {
+		// the container writes into the mounted temp file so it must exist
+		if err := os.WriteFile(tmpfile, []byte{}, 0644); err != nil {
+			return nil, fmt.Errorf("failed to create output file: %w", err)
+		}
+		existing = "/existing" + filepath.Ext(outfile)
+		source = "/input" + filepath.Ext(infile)
+		output = "/output" + filepath.Ext(tmpfile)
+		dockerArgs, err := dockerRunArgs([]dockerMount{
+			{Host: outfile, Container: existing},
+			{Host: infile, Container: source},
+			{Host: tmpfile, Container: output, Writable: true},
+		})
+		if err != nil {
+			return nil, err
+		}
+		args = dockerArgs
+	}
+
+	args = append(args, "nice", "-n", "19", "ffmpeg", "-i", existing, "-i", source, "-map", "0")
+	for _, idx := range missing {
+		args = append(args, "-map", fmt.Sprintf("1:a:%d", idx))
+	}
+	return append(args, "-c", "copy", "-y", output), nil
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/garethgeorge/media-toolkit/internal/encodelog"
+)
+
+func TestRemuxAudioArgs(t *testing.T) {
+	args, err := remuxAudioArgs("/media/in.mkv", "/media/in-svtav1enc.mkv", "/media/tmp.mkv", []int{1})
+	if err != nil {
+		t.Fatalf("remuxAudioArgs() error: %v", err)
+	}
+	if !containsSeq(args, "-i", "/media/in-svtav1enc.mkv", "-i", "/media/in.mkv", "-map", "0", "-map", "1:a:1") || args[0] != "nice" {
+		t.Errorf("remuxAudioArgs() = %v, want nice ffmpeg on the host paths", args)
+	}
+
+	setFlag(t, dockerImage, "ffmpeg-image")
+	dir := t.TempDir()
+	infile, outfile, tmpfile := filepath.Join(dir, "in.mkv"), filepath.Join(dir, "in-svtav1enc.mkv"), filepath.Join(dir, "tmp.mkv")
+	args, err = remuxAudioArgs(infile, outfile, tmpfile, []int{1})
+	if err != nil {
+		t.Fatalf("remuxAudioArgs() error: %v", err)
+	}
+	for _, seq := range [][]string{
+		{"docker", "run", "--rm"},
+		{"-v", tmpfile + ":/output.mkv"},
+		{"ffmpeg-image", "nice", "-n", "19", "ffmpeg", "-i", "/existing.mkv", "-i", "/input.mkv"},
+		{"-y", "/output.mkv"},
+	} {
+		if !containsSeq(args, seq...) {
+			t.Errorf("remuxAudioArgs() with -docker-image = %v, want %v", args, seq)
+		}
+	}
+}
+
+func TestRemuxLogEntry(t *testing.T) {
+	encode := encodelog.LogFileEntry{
+		InputPath:       "/media/in.mkv",
+		OutputPath:      "/media/in-svtav1master.mkv",
+		StartTime:       "2024-01-01T00:00:00Z",
+		Args:            []string{"ffmpeg", "-i", "in.mkv"},
+		Mode:            modeMaster,
+		InputSizeBytes:  4000,
+		OutputSizeBytes: 1000,
+		VMAF:            97.5,
+		Decisions:       []encodelog.StreamDecision{{Stream: "0:v:0", Action: "encode"}},
+	}
+	added := []encodelog.StreamDecision{{Stream: "0:a:1", Action: "copy"}}
+	start := time.Date(2024, 2, 1, 0, 0, 0, 0, time.UTC)
+	entry := remuxLogEntry(encode, []string{"ffmpeg", "-c", "copy"}, start, time.Minute, 1200, added)
+
+	if entry.Mode != modeMaster || entry.InputSizeBytes != 4000 || entry.VMAF != 97.5 || entry.Key() != encode.Key() {
+		t.Errorf("remuxLogEntry() = %+v, want the encode's mode, input size, score and key", entry)
+	}
+	if entry.OutputSizeBytes != 1200 || entry.StartTime != "2024-02-01T00:00:00Z" || entry.Duration != "1m0s" || !slices.Contains(entry.Args, "copy") {
+		t.Errorf("remuxLogEntry() = %+v, want the remux's output size, time and args", entry)
+	}
+	if len(entry.Decisions) != 2 || entry.Decisions[1] != added[0] || len(encode.Decisions) != 1 {
+		t.Errorf("remuxLogEntry() decisions = %v, want the encode's followed by the added track", entry.Decisions)
+	}
+}
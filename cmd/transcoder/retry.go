@@ -0,0 +1,84 @@
+package main
+
+import (
+	"errors"
+	"os/exec"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// stderrTailSize is how much of the end of an encoder's stderr is kept to classify its failure.
+const stderrTailSize = 16 * 1024
+
+// encodeFailure is an encoder run that exited unsuccessfully, carrying the end of its stderr.
+type encodeFailure struct {
+	err    error
+	stderr string
+}
+
+func (f *encodeFailure) Error() string { return f.err.Error() }
+func (f *encodeFailure) Unwrap() error { return f.err }
+
+// tailBuffer keeps the last max bytes written to it.
+type tailBuffer struct {
+	max int
+	buf []byte
+}
+
+func (t *tailBuffer) Write(p []byte) (int, error) {
+	t.buf = append(t.buf, p...)
+	if over := len(t.buf) - t.max; over > 0 {
+		t.buf = append(t.buf[:0], t.buf[over:]...)
+	}
+	return len(p), nil
+}
+
+func (t *tailBuffer) String() string { return string(t.buf) }
+
+// transientMessages in an encoder's stderr point at a failure of the machine rather than the input, an encode of
+// the same file may succeed when run again.
+var transientMessages = []string{
+	"Cannot allocate memory",
+	"Out of memory",
+	"Resource temporarily unavailable",
+	"Input/output error",
+	"Stale file handle",
+	"Connection reset by peer",
+	"Cannot connect to the Docker daemon",
+	"error during connect",
+}
+
+// transientFailure reports whether a failed encode is worth retrying: the encoder was killed, typically by the
+// out-of-memory killer, or its stderr shows a resource or I/O error. Anything else, e.g. an unsupported codec or
+// corrupt input, fails the same way every time. An encode stopped by -timeout is never retried.
+func transientFailure(err error) bool {
+	var timeout *timeoutError
+	if errors.As(err, &timeout) {
+		return false
+	}
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		if status, ok := exitErr.Sys().(syscall.WaitStatus); ok && status.Signaled() && status.Signal() == syscall.SIGKILL {
+			return true
+		}
+		if exitErr.ExitCode() == 137 { // docker reports a container killed by SIGKILL as 128+9
+			return true
+		}
+	}
+	var failure *encodeFailure
+	if !errors.As(err, &failure) {
+		return false
+	}
+	for _, msg := range transientMessages {
+		if strings.Contains(failure.stderr, msg) {
+			return true
+		}
+	}
+	return false
+}
+
+// retryDelay is the backoff before retry number attempt, -retry-backoff doubling with every attempt.
+func retryDelay(attempt int) time.Duration {
+	return *retryBackoff << (attempt - 1)
+}
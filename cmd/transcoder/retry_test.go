@@ -0,0 +1,52 @@
+package main
+
+import (
+	"errors"
+	"os/exec"
+	"testing"
+	"time"
+)
+
+func TestTransientFailure(t *testing.T) {
+	killed := exec.Command("sh", "-c", "kill -9 $$").Run()
+	exited := exec.Command("sh", "-c", "exit 1").Run()
+	if killed == nil || exited == nil {
+		t.Fatalf("test commands succeeded, want failures")
+	}
+
+	for _, tc := range []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{"killed", &encodeFailure{err: killed}, true},
+		{"out of memory", &encodeFailure{err: exited, stderr: "[libsvtav1 @ 0x1] Cannot allocate memory\n"}, true},
+		{"docker daemon", &encodeFailure{err: exited, stderr: "docker: Cannot connect to the Docker daemon at unix:///var/run/docker.sock.\n"}, true},
+		{"unsupported codec", &encodeFailure{err: exited, stderr: "Decoder (codec none) not found for input stream #0:0\n"}, false},
+		{"corrupt input", &encodeFailure{err: exited, stderr: "Invalid data found when processing input\n"}, false},
+		{"not an encode failure", errors.New("Cannot allocate memory"), false},
+	} {
+		if got := transientFailure(tc.err); got != tc.want {
+			t.Errorf("transientFailure(%s) = %v, want %v", tc.name, got, tc.want)
+		}
+	}
+}
+
+func TestTailBuffer(t *testing.T) {
+	tail := &tailBuffer{max: 8}
+	tail.Write([]byte("first line\n"))
+	tail.Write([]byte("last\n"))
+	if got := tail.String(); got != "ne\nlast\n" {
+		t.Errorf("tail = %q, want the last 8 bytes", got)
+	}
+}
+
+func TestRetryDelay(t *testing.T) {
+	setFlag(t, retryBackoff, 30*time.Second)
+	if got := retryDelay(1); got != 30*time.Second {
+		t.Errorf("retryDelay(1) = %s, want 30s", got)
+	}
+	if got := retryDelay(3); got != 2*time.Minute {
+		t.Errorf("retryDelay(3) = %s, want 2m", got)
+	}
+}
@@ -0,0 +1,47 @@
+package main
+
+import (
+	"strconv"
+
+	"github.com/garethgeorge/media-toolkit/internal/encodelog"
+	"github.com/garethgeorge/media-toolkit/internal/ffmpegutil"
+	"go.uber.org/zap"
+)
+
+// sampleInfix marks the output of a -sample-duration encode e.g. movie-svtav1enc.sample.mkv so that it isn't
+// mistaken for a full encode.
+const sampleInfix = ".sample"
+
+// sampling reports whether encodes are cut short by -sample-duration. Samples are for comparing settings, nothing
+// about them is written to the log so a later full run encodes the file as usual.
+func sampling() bool {
+	return *sampleDuration > 0
+}
+
+// sampleArgs returns the ffmpeg output options that stop the encode after -sample-duration.
+func sampleArgs() []string {
+	if !sampling() {
+		return nil
+	}
+	return []string{"-t", strconv.FormatFloat(sampleDuration.Seconds(), 'f', -1, 64)}
+}
+
+// encodedSeconds returns how much of the source an encode covers, 0 if unknown.
+func encodedSeconds(probeData ffmpegutil.ProbeData) float64 {
+	total := probeData.GetDurationSeconds()
+	if sampling() && (total <= 0 || sampleDuration.Seconds() < total) {
+		return sampleDuration.Seconds()
+	}
+	return total
+}
+
+// appendEncodeLog appends the log entry of an encode, samples aren't logged.
+func appendEncodeLog(logFile string, entry encodelog.LogFileEntry) {
+	if sampling() {
+		zap.S().Debugf("Item %q sample encode, not logging it", entry.InputPath)
+		return
+	}
+	if err := encodelog.AppendLog(logFile, entry); err != nil {
+		zap.S().Warnf("Log write error %q: %v", entry.InputPath, err)
+	}
+}
@@ -0,0 +1,42 @@
+package main
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// shutdownGracePeriod is how long an encoder gets to exit after SIGTERM before it is killed.
+const shutdownGracePeriod = 10 * time.Second
+
+// notifyShutdown returns a context cancelled on the first SIGINT or SIGTERM. Later signals are no longer caught so
+// a second Ctrl-C exits immediately.
+func notifyShutdown() (context.Context, context.CancelFunc) {
+	ctx, cancel := context.WithCancel(context.Background())
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		select {
+		case sig := <-signals:
+			zap.S().Warnf("Received %v, shutting down gracefully: stopping running encodes and removing their partial outputs. Signal again to exit immediately.", sig)
+			cancel()
+		case <-ctx.Done():
+		}
+		signal.Stop(signals)
+	}()
+	return ctx, cancel
+}
+
+// encoderCommand returns a command that is sent SIGTERM when ctx is cancelled and killed if it hasn't exited
+// within shutdownGracePeriod. docker run forwards the signal into the container.
+func encoderCommand(ctx context.Context, args []string) *exec.Cmd {
+	cmd := exec.CommandContext(ctx, args[0], args[1:]...)
+	cmd.Cancel = func() error { return cmd.Process.Signal(syscall.SIGTERM) }
+	cmd.WaitDelay = shutdownGracePeriod
+	return cmd
+}
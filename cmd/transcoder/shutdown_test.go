@@ -0,0 +1,23 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestEncoderCommandTerminatedOnCancel(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cmd := encoderCommand(ctx, []string{"sleep", "30"})
+	if err := cmd.Start(); err != nil {
+		t.Skipf("sleep unavailable: %v", err)
+	}
+	start := time.Now()
+	cancel()
+	if err := cmd.Wait(); err == nil {
+		t.Errorf("Wait() after cancel = nil, want an error")
+	}
+	if elapsed := time.Since(start); elapsed >= shutdownGracePeriod {
+		t.Errorf("command took %s to exit after cancel, want it terminated by SIGTERM", elapsed)
+	}
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"github.com/garethgeorge/media-toolkit/internal/ffmpegutil"
+	"github.com/garethgeorge/media-toolkit/internal/fsutil"
+)
+
+// -sidecar formats
+const (
+	sidecarJSON = "json"
+	sidecarNFO  = "nfo"
+)
+
+// sidecarInfo is the metadata written next to outputs for media managers that prefer sidecars to probing.
+type sidecarInfo struct {
+	Width           int      `json:"width"`
+	Height          int      `json:"height"`
+	VideoCodec      string   `json:"video_codec"`
+	DurationSeconds float64  `json:"duration_seconds"`
+	AudioLanguages  []string `json:"audio_languages"`
+	HDR             bool     `json:"hdr"`
+}
+
+func sidecarInfoFromProbe(probeData ffmpegutil.ProbeData) sidecarInfo {
+	videoStream := probeData.GetPrimaryVideoStream()
+	info := sidecarInfo{
+		Width:           videoStream.Width,
+		Height:          videoStream.Height,
+		VideoCodec:      videoStream.CodecName,
+		DurationSeconds: probeData.GetDurationSeconds(),
+		AudioLanguages:  []string{},
+		HDR:             probeData.HasHDR(),
+	}
+	for _, stream := range probeData.Streams {
+		if stream.IsAudio() {
+			info.AudioLanguages = append(info.AudioLanguages, normalizeLanguage(stream.Tags.Language))
+		}
+	}
+	return info
+}
+
+// kodiFileInfo mirrors the fileinfo section of a Kodi style .nfo file.
+type kodiFileInfo struct {
+	XMLName xml.Name `xml:"fileinfo"`
+	Video   struct {
+		Codec          string `xml:"codec"`
+		Width          int    `xml:"width"`
+		Height         int    `xml:"height"`
+		DurationInSecs int    `xml:"durationinseconds"`
+		HDRType        string `xml:"hdrtype,omitempty"`
+	} `xml:"streamdetails>video"`
+	Audio []struct {
+		Language string `xml:"language"`
+	} `xml:"streamdetails>audio"`
+}
+
+// sidecarPath returns the sidecar's path, the output's name with the format as its extension.
+func sidecarPath(outfile, format string) string {
+	return strings.TrimSuffix(outfile, filepath.Ext(outfile)) + "." + format
+}
+
+func marshalSidecar(format string, info sidecarInfo) ([]byte, error) {
+	switch format {
+	case sidecarJSON:
+		return json.MarshalIndent(info, "", "  ")
+	case sidecarNFO:
+		var nfo kodiFileInfo
+		nfo.Video.Codec = info.VideoCodec
+		nfo.Video.Width = info.Width
+		nfo.Video.Height = info.Height
+		nfo.Video.DurationInSecs = int(info.DurationSeconds)
+		if info.HDR {
+			nfo.Video.HDRType = "hdr10"
+		}
+		for _, lang := range info.AudioLanguages {
+			nfo.Audio = append(nfo.Audio, struct {
+				Language string `xml:"language"`
+			}{Language: lang})
+		}
+		data, err := xml.MarshalIndent(nfo, "", "  ")
+		if err != nil {
+			return nil, err
+		}
+		return append([]byte(xml.Header), data...), nil
+	default:
+		return nil, fmt.Errorf("unknown sidecar format %q, must be json or nfo", format)
+	}
+}
+
+// writeSidecar probes the finished output and writes its metadata next to it.
+func writeSidecar(format, outfile string) error {
+	probeData, err := ffmpegutil.GetFfprobeInfo(outfile)
+	if err != nil {
+		return err
+	}
+	data, err := marshalSidecar(format, sidecarInfoFromProbe(probeData))
+	if err != nil {
+		return err
+	}
+	return fsutil.WriteFileAtomic(sidecarPath(outfile, format), data, 0644)
+}
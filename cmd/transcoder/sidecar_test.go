@@ -0,0 +1,34 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestMarshalSidecar(t *testing.T) {
+	info := sidecarInfoFromProbe(mustParseProbe(t, threeLanguageProbe))
+
+	data, err := marshalSidecar(sidecarJSON, info)
+	if err != nil {
+		t.Fatalf("marshalSidecar(json) error: %v", err)
+	}
+	for _, want := range []string{`"width": 1920`, `"video_codec": "h264"`, `"fre"`, `"hdr": false`} {
+		if !strings.Contains(string(data), want) {
+			t.Errorf("json sidecar missing %s:\n%s", want, data)
+		}
+	}
+
+	data, err = marshalSidecar(sidecarNFO, info)
+	if err != nil {
+		t.Fatalf("marshalSidecar(nfo) error: %v", err)
+	}
+	for _, want := range []string{"<fileinfo>", "<codec>h264</codec>", "<language>jpn</language>"} {
+		if !strings.Contains(string(data), want) {
+			t.Errorf("nfo sidecar missing %s:\n%s", want, data)
+		}
+	}
+
+	if got := sidecarPath("/media/movie-svtav1enc.mkv", sidecarNFO); got != "/media/movie-svtav1enc.nfo" {
+		t.Errorf("sidecarPath() = %q", got)
+	}
+}
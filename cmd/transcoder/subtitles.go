@@ -0,0 +1,108 @@
+package main
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/garethgeorge/media-toolkit/internal/encodelog"
+	"github.com/garethgeorge/media-toolkit/internal/ffmpegutil"
+)
+
+// -subtitle-mode values.
+const (
+	subtitleModeCopy     = "copy"      // copy every subtitle stream
+	subtitleModeTextOnly = "text-only" // copy text subtitles, drop image based ones such as PGS and VOBSUB
+	subtitleModeNone     = "none"      // drop every subtitle stream
+)
+
+// subtitleOptions controls which source subtitle streams are copied.
+type subtitleOptions struct {
+	Mode      string   // one of the subtitle modes, empty behaves as copy
+	Codecs    []string // if set keep only streams with these codecs
+	Languages []string // if set keep only streams in these languages, und matching untagged streams
+	Container outputContainer
+}
+
+func subtitleOptionsFromFlags() subtitleOptions {
+	return subtitleOptions{
+		Mode:      *subtitleMode,
+		Codecs:    parseList(*subCodecs),
+		Languages: parseList(*subtitleLangs),
+		Container: containerFor(outputExtension()),
+	}
+}
+
+// validateSubtitleMode checks a -subtitle-mode value.
+func validateSubtitleMode(mode string) error {
+	switch mode {
+	case subtitleModeCopy, subtitleModeTextOnly, subtitleModeNone:
+		return nil
+	}
+	return fmt.Errorf("%q must be copy, text-only or none", mode)
+}
+
+// planSubtitles returns the indices among the source's subtitle streams (the N in 0:s:N) to copy into the output.
+// Streams excluded by the mode, the codec allowlist or the language allowlist are dropped.
+func planSubtitles(probeData ffmpegutil.ProbeData, opts subtitleOptions) ([]int, []encodelog.StreamDecision) {
+	var keep []int
+	var decisions []encodelog.StreamDecision
+
+	for idx, stream := range probeData.Streams {
+		if !stream.IsSubtitle() {
+			continue
+		}
+		subIdx := probeData.MapStreamIdx("subtitle", idx)
+		specifier := fmt.Sprintf("0:s:%d", subIdx)
+		lang := normalizeLanguage(stream.Tags.Language)
+
+		reason := ""
+		switch {
+		case opts.Mode == subtitleModeNone:
+			reason = "-subtitle-mode none"
+		case opts.Mode == subtitleModeTextOnly && !stream.IsTextSubtitle():
+			reason = fmt.Sprintf("codec %s isn't text, -subtitle-mode text-only", stream.CodecName)
+		case !opts.Container.ImageSubtitles && opts.Container.Ext != "" && !stream.IsTextSubtitle():
+			reason = fmt.Sprintf("codec %s can't be carried in %s outputs", stream.CodecName, opts.Container.Ext)
+		case len(opts.Codecs) > 0 && !slices.Contains(opts.Codecs, strings.ToLower(stream.CodecName)):
+			reason = fmt.Sprintf("codec %s not in -sub-codecs", stream.CodecName)
+		case len(opts.Languages) > 0 && !slices.Contains(opts.Languages, lang):
+			reason = fmt.Sprintf("language %s not in -subtitle-langs", lang)
+		}
+		if reason != "" {
+			decisions = append(decisions, encodelog.StreamDecision{Stream: specifier, Action: "drop", Reason: reason})
+			continue
+		}
+		keep = append(keep, subIdx)
+		decisions = append(decisions, encodelog.StreamDecision{Stream: specifier, Action: "copy", Reason: fmt.Sprintf("%s %s", lang, stream.CodecName)})
+	}
+
+	return keep, decisions
+}
+
+// subtitleArgs maps the kept subtitle streams, converting them to codec if set and otherwise copying them.
+func subtitleArgs(keep []int, codec string) []string {
+	if len(keep) == 0 {
+		return nil
+	}
+	var args []string
+	for _, idx := range keep {
+		args = append(args, "-map", fmt.Sprintf("0:s:%d", idx))
+	}
+	if codec == "" {
+		codec = "copy"
+	}
+	return append(args, "-c:s", codec)
+}
+
+// parseList splits a comma separated flag value into its lowercased, trimmed, non-empty elements.
+func parseList(value string) []string {
+	var list []string
+	for _, item := range strings.Split(value, ",") {
+		item = strings.ToLower(strings.TrimSpace(item))
+		if item != "" {
+			list = append(list, item)
+		}
+	}
+	return list
+}
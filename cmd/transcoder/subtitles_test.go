@@ -0,0 +1,98 @@
+package main
+
+import (
+	"slices"
+	"testing"
+
+	"github.com/garethgeorge/media-toolkit/internal/encodelog"
+)
+
+const subtitleProbe = `{
+	"format": {"bit_rate": "8000000"},
+	"streams": [
+		{"codec_type": "video", "codec_name": "h264", "width": 1920, "height": 1080},
+		{"codec_type": "audio", "codec_name": "aac", "channels": 2, "tags": {"language": "eng"}},
+		{"codec_type": "subtitle", "codec_name": "dvb_subtitle", "tags": {"language": "eng"}},
+		{"codec_type": "subtitle", "codec_name": "subrip", "tags": {"language": "eng"}}
+	]
+}`
+
+func TestSubtitleCodecAllowlist(t *testing.T) {
+	setFlag(t, subCodecs, "subrip, ASS")
+
+	pd := mustParseProbe(t, subtitleProbe)
+	args, decisions, err := createFfmpegCommand(pd, "in.ts", "out.mkv")
+	if err != nil {
+		t.Fatalf("createFfmpegCommand() error: %v", err)
+	}
+
+	if !containsSeq(args, "-map", "0:s:1") {
+		t.Errorf("expected allowed subrip stream 0:s:1 to be mapped: %v", args)
+	}
+	if containsSeq(args, "-map", "0:s:0") {
+		t.Errorf("expected disallowed dvb_subtitle stream 0:s:0 to be dropped: %v", args)
+	}
+	if !slices.ContainsFunc(decisions, func(d encodelog.StreamDecision) bool { return d.Stream == "0:s:0" && d.Action == "drop" }) {
+		t.Errorf("expected a drop decision for 0:s:0: %v", decisions)
+	}
+}
+
+func TestSubtitlesCopiedByDefault(t *testing.T) {
+	pd := mustParseProbe(t, subtitleProbe)
+	args, _, err := createFfmpegCommand(pd, "in.ts", "out.mkv")
+	if err != nil {
+		t.Fatalf("createFfmpegCommand() error: %v", err)
+	}
+	if !containsSeq(args, "-map", "0:s:0") || !containsSeq(args, "-map", "0:s:1") || !containsSeq(args, "-c:s", "copy") {
+		t.Errorf("expected all subtitles to be copied: %v", args)
+	}
+}
+
+func TestPlanSubtitlesModeAndLanguages(t *testing.T) {
+	pd := mustParseProbe(t, `{
+		"streams": [
+			{"codec_type": "video", "codec_name": "h264"},
+			{"codec_type": "subtitle", "codec_name": "hdmv_pgs_subtitle", "tags": {"language": "eng"}},
+			{"codec_type": "subtitle", "codec_name": "subrip", "tags": {"language": "eng"}},
+			{"codec_type": "subtitle", "codec_name": "ass", "tags": {"language": "jpn"}},
+			{"codec_type": "subtitle", "codec_name": "mov_text"}
+		]
+	}`)
+
+	tests := []struct {
+		name string
+		opts subtitleOptions
+		want []int
+	}{
+		{name: "copy", opts: subtitleOptions{Mode: subtitleModeCopy}, want: []int{0, 1, 2, 3}},
+		{name: "text only", opts: subtitleOptions{Mode: subtitleModeTextOnly}, want: []int{1, 2, 3}},
+		{name: "none", opts: subtitleOptions{Mode: subtitleModeNone}, want: nil},
+		{name: "languages", opts: subtitleOptions{Mode: subtitleModeCopy, Languages: []string{"eng", "und"}}, want: []int{0, 1, 3}},
+		{name: "text only languages", opts: subtitleOptions{Mode: subtitleModeTextOnly, Languages: []string{"jpn"}}, want: []int{2}},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			keep, decisions := planSubtitles(pd, tc.opts)
+			if !slices.Equal(keep, tc.want) {
+				t.Errorf("planSubtitles() = %v, want %v", keep, tc.want)
+			}
+			if len(decisions) != 4 {
+				t.Errorf("planSubtitles() decisions = %v, want one per subtitle stream", decisions)
+			}
+		})
+	}
+
+	if err := validateSubtitleMode("image-only"); err == nil {
+		t.Errorf("validateSubtitleMode(\"image-only\") succeeded, want an error")
+	}
+}
+
+// containsSeq reports whether seq appears contiguously in args.
+func containsSeq(args []string, seq ...string) bool {
+	for i := 0; i+len(seq) <= len(args); i++ {
+		if slices.Equal(args[i:i+len(seq)], seq) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,132 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
+	"text/tabwriter"
+	"time"
+
+	"github.com/garethgeorge/media-toolkit/internal/fsutil"
+	"github.com/garethgeorge/media-toolkit/internal/metrics"
+	"go.uber.org/zap"
+)
+
+// runSummary counts what happened to each file of a run, it is safe for concurrent use by -jobs encodes. The counts
+// are also added to the -metrics-addr metrics, which keep counting across -watch.
+type runSummary struct {
+	mu     sync.Mutex
+	start  time.Time
+	report summaryReport
+}
+
+// summaryReport is the summary printed at the end of a run and written by -json-summary.
+type summaryReport struct {
+	Encoded     int     `json:"encoded"`      // encodes that finished, or would be started in a dry run
+	Skipped     int     `json:"skipped"`      // files skipped this run e.g. already AV1 or low bitrate
+	Failed      int     `json:"failed"`       // files whose probe or encode failed
+	AlreadyDone int     `json:"already_done"` // files with a log entry from an earlier run
+	InputBytes  int64   `json:"input_bytes"`  // size of the sources of the finished encodes
+	OutputBytes int64   `json:"output_bytes"` // size of the finished encodes
+	WallSeconds float64 `json:"wall_seconds"`
+}
+
+// summary is the summary of this run.
+var summary = &runSummary{start: time.Now()}
+
+func (s *runSummary) Encoded(inputBytes, outputBytes int64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.report.Encoded++
+	s.report.InputBytes += inputBytes
+	s.report.OutputBytes += outputBytes
+
+	metrics.FilesProcessed.Inc(metrics.OutcomeEncoded)
+	if inputBytes > 0 && outputBytes > 0 {
+		metrics.InputBytes.Add(float64(inputBytes))
+		// an encode larger than its source saves nothing, a counter must never decrease
+		metrics.BytesSaved.Add(float64(max(inputBytes-outputBytes, 0)))
+	}
+}
+
+func (s *runSummary) Skipped() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.report.Skipped++
+	metrics.FilesProcessed.Inc(metrics.OutcomeSkipped)
+}
+
+func (s *runSummary) Failed() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.report.Failed++
+	metrics.FilesProcessed.Inc(metrics.OutcomeFailed)
+}
+
+func (s *runSummary) AlreadyDone() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.report.AlreadyDone++
+	metrics.FilesProcessed.Inc(metrics.OutcomeAlreadyDone)
+}
+
+// Reset clears the counts and restarts the wall time, -watch reports each batch of new files on its own.
+func (s *runSummary) Reset() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.report = summaryReport{}
+	s.start = time.Now()
+}
+
+// Report returns the counts so far and the time since the run started.
+func (s *runSummary) Report() summaryReport {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	report := s.report
+	report.WallSeconds = time.Since(s.start).Seconds()
+	return report
+}
+
+// String formats the report as a table.
+func (r summaryReport) String() string {
+	var b strings.Builder
+	w := tabwriter.NewWriter(&b, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(w, "Encoded\t%d\n", r.Encoded)
+	fmt.Fprintf(w, "Skipped\t%d\n", r.Skipped)
+	fmt.Fprintf(w, "Failed\t%d\n", r.Failed)
+	fmt.Fprintf(w, "Already done\t%d\n", r.AlreadyDone)
+	fmt.Fprintf(w, "Input\t%s\n", fsutil.FormatBytes(r.InputBytes))
+	fmt.Fprintf(w, "Output\t%s\n", fsutil.FormatBytes(r.OutputBytes))
+	if r.InputBytes > 0 {
+		saved := r.InputBytes - r.OutputBytes
+		fmt.Fprintf(w, "Saved\t%s (%.0f%%)\n", fsutil.FormatBytes(saved), 100*float64(saved)/float64(r.InputBytes))
+	}
+	fmt.Fprintf(w, "Wall time\t%s\n", time.Duration(r.WallSeconds*float64(time.Second)).Round(time.Second))
+	w.Flush()
+	return b.String()
+}
+
+// writeJSONSummary writes the report as a JSON object for scripts.
+func writeJSONSummary(filename string, r summaryReport) error {
+	data, err := json.MarshalIndent(r, "", "  ")
+	if err != nil {
+		return err
+	}
+	return fsutil.WriteFileAtomic(filename, append(data, '\n'), 0644)
+}
+
+// printSummary prints the summary of the run and writes it to -json-summary if set.
+func printSummary() {
+	report := summary.Report()
+	title := "Summary"
+	if *dryRun {
+		title = "Dry run summary, encoded counts the files that would be encoded"
+	}
+	fmt.Printf("%s:\n%s", title, report)
+	if *jsonSummary != "" {
+		if err := writeJSONSummary(*jsonSummary, report); err != nil {
+			zap.S().Warnf("Error writing JSON summary %q: %v", *jsonSummary, err)
+		}
+	}
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/garethgeorge/media-toolkit/internal/metrics"
+)
+
+func TestRunSummary(t *testing.T) {
+	s := &runSummary{start: time.Now().Add(-90 * time.Second)}
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			s.Encoded(1000, 400)
+			s.Skipped()
+		}()
+	}
+	wg.Wait()
+	s.Failed()
+	s.AlreadyDone()
+
+	report := s.Report()
+	if report.Encoded != 10 || report.Skipped != 10 || report.Failed != 1 || report.AlreadyDone != 1 {
+		t.Errorf("Report() = %+v, want 10 encoded, 10 skipped, 1 failed, 1 already done", report)
+	}
+	if report.InputBytes != 10000 || report.OutputBytes != 4000 {
+		t.Errorf("Report() bytes = %d in %d out, want 10000 and 4000", report.InputBytes, report.OutputBytes)
+	}
+	table := report.String()
+	for _, want := range []string{"Encoded       10", "Saved         5.9 KiB (60%)", "Wall time     1m30s"} {
+		if !strings.Contains(table, want) {
+			t.Errorf("summary table missing %q:\n%s", want, table)
+		}
+	}
+
+	s.Reset()
+	if report := s.Report(); report.Encoded != 0 || report.Skipped != 0 || report.InputBytes != 0 || report.WallSeconds > 60 {
+		t.Errorf("Report() after Reset() = %+v, want empty", report)
+	}
+
+	path := filepath.Join(t.TempDir(), "summary.json")
+	if err := writeJSONSummary(path, report); err != nil {
+		t.Fatalf("writeJSONSummary() error: %v", err)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var decoded summaryReport
+	if err := json.Unmarshal(data, &decoded); err != nil || decoded != report {
+		t.Errorf("JSON summary = %s, %v, want %+v", data, err, report)
+	}
+}
+
+func TestBytesSavedNeverDecreases(t *testing.T) {
+	s := &runSummary{start: time.Now()}
+	before := metrics.BytesSaved.Value()
+	s.Encoded(1000, 1500)
+	if got := metrics.BytesSaved.Value(); got != before {
+		t.Errorf("BytesSaved after an encode larger than its source = %v, want it unchanged at %v", got, before)
+	}
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// svtav1Params builds the colon separated key=value list passed to ffmpeg's -svtav1-params. Keys keep the order
+// they are first set in, setting a key again replaces its value.
+type svtav1Params struct {
+	keys   []string
+	values map[string]string
+}
+
+func (p *svtav1Params) Set(key, value string) {
+	if p.values == nil {
+		p.values = make(map[string]string)
+	}
+	if _, ok := p.values[key]; !ok {
+		p.keys = append(p.keys, key)
+	}
+	p.values[key] = value
+}
+
+func (p *svtav1Params) String() string {
+	pairs := make([]string, 0, len(p.keys))
+	for _, key := range p.keys {
+		pairs = append(pairs, key+"="+p.values[key])
+	}
+	return strings.Join(pairs, ":")
+}
+
+// SVT-AV1 tune modes. Visual quality tuning favors how the output looks over objective metrics, PSNR and SSIM
+// tuning maximize their metric which tends to look softer but suits metric driven comparisons.
+const (
+	tuneVQ   = 0
+	tunePSNR = 1
+	tuneSSIM = 2
+)
+
+func validateTune(tune int) error {
+	if tune < tuneVQ || tune > tuneSSIM {
+		return fmt.Errorf("tune %d must be 0 (visual quality), 1 (PSNR) or 2 (SSIM)", tune)
+	}
+	return nil
+}
+
+// validateKeyint checks a -keyint value, either a frame count e.g. 240 or a duration in whole seconds e.g. 10s.
+func validateKeyint(keyint string) error {
+	value := strings.TrimSuffix(keyint, "s")
+	if n, err := strconv.Atoi(value); err != nil || n < -2 {
+		return fmt.Errorf("keyint %q must be a frame count or seconds e.g. 240 or 10s", keyint)
+	}
+	return nil
+}
+
+// Keyframe placement modes for -force-keyframes in addition to a fixed interval.
+const forceKeyframesSceneCut = "scenecut"
+
+// forceKeyframesArgs returns the ffmpeg arguments and svtav1 params implementing a -force-keyframes mode: either
+// scenecut to insert keyframes at scene changes or an interval e.g. 5s to insert one every 5 seconds.
+func forceKeyframesArgs(mode string, params *svtav1Params) ([]string, error) {
+	if mode == "" {
+		return nil, nil
+	}
+	if mode == forceKeyframesSceneCut {
+		params.Set("scd", "1")
+		return nil, nil
+	}
+	interval, err := time.ParseDuration(mode)
+	if err != nil || interval <= 0 {
+		return nil, fmt.Errorf("force keyframes %q must be scenecut or a positive interval e.g. 5s", mode)
+	}
+	return []string{"-force_key_frames", fmt.Sprintf("expr:gte(t,n_forced*%g)", interval.Seconds())}, nil
+}
+
+// -video-threads value that divides the machine's cores among concurrent encodes.
+const videoThreadsAuto = "auto"
+
+// resolveVideoThreads converts a -video-threads value into the SVT-AV1 lp (level of parallelism) for each encode,
+// 0 leaves the encoder default. With auto, cores are divided evenly among jobs concurrent encodes. SVT-AV1 stops
+// scaling well somewhere past 16 threads so several capped encodes make better use of a large machine.
+func resolveVideoThreads(spec string, cores, jobs int) (int, error) {
+	switch spec {
+	case "":
+		return 0, nil
+	case videoThreadsAuto:
+		return max(1, cores/max(1, jobs)), nil
+	}
+	n, err := strconv.Atoi(spec)
+	if err != nil || n < 1 {
+		return 0, fmt.Errorf("video threads %q must be a positive number or auto", spec)
+	}
+	return n, nil
+}
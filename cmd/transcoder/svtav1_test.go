@@ -0,0 +1,74 @@
+package main
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestSvtav1Params(t *testing.T) {
+	var params svtav1Params
+	params.Set("tune", "0")
+	params.Set("film-grain", "8")
+	params.Set("keyint", "10s")
+	params.Set("tune", "1")
+
+	if got, want := params.String(), "tune=1:film-grain=8:keyint=10s"; got != want {
+		t.Errorf("svtav1Params.String() = %q, want %q", got, want)
+	}
+}
+
+func TestForceKeyframesArgs(t *testing.T) {
+	var params svtav1Params
+	args, err := forceKeyframesArgs("scenecut", &params)
+	if err != nil || args != nil || params.String() != "scd=1" {
+		t.Errorf("forceKeyframesArgs(scenecut) = %v, %v with params %q", args, err, params.String())
+	}
+
+	args, err = forceKeyframesArgs("5s", &svtav1Params{})
+	if want := []string{"-force_key_frames", "expr:gte(t,n_forced*5)"}; err != nil || !slices.Equal(args, want) {
+		t.Errorf("forceKeyframesArgs(5s) = %v, %v, want %v", args, err, want)
+	}
+
+	if _, err := forceKeyframesArgs("often", &svtav1Params{}); err == nil {
+		t.Errorf("forceKeyframesArgs(often) expected an error")
+	}
+}
+
+func TestValidateKeyint(t *testing.T) {
+	for _, valid := range []string{"240", "10s", "-1"} {
+		if err := validateKeyint(valid); err != nil {
+			t.Errorf("validateKeyint(%q) error: %v", valid, err)
+		}
+	}
+	for _, invalid := range []string{"", "ten", "10m"} {
+		if err := validateKeyint(invalid); err == nil {
+			t.Errorf("validateKeyint(%q) expected an error", invalid)
+		}
+	}
+}
+
+func TestResolveVideoThreads(t *testing.T) {
+	tests := []struct {
+		spec  string
+		cores int
+		jobs  int
+		want  int
+	}{
+		{spec: "", cores: 32, jobs: 1, want: 0},
+		{spec: "auto", cores: 32, jobs: 1, want: 32},
+		{spec: "auto", cores: 32, jobs: 3, want: 10},
+		{spec: "auto", cores: 2, jobs: 4, want: 1},
+		{spec: "8", cores: 32, jobs: 4, want: 8},
+	}
+	for _, tc := range tests {
+		got, err := resolveVideoThreads(tc.spec, tc.cores, tc.jobs)
+		if err != nil || got != tc.want {
+			t.Errorf("resolveVideoThreads(%q, %d, %d) = %d, %v, want %d", tc.spec, tc.cores, tc.jobs, got, err, tc.want)
+		}
+	}
+	for _, invalid := range []string{"0", "many"} {
+		if _, err := resolveVideoThreads(invalid, 32, 1); err == nil {
+			t.Errorf("resolveVideoThreads(%q) expected an error", invalid)
+		}
+	}
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+const thermalPollInterval = 30 * time.Second
+
+// readThermalSensor reads a temperature in degrees celsius from a sysfs style sensor file e.g.
+// /sys/class/thermal/thermal_zone0/temp.
+func readThermalSensor(path string) (float64, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return 0, err
+	}
+	return parseThermalValue(string(data))
+}
+
+// parseThermalValue parses a sensor reading. sysfs reports millidegrees, values that are implausibly high for
+// degrees are assumed to be millidegrees.
+func parseThermalValue(value string) (float64, error) {
+	temp, err := strconv.ParseFloat(strings.TrimSpace(value), 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid thermal sensor reading %q: %w", value, err)
+	}
+	if temp > 1000 {
+		temp /= 1000
+	}
+	return temp, nil
+}
+
+// waitForCooldown blocks while the thermal sensor reads above -thermal-max, resuming once it drops to
+// -thermal-resume or ctx is cancelled. It is a no-op without -thermal-sensor. Sensor errors are logged and don't block
+// encoding.
+func waitForCooldown(ctx context.Context) {
+	if *thermalSensor == "" {
+		return
+	}
+	temp, err := readThermalSensor(*thermalSensor)
+	if err != nil {
+		zap.S().Warnf("Error reading thermal sensor: %v", err)
+		return
+	}
+	if temp < *thermalMax {
+		return
+	}
+
+	zap.S().Warnf("Temperature %.1f°C is above %.1f°C, pausing until it drops to %.1f°C", temp, *thermalMax, *thermalResume)
+	pausedAt := time.Now()
+	for temp > *thermalResume {
+		select {
+		case <-ctx.Done():
+			zap.S().Infof("Shutting down while paused for the temperature to drop")
+			return
+		case <-time.After(thermalPollInterval):
+		}
+		temp, err = readThermalSensor(*thermalSensor)
+		if err != nil {
+			zap.S().Warnf("Error reading thermal sensor, resuming: %v", err)
+			return
+		}
+	}
+	zap.S().Infof("Temperature %.1f°C, resuming after pausing for %s", temp, time.Since(pausedAt).Round(time.Second))
+}
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestParseThermalValue(t *testing.T) {
+	tests := []struct {
+		value   string
+		want    float64
+		wantErr bool
+	}{
+		{value: "54000\n", want: 54},
+		{value: "71.5", want: 71.5},
+		{value: "hot", wantErr: true},
+	}
+	for _, tc := range tests {
+		got, err := parseThermalValue(tc.value)
+		if (err != nil) != tc.wantErr {
+			t.Errorf("parseThermalValue(%q) error = %v, wantErr %v", tc.value, err, tc.wantErr)
+			continue
+		}
+		if got != tc.want {
+			t.Errorf("parseThermalValue(%q) = %v, want %v", tc.value, got, tc.want)
+		}
+	}
+}
+
+func TestWaitForCooldownShutdown(t *testing.T) {
+	sensor := filepath.Join(t.TempDir(), "temp")
+	if err := os.WriteFile(sensor, []byte("95000\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	setFlag(t, thermalSensor, sensor)
+	setFlag(t, thermalMax, 80.0)
+	setFlag(t, thermalResume, 70.0)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	done := make(chan struct{})
+	go func() {
+		waitForCooldown(ctx)
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatalf("waitForCooldown() kept waiting after shutdown")
+	}
+}
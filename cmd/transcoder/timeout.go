@@ -0,0 +1,32 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// timeoutError is an encode stopped by -timeout, typically ffmpeg hanging on a corrupt input.
+type timeoutError struct {
+	after time.Duration
+	err   error
+}
+
+func (e *timeoutError) Error() string { return fmt.Sprintf("timeout after %s", e.after) }
+func (e *timeoutError) Unwrap() error { return e.err }
+
+// withEncodeTimeout runs encode with a context that is cancelled after timeout, the encoder is then stopped like on
+// shutdown. An encode cut short returns a timeoutError, a timeout of 0 never expires.
+func withEncodeTimeout(ctx context.Context, timeout time.Duration, encode func(context.Context) error) error {
+	if timeout <= 0 {
+		return encode(ctx)
+	}
+	encodeCtx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	err := encode(encodeCtx)
+	if err != nil && ctx.Err() == nil && errors.Is(encodeCtx.Err(), context.DeadlineExceeded) {
+		return &timeoutError{after: timeout, err: err}
+	}
+	return err
+}
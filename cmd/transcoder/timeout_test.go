@@ -0,0 +1,38 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestWithEncodeTimeout(t *testing.T) {
+	start := time.Now()
+	err := withEncodeTimeout(context.Background(), 100*time.Millisecond, func(ctx context.Context) error {
+		return runEncoder(ctx, "/input.mkv", []string{"sleep", "30"}, 0)
+	})
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("hung encoder ran for %s, want it stopped after the timeout", elapsed)
+	}
+	var timeout *timeoutError
+	if !errors.As(err, &timeout) || err.Error() != "timeout after 100ms" {
+		t.Errorf("withEncodeTimeout() error = %v, want timeout after 100ms", err)
+	}
+	if transientFailure(err) {
+		t.Errorf("a timeout is retried, want it recorded as failed")
+	}
+
+	if err := withEncodeTimeout(context.Background(), time.Minute, func(ctx context.Context) error {
+		return runEncoder(ctx, "/input.mkv", []string{"true"}, 0)
+	}); err != nil {
+		t.Errorf("withEncodeTimeout() of a quick encode error = %v, want nil", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	err = withEncodeTimeout(ctx, time.Minute, func(ctx context.Context) error { return ctx.Err() })
+	if errors.As(err, &timeout) {
+		t.Errorf("withEncodeTimeout() after shutdown = %v, want the shutdown error", err)
+	}
+}
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// encodePass selects one pass of a -two-pass encode. The zero value is a regular single pass encode.
+type encodePass struct {
+	Pass     int    // 1 for the analysis pass, 2 for the encode pass consuming its stats
+	StatsDir string // directory holding the stats file shared by both passes, unique per input
+}
+
+// twoPassStatsName is the -passlogfile prefix of the stats file within encodePass.StatsDir.
+const twoPassStatsName = "ffmpeg2pass"
+
+// dockerStatsDir is where encodePass.StatsDir is mounted inside the container.
+const dockerStatsDir = "/stats"
+
+// statsDirPattern is the os.MkdirTemp pattern of the stats directory of an encode to tmpfile. The directory sits
+// next to tmpfile and is named like it, so -temp-location hides it the same way and it is treated as temp output.
+func statsDirPattern(tmpfile string) string {
+	return strings.TrimSuffix(tmpfile, filepath.Ext(tmpfile)) + ".2pass-*"
+}
+
+// createStatsDir creates a fresh stats directory for an encode to tmpfile.
+func createStatsDir(tmpfile string) (string, error) {
+	return os.MkdirTemp(filepath.Dir(tmpfile), filepath.Base(statsDirPattern(tmpfile)))
+}
+
+// passArgs returns the ffmpeg options selecting the pass, statsDir is the stats directory as ffmpeg sees it.
+func (p encodePass) passArgs(statsDir string) []string {
+	if p.Pass == 0 {
+		return nil
+	}
+	return []string{"-pass", strconv.Itoa(p.Pass), "-passlogfile", filepath.Join(statsDir, twoPassStatsName)}
+}
+
+// twoPassEnabled reports whether encodes run an analysis pass first, only svtav1 supports -two-pass.
+func twoPassEnabled() bool {
+	return *twoPass && *encoder == encoderSVTAV1
+}
+
+// analysisOnly reports whether the pass only gathers stats, its output is discarded.
+func (p encodePass) analysisOnly() bool {
+	return p.Pass == 1
+}
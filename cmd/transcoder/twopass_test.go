@@ -0,0 +1,61 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+func TestTwoPassCommands(t *testing.T) {
+	pd := mustParseProbe(t, threeLanguageProbe)
+	statsDir := t.TempDir()
+	passlog := filepath.Join(statsDir, twoPassStatsName)
+
+	analysis, _, err := createFfmpegPassCommand(pd, "in.mkv", "out.mkv", encodePass{Pass: 1, StatsDir: statsDir})
+	if err != nil {
+		t.Fatalf("createFfmpegPassCommand() pass 1 error: %v", err)
+	}
+	if !containsSeq(analysis, "-pass", "1", "-passlogfile", passlog) || !containsSeq(analysis, "-f", "null", "-y", os.DevNull) {
+		t.Errorf("analysis pass = %v, want -pass 1 with stats in %s and a discarded output", analysis, statsDir)
+	}
+	if containsSeq(analysis, "-map", "0:a:0") || slices.Contains(analysis, "out.mkv") {
+		t.Errorf("analysis pass = %v, want video only without writing the output", analysis)
+	}
+
+	encode, _, err := createFfmpegPassCommand(pd, "in.mkv", "out.mkv", encodePass{Pass: 2, StatsDir: statsDir})
+	if err != nil {
+		t.Fatalf("createFfmpegPassCommand() pass 2 error: %v", err)
+	}
+	if !containsSeq(encode, "-pass", "2", "-passlogfile", passlog) || !containsSeq(encode, "-map", "0:a:0") || encode[len(encode)-1] != "out.mkv" {
+		t.Errorf("encode pass = %v, want -pass 2 with stats in %s writing audio and video to out.mkv", encode, statsDir)
+	}
+
+	single, _, err := createFfmpegCommand(pd, "in.mkv", "out.mkv")
+	if err != nil {
+		t.Fatalf("createFfmpegCommand() error: %v", err)
+	}
+	if slices.Contains(single, "-pass") {
+		t.Errorf("single pass command = %v, want no -pass", single)
+	}
+}
+
+func TestCreateStatsDir(t *testing.T) {
+	for _, location := range []string{tempHidden, tempSubdir} {
+		setFlag(t, tempLocation, location)
+		tmpfile := tempFilename(filepath.Join(t.TempDir(), "movie-svtav1enc.mkv"))
+		if err := os.MkdirAll(filepath.Dir(tmpfile), 0755); err != nil {
+			t.Fatal(err)
+		}
+		statsDir, err := createStatsDir(tmpfile)
+		if err != nil {
+			t.Fatalf("createStatsDir() error: %v", err)
+		}
+		if filepath.Dir(statsDir) != filepath.Dir(tmpfile) || !isEncodedFile(filepath.Base(statsDir)) {
+			t.Errorf("-temp-location %s: stats dir %q, want a temp name beside %q", location, statsDir, tmpfile)
+		}
+		if location == tempHidden && filepath.Base(statsDir)[0] != '.' {
+			t.Errorf("-temp-location %s: stats dir %q isn't hidden", location, statsDir)
+		}
+	}
+}
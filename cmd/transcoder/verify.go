@@ -0,0 +1,147 @@
+package main
+
+import (
+	"fmt"
+	"math"
+
+	"github.com/garethgeorge/media-toolkit/internal/encodelog"
+	"github.com/garethgeorge/media-toolkit/internal/ffmpegutil"
+	"go.uber.org/zap"
+)
+
+// verifyEncode runs the opt-in checks of a finished encode before it is moved into place, recording their results
+// on the log entry. An error means the output should be discarded. Frame and subtitle checks comparing the output
+// against the whole source are skipped for -sample-duration samples, quality is scored against the sampled start.
+func verifyEncode(entry *encodelog.LogFileEntry, probeData ffmpegutil.ProbeData, infile, tmpfile string) error {
+	if *frameCheck && !sampling() {
+		if err := checkFrames(entry, probeData, infile, tmpfile); err != nil {
+			return err
+		}
+	}
+
+	if *decodeCheck == decodeCheckOutput || *decodeCheck == decodeCheckBoth {
+		errCount, err := ffmpegutil.CountDecodeErrors(tmpfile)
+		if err != nil {
+			return err
+		}
+		entry.OutputDecodeErrors = errCount
+		if errCount > *maxDecodeErrors {
+			return fmt.Errorf("%d decode errors in output", errCount)
+		}
+	}
+
+	if *subtitleSyncCheck && *mapExpr == "" && !sampling() {
+		opts := subtitleOptionsFromFlags()
+		opts.Container = containerFor(tmpfile)
+		keep, _ := planSubtitles(probeData, opts)
+		if err := checkSubtitleSync(keep, infile, tmpfile); err != nil {
+			return err
+		}
+	}
+
+	if activeQualityMetric() != "" {
+		if err := measureQuality(entry, probeData, infile, tmpfile); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// checkFrames compares the output's frame count against the source's, a truncated file can have a plausible
+// duration in its header but is missing frames. A failure to count is logged but does not fail the encode.
+func checkFrames(entry *encodelog.LogFileEntry, probeData ffmpegutil.ProbeData, infile, tmpfile string) error {
+	expected, exact := probeData.ExpectedVideoFrames()
+	if expected <= 0 {
+		zap.S().Debugf("Item %q source frame count unknown, skipping the frame check", infile)
+		return nil
+	}
+	actual, err := ffmpegutil.CountVideoFrames(tmpfile)
+	if err != nil {
+		zap.S().Warnf("Item %q error counting output frames: %v", infile, err)
+		return nil
+	}
+	entry.ExpectedFrames = expected
+	entry.OutputFrames = actual
+	return ffmpegutil.CheckFrameCount(expected, actual, exact)
+}
+
+// subtitleSyncTolerance is how far the first and last subtitle events of the output may move from the source's.
+const subtitleSyncTolerance = 1.0 // seconds
+
+// checkSubtitleSync compares the first and last event times of each copied subtitle stream against its source
+// stream, catching subtitles that drift when the video is re-timed. keep are the source subtitle indices in output
+// order. Streams whose timing can't be read are logged and not compared.
+func checkSubtitleSync(keep []int, infile, tmpfile string) error {
+	for outIdx, srcIdx := range keep {
+		srcFirst, srcLast, err := ffmpegutil.SubtitleTimeRange(infile, srcIdx)
+		if err != nil {
+			zap.S().Warnf("Item %q error reading subtitle 0:s:%d timing: %v", infile, srcIdx, err)
+			continue
+		}
+		outFirst, outLast, err := ffmpegutil.SubtitleTimeRange(tmpfile, outIdx)
+		if err != nil {
+			return fmt.Errorf("reading output subtitle %d timing: %w", outIdx, err)
+		}
+		if math.Abs(srcFirst-outFirst) > subtitleSyncTolerance || math.Abs(srcLast-outLast) > subtitleSyncTolerance {
+			return fmt.Errorf("subtitle 0:s:%d out of sync, source spans %.2fs-%.2fs but output spans %.2fs-%.2fs", srcIdx, srcFirst, srcLast, outFirst, outLast)
+		}
+	}
+	return nil
+}
+
+// verifyExistingOutput checks that an output found on disk looks like a complete encode of the source, cropped as
+// this run would crop it.
+func verifyExistingOutput(sourceProbe ffmpegutil.ProbeData, infile, outfile string) error {
+	outProbe, err := ffmpegutil.GetFfprobeInfo(outfile)
+	if err != nil {
+		return err
+	}
+	crop, _ := appliedCrop(sourceProbe, infile)
+	return ffmpegutil.VerifyOutput(sourceProbe, outProbe, crop)
+}
+
+// activeQualityMetric returns the metric encodes are scored with, -verify-vmaf implies vmaf.
+func activeQualityMetric() string {
+	if *verifyVMAF {
+		return ffmpegutil.MetricVMAF
+	}
+	return *qualityMetric
+}
+
+// measureQuality scores the encoded tmpfile against its source and records the score on the log entry. It returns
+// an error if the score is below -min-vmaf. A failure to measure fails the encode when -min-vmaf is set, otherwise
+// it is only logged.
+func measureQuality(entry *encodelog.LogFileEntry, probeData ffmpegutil.ProbeData, infile, tmpfile string) error {
+	metric := activeQualityMetric()
+	reference := ffmpegutil.QualityReference{File: infile, VideoIdx: probeData.PrimaryVideoStreamIndex()}
+	reference.Crop, _ = appliedCrop(probeData, infile)
+	if sampling() {
+		reference.Seconds = sampleDuration.Seconds()
+	}
+	score, err := ffmpegutil.MeasureQuality(metric, tmpfile, reference, *qualitySample)
+	if err != nil {
+		if *minVMAF > 0 {
+			return fmt.Errorf("measure %s for -min-vmaf: %w", metric, err)
+		}
+		zap.S().Warnf("Item %q quality measurement failed: %v", infile, err)
+		return nil
+	}
+	zap.S().Infof("Item %q %s score: %.4f", infile, metric, score)
+
+	if *qualitySample > 1 {
+		entry.QualitySampling = fmt.Sprintf("every %d frames", *qualitySample)
+	} else {
+		entry.QualitySampling = "all frames"
+	}
+	switch metric {
+	case ffmpegutil.MetricVMAF:
+		entry.VMAF = score
+		if *minVMAF > 0 && score < *minVMAF {
+			return fmt.Errorf("vmaf %.2f below minimum %.2f", score, *minVMAF)
+		}
+	case ffmpegutil.MetricSSIM:
+		entry.SSIM = score
+	}
+	return nil
+}
@@ -0,0 +1,24 @@
+package main
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/garethgeorge/media-toolkit/internal/encodelog"
+)
+
+func TestMeasureQualityFailure(t *testing.T) {
+	pd := mustParseProbe(t, threeLanguageProbe)
+	missing := filepath.Join(t.TempDir(), "missing.mkv")
+	setFlag(t, verifyVMAF, true)
+
+	// a score-only run keeps the encode when the measurement can't be made
+	if err := measureQuality(&encodelog.LogFileEntry{}, pd, missing, missing); err != nil {
+		t.Errorf("measureQuality() without -min-vmaf = %v, want nil", err)
+	}
+
+	setFlag(t, minVMAF, 90.0)
+	if err := measureQuality(&encodelog.LogFileEntry{}, pd, missing, missing); err == nil {
+		t.Errorf("measureQuality() with -min-vmaf of unmeasurable files succeeded, want an error")
+	}
+}
@@ -0,0 +1,135 @@
+package main
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"slices"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/garethgeorge/media-toolkit/internal/ffmpegutil"
+	"github.com/garethgeorge/media-toolkit/internal/fsutil"
+	"go.uber.org/zap"
+)
+
+// watchDir watches dir and its subdirectories for new or changed video files and calls process with each batch of
+// files that have seen no writes for settle, in sorted order. Files a downloader is still writing stay pending until
+// their marker, see fsutil.PartialDownloadMarker, is gone. process runs on the watching goroutine so batches are
+// handled one at a time, events arriving meanwhile are queued by the kernel and if that queue overflows the
+// directory is rescanned instead. It runs until stop is closed.
+func watchDir(dir string, settle time.Duration, process func([]string), stop <-chan struct{}) error {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return err
+	}
+	defer watcher.Close()
+
+	ignore, err := fsutil.LoadIgnoreFile(dir)
+	if err != nil {
+		return err
+	}
+	isCandidate := func(path string) bool {
+		rel, err := filepath.Rel(dir, path)
+		return err == nil && slices.Contains(ffmpegutil.VideoFileExts, filepath.Ext(path)) && !isEncodedFile(path) && !ignore.Ignored(filepath.ToSlash(rel), false) && !fsutil.Excluded(*excludeGlobs, rel)
+	}
+
+	// fsnotify isn't recursive, every directory is watched individually
+	addTree := func(root string) error {
+		return filepath.WalkDir(root, func(path string, d os.DirEntry, err error) error {
+			if err != nil || !d.IsDir() {
+				return err
+			}
+			if d.Name() == tempSubdirName {
+				return filepath.SkipDir
+			}
+			return watcher.Add(path)
+		})
+	}
+	if err := addTree(dir); err != nil {
+		return err
+	}
+
+	pending := make(map[string]time.Time) // path -> time of the last event seen for it
+	rescan := func() {
+		matches, err := fsutil.MediaInDir(dir, *excludeGlobs...)
+		if err != nil {
+			zap.S().Errorf("Error rescanning %q: %v", dir, err)
+			return
+		}
+		for _, match := range matches {
+			if isCandidate(match) {
+				pending[match] = time.Now()
+			}
+		}
+	}
+
+	ticker := time.NewTicker(min(settle, time.Second))
+	defer ticker.Stop()
+	zap.S().Infof("Watching %q for new files", dir)
+	for {
+		select {
+		case <-stop:
+			return nil
+		case event, ok := <-watcher.Events:
+			if !ok {
+				return nil
+			}
+			if event.Has(fsnotify.Create) {
+				if info, err := os.Stat(event.Name); err == nil && info.IsDir() {
+					if err := addTree(event.Name); err != nil {
+						zap.S().Warnf("Error watching new directory %q: %v", event.Name, err)
+					}
+					rescan() // files may have been moved in with the directory before it was watched
+					continue
+				}
+			}
+			if event.Has(fsnotify.Create) || event.Has(fsnotify.Write) {
+				if isCandidate(event.Name) {
+					pending[event.Name] = time.Now()
+				}
+			}
+			if event.Has(fsnotify.Remove) || event.Has(fsnotify.Rename) {
+				delete(pending, event.Name)
+				// a finished download removes its marker, possibly after the last write to the file
+				if target, ok := fsutil.PartialDownloadTarget(event.Name); ok && isCandidate(target) {
+					pending[target] = time.Now()
+				}
+			}
+		case err, ok := <-watcher.Errors:
+			if !ok {
+				return nil
+			}
+			if errors.Is(err, fsnotify.ErrEventOverflow) {
+				zap.S().Warnf("Watch events overflowed, rescanning %q", dir)
+				rescan()
+				continue
+			}
+			zap.S().Warnf("Watch error: %v", err)
+		case <-ticker.C:
+			var ready []string
+			for path, lastEvent := range pending {
+				if time.Since(lastEvent) < settle {
+					continue
+				}
+				if marker, ok := fsutil.PartialDownloadMarker(path); ok {
+					zap.S().Debugf("Item %q still downloading, waiting for %q to be removed", path, marker)
+					pending[path] = time.Now()
+					continue
+				}
+				ready = append(ready, path)
+			}
+			slices.Sort(ready)
+			var batch []string
+			for _, path := range ready {
+				delete(pending, path)
+				if _, err := os.Stat(path); err == nil {
+					batch = append(batch, path)
+				}
+			}
+			if len(batch) > 0 {
+				process(batch)
+			}
+		}
+	}
+}
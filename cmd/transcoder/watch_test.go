@@ -0,0 +1,101 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestWatchDir(t *testing.T) {
+	dir := t.TempDir()
+	processed := make(chan string, 10)
+	stop := make(chan struct{})
+	done := make(chan error)
+	go func() {
+		done <- watchDir(dir, 100*time.Millisecond, func(paths []string) {
+			for _, path := range paths {
+				processed <- path
+			}
+		}, stop)
+	}()
+	time.Sleep(50 * time.Millisecond) // let the watcher start
+
+	season := filepath.Join(dir, "Show", "Season 1")
+	if err := os.MkdirAll(season, 0755); err != nil {
+		t.Fatal(err)
+	}
+	episode := filepath.Join(season, "episode.mkv")
+	if err := os.WriteFile(episode, []byte("data"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(season, "episode.nfo"), []byte("data"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case got := <-processed:
+		if got != episode {
+			t.Errorf("watchDir() processed %q, want %q", got, episode)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("watchDir() didn't process %q", episode)
+	}
+
+	select {
+	case got := <-processed:
+		t.Errorf("watchDir() processed unexpected %q", got)
+	case <-time.After(300 * time.Millisecond):
+	}
+
+	close(stop)
+	if err := <-done; err != nil {
+		t.Errorf("watchDir() error: %v", err)
+	}
+}
+
+func TestWatchDirWaitsForDownloads(t *testing.T) {
+	dir := t.TempDir()
+	processed := make(chan string, 10)
+	stop := make(chan struct{})
+	done := make(chan error)
+	go func() {
+		done <- watchDir(dir, 100*time.Millisecond, func(paths []string) {
+			for _, path := range paths {
+				processed <- path
+			}
+		}, stop)
+	}()
+	time.Sleep(50 * time.Millisecond) // let the watcher start
+
+	movie := filepath.Join(dir, "movie.mkv")
+	if err := os.WriteFile(movie+".aria2", []byte("control"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(movie, []byte("data"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case got := <-processed:
+		t.Fatalf("watchDir() processed %q while it was downloading", got)
+	case <-time.After(500 * time.Millisecond):
+	}
+
+	if err := os.Remove(movie + ".aria2"); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case got := <-processed:
+		if got != movie {
+			t.Errorf("watchDir() processed %q, want %q", got, movie)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("watchDir() didn't process %q once its download finished", movie)
+	}
+
+	close(stop)
+	if err := <-done; err != nil {
+		t.Errorf("watchDir() error: %v", err)
+	}
+}
@@ -0,0 +1,41 @@
+package main
+
+import (
+	"flag"
+	"os"
+	"time"
+
+	"github.com/garethgeorge/media-toolkit/internal/encodelog"
+	"github.com/garethgeorge/media-toolkit/internal/flags"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+var (
+	since = flag.String("since", "", "Only include files whose latest entry started at or after this date e.g. 2024-01-31, RFC 3339 time, or duration before now e.g. 720h. Skips logged by older versions have no start time and are left out.")
+)
+
+// transcodestats prints aggregate statistics of the encode log across all runs, counting the latest entry of each file.
+func main() {
+	flag.Parse()
+
+	sinceTime, err := parseSince(*since, time.Now())
+	if err != nil {
+		zap.S().Fatalf("Invalid -since: %v", err)
+	}
+
+	transcodeLog, err := encodelog.ReadLog(flags.LogFilePath())
+	if err != nil {
+		zap.S().Fatalf("Error reading transcode log: %v", err)
+	}
+
+	collectStats(transcodeLog, sinceTime).print(os.Stdout)
+}
+
+func init() {
+	// Create a colored zap console logger
+	consoleConfig := zap.NewDevelopmentConfig()
+	consoleConfig.EncoderConfig.EncodeLevel = zapcore.CapitalColorLevelEncoder
+	consoleLogger, _ := consoleConfig.Build()
+	zap.ReplaceGlobals(consoleLogger)
+}
@@ -0,0 +1,141 @@
+package main
+
+import (
+	"cmp"
+	"fmt"
+	"io"
+	"slices"
+	"text/tabwriter"
+	"time"
+
+	"github.com/garethgeorge/media-toolkit/internal/encodelog"
+	"github.com/garethgeorge/media-toolkit/internal/fsutil"
+)
+
+// logStats aggregates the latest entry of each file in an encode log, see encodelog.Key. Earlier attempts of a file
+// are superseded, so a file that failed before it was encoded counts once as transcoded.
+type logStats struct {
+	Transcoded int
+	Failed     int
+	Skipped    int
+
+	TotalTime  time.Duration // time spent on the latest attempts including failures
+	EncodeTime time.Duration // time spent on successful encodes, the basis of the average speed
+
+	// sizes of the successful encodes that recorded both, older entries have neither
+	InputBytes  int64
+	OutputBytes int64
+
+	Errors      map[string]int // failures by error message
+	SkipReasons map[string]int
+}
+
+// collectStats aggregates the latest entry of each file among entries, which are in log order, if it started at or
+// after since. A zero since includes every entry. Entries without a parseable start time, such as skips written
+// before skips were timestamped, are only included when since is zero.
+func collectStats(entries []encodelog.LogFileEntry, since time.Time) logStats {
+	stats := logStats{Errors: make(map[string]int), SkipReasons: make(map[string]int)}
+	for _, entry := range latestEntries(entries) {
+		if !since.IsZero() {
+			start, err := time.Parse(time.RFC3339, entry.StartTime)
+			if err != nil || start.Before(since) {
+				continue
+			}
+		}
+
+		duration, _ := time.ParseDuration(entry.Duration)
+		stats.TotalTime += duration
+
+		switch {
+		case entry.Error != "":
+			stats.Failed++
+			stats.Errors[entry.Error]++
+		case entry.Skipped != "":
+			stats.Skipped++
+			stats.SkipReasons[entry.Skipped]++
+		default:
+			stats.Transcoded++
+			if entry.InputSizeBytes > 0 && entry.OutputSizeBytes > 0 {
+				stats.InputBytes += entry.InputSizeBytes
+				stats.OutputBytes += entry.OutputSizeBytes
+				stats.EncodeTime += duration
+			}
+		}
+	}
+	return stats
+}
+
+// latestEntries returns the latest entry of each key among entries, in log order.
+func latestEntries(entries []encodelog.LogFileEntry) []encodelog.LogFileEntry {
+	latest := make(map[encodelog.Key]int, len(entries))
+	for idx, entry := range entries {
+		latest[entry.Key()] = idx
+	}
+	var result []encodelog.LogFileEntry
+	for idx, entry := range entries {
+		if latest[entry.Key()] == idx {
+			result = append(result, entry)
+		}
+	}
+	return result
+}
+
+// parseSince parses -since as a date, an RFC 3339 time or a duration before now e.g. 720h.
+func parseSince(value string, now time.Time) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+	if d, err := time.ParseDuration(value); err == nil {
+		return now.Add(-d), nil
+	}
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+	if t, err := time.ParseInLocation(time.DateOnly, value, now.Location()); err == nil {
+		return t, nil
+	}
+	return time.Time{}, fmt.Errorf("%q is not a date, RFC 3339 time or duration", value)
+}
+
+// print writes the statistics as tables, failures and skip reasons most frequent first.
+func (s logStats) print(out io.Writer) {
+	w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(w, "Transcoded\t%d\n", s.Transcoded)
+	fmt.Fprintf(w, "Failed\t%d\n", s.Failed)
+	fmt.Fprintf(w, "Skipped\t%d\n", s.Skipped)
+	fmt.Fprintf(w, "Total time\t%s\n", s.TotalTime.Round(time.Second))
+	if s.InputBytes > 0 {
+		saved := s.InputBytes - s.OutputBytes
+		fmt.Fprintf(w, "Space saved\t%s of %s (%.0f%%)\n", fsutil.FormatBytes(saved), fsutil.FormatBytes(s.InputBytes), 100*float64(saved)/float64(s.InputBytes))
+	}
+	if s.EncodeTime > 0 {
+		perSecond := int64(float64(s.InputBytes) / s.EncodeTime.Seconds())
+		fmt.Fprintf(w, "Average speed\t%s/s of input\n", fsutil.FormatBytes(perSecond))
+	}
+	w.Flush()
+
+	printCounts(out, "Failures", s.Errors)
+	printCounts(out, "Skip reasons", s.SkipReasons)
+}
+
+func printCounts(out io.Writer, title string, counts map[string]int) {
+	if len(counts) == 0 {
+		return
+	}
+	type count struct {
+		key string
+		n   int
+	}
+	var sorted []count
+	for key, n := range counts {
+		sorted = append(sorted, count{key, n})
+	}
+	slices.SortFunc(sorted, func(a, b count) int {
+		return cmp.Or(cmp.Compare(b.n, a.n), cmp.Compare(a.key, b.key))
+	})
+
+	fmt.Fprintf(out, "\n%s:\n", title)
+	for _, c := range sorted {
+		fmt.Fprintf(out, "%6d  %s\n", c.n, c.key)
+	}
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/garethgeorge/media-toolkit/internal/encodelog"
+)
+
+func TestCollectStats(t *testing.T) {
+	entries := []encodelog.LogFileEntry{
+		{InputPath: "a.mkv", StartTime: "2024-01-01T00:00:00Z", Duration: "1h0m0s", InputSizeBytes: 4 << 30, OutputSizeBytes: 1 << 30},
+		{InputPath: "b.mkv", StartTime: "2024-01-15T00:00:00Z", Duration: "5m0s", Error: "exit status 1"},
+		{InputPath: "b.mkv", StartTime: "2024-02-01T00:00:00Z", Duration: "30m0s", InputSizeBytes: 2 << 30, OutputSizeBytes: 1 << 30},
+		{InputPath: "c.mkv", StartTime: "2024-02-02T00:00:00Z", Duration: "10m0s"},
+		{InputPath: "d.mkv", StartTime: "2024-02-03T00:00:00Z", Duration: "1m0s", Error: "exit status 1"},
+		{InputPath: "e.mkv", StartTime: "2024-02-04T00:00:00Z", Duration: "2m0s", Error: "exit status 1"},
+		{InputPath: "f.mkv", StartTime: "2024-02-05T00:00:00Z", Skipped: "already AV1"},
+	}
+
+	all := collectStats(entries, time.Time{})
+	if all.Transcoded != 3 || all.Failed != 2 || all.Skipped != 1 {
+		t.Errorf("counts = %d transcoded, %d failed, %d skipped, want 3, 2, 1", all.Transcoded, all.Failed, all.Skipped)
+	}
+	if all.TotalTime != 103*time.Minute || all.EncodeTime != 90*time.Minute {
+		t.Errorf("times = %s total, %s encoding, want 1h43m and 1h30m", all.TotalTime, all.EncodeTime)
+	}
+	if all.InputBytes != 6<<30 || all.OutputBytes != 2<<30 {
+		t.Errorf("bytes = %d in, %d out", all.InputBytes, all.OutputBytes)
+	}
+	if all.Errors["exit status 1"] != 2 || all.SkipReasons["already AV1"] != 1 {
+		t.Errorf("breakdown = %v failures, %v skips", all.Errors, all.SkipReasons)
+	}
+
+	var out strings.Builder
+	all.print(&out)
+	for _, want := range []string{"Space saved    4.0 GiB of 6.0 GiB (67%)", "Failures:\n     2  exit status 1", "Skip reasons:\n     1  already AV1"} {
+		if !strings.Contains(out.String(), want) {
+			t.Errorf("output missing %q:\n%s", want, out.String())
+		}
+	}
+
+	recent := collectStats(entries, time.Date(2024, 2, 1, 0, 0, 0, 0, time.UTC))
+	if recent.Transcoded != 2 || recent.InputBytes != 2<<30 || recent.Skipped != 1 {
+		t.Errorf("since February = %d transcoded of %d bytes, %d skipped, want 2 of %d and 1", recent.Transcoded, recent.InputBytes, recent.Skipped, int64(2<<30))
+	}
+}
+
+func TestParseSince(t *testing.T) {
+	now := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	for value, want := range map[string]time.Time{
+		"":                     {},
+		"48h":                  time.Date(2024, 2, 28, 12, 0, 0, 0, time.UTC),
+		"2024-01-31":           time.Date(2024, 1, 31, 0, 0, 0, 0, time.UTC),
+		"2024-01-31T08:00:00Z": time.Date(2024, 1, 31, 8, 0, 0, 0, time.UTC),
+	} {
+		got, err := parseSince(value, now)
+		if err != nil || !got.Equal(want) {
+			t.Errorf("parseSince(%q) = %s, %v, want %s", value, got, err, want)
+		}
+	}
+	if _, err := parseSince("last week", now); err == nil {
+		t.Errorf("parseSince(\"last week\") succeeded, want an error")
+	}
+}
@@ -0,0 +1,145 @@
+// Package config loads transcoder settings from a YAML file. Every setting maps to a command line flag of the same
+// name, precedence is flag defaults < config file < flags given on the command line.
+package config
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"reflect"
+	"slices"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Config holds the settings of a config file. Fields are pointers so that settings missing from the file leave
+// their flag untouched, durations are strings in flag syntax e.g. 10m. Each field's flag tag names the flag it sets.
+type Config struct {
+	// Video encoding
+	Encoder      *string `yaml:"encoder,omitempty" flag:"encoder"`
+	Preset       *int    `yaml:"preset,omitempty" flag:"preset"`
+	CRF          *int    `yaml:"crf,omitempty" flag:"crf"`
+	MasterCRF    *int    `yaml:"master_crf,omitempty" flag:"master-crf"`
+	Tune         *int    `yaml:"tune,omitempty" flag:"tune"`
+	Mode         *string `yaml:"mode,omitempty" flag:"mode"`
+	TwoPass      *bool   `yaml:"two_pass,omitempty" flag:"two-pass"`
+	Keyint       *string `yaml:"keyint,omitempty" flag:"keyint"`
+	VideoThreads *string `yaml:"video_threads,omitempty" flag:"video-threads"`
+	Jobs         *string `yaml:"jobs,omitempty" flag:"jobs"`
+	OutputExt    *string `yaml:"output_ext,omitempty" flag:"output-ext"`
+
+	// Docker
+	DockerImage   *string `yaml:"docker_image,omitempty" flag:"docker-image"`
+	DockerDevices *string `yaml:"docker_devices,omitempty" flag:"docker-devices"`
+	DockerUser    *string `yaml:"docker_user,omitempty" flag:"docker-user"`
+	DockerCpus    *string `yaml:"docker_cpus,omitempty" flag:"docker-cpus"`
+
+	// Audio and subtitles
+	AudioCodec           *string `yaml:"audio_codec,omitempty" flag:"audio-codec"`
+	AudioBitrate         *string `yaml:"audio_bitrate,omitempty" flag:"audio-bitrate"`
+	AudioDownmixChannels *int    `yaml:"audio_downmix_channels,omitempty" flag:"audio-downmix-channels"`
+	AudioLangs           *string `yaml:"audio_langs,omitempty" flag:"audio-langs"`
+	Surround             *string `yaml:"surround,omitempty" flag:"surround"`
+	PreferChannels       *string `yaml:"prefer_channels,omitempty" flag:"prefer-channels"`
+	SubtitleLangs        *string `yaml:"subtitle_langs,omitempty" flag:"subtitle-langs"`
+	SubtitleMode         *string `yaml:"subtitle_mode,omitempty" flag:"subtitle-mode"`
+	SubCodecs            *string `yaml:"sub_codecs,omitempty" flag:"sub-codecs"`
+
+	// File selection
+	Exclude      []string `yaml:"exclude,omitempty" flag:"exclude"`
+	MinAge       *string  `yaml:"min_age,omitempty" flag:"min-age"`
+	MinDuration  *string  `yaml:"min_duration,omitempty" flag:"min-duration"`
+	MinSourceAge *string  `yaml:"min_source_age,omitempty" flag:"min-source-age"`
+
+	// Verification
+	QualityMetric *string  `yaml:"quality_metric,omitempty" flag:"quality-metric"`
+	MinVMAF       *float64 `yaml:"min_vmaf,omitempty" flag:"min-vmaf"`
+
+	Env []string `yaml:"env,omitempty" flag:"env"`
+	Log *string  `yaml:"log,omitempty" flag:"log"`
+
+	// Flags sets any other flag by name e.g. {"temp-location": "subdir"}.
+	Flags map[string]string `yaml:"flags,omitempty"`
+}
+
+// Load reads a config file, unknown keys are an error so that typos don't silently fall back to defaults.
+func Load(path string) (Config, error) {
+	var cfg Config
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return cfg, err
+	}
+	dec := yaml.NewDecoder(bytes.NewReader(data))
+	dec.KnownFields(true)
+	if err := dec.Decode(&cfg); err != nil && !errors.Is(err, io.EOF) {
+		return cfg, fmt.Errorf("parsing config %q: %w", path, err)
+	}
+	return cfg, nil
+}
+
+// Write saves cfg to path in the format Load reads.
+func Write(path string, cfg Config) error {
+	data, err := yaml.Marshal(cfg)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, data, 0644)
+}
+
+// Apply sets the flags of fs from cfg, leaving flags that were given on the command line as they are. It must be
+// called after fs is parsed. Repeatable flags get one Set per list element.
+func Apply(fs *flag.FlagSet, cfg Config) error {
+	explicit := make(map[string]bool)
+	fs.Visit(func(f *flag.Flag) { explicit[f.Name] = true })
+
+	set := func(name string, values ...string) error {
+		if explicit[name] {
+			return nil
+		}
+		if fs.Lookup(name) == nil {
+			return fmt.Errorf("config sets unknown flag -%s", name)
+		}
+		for _, value := range values {
+			if err := fs.Set(name, value); err != nil {
+				return fmt.Errorf("config value %q for -%s: %w", value, name, err)
+			}
+		}
+		return nil
+	}
+
+	v := reflect.ValueOf(cfg)
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		name := t.Field(i).Tag.Get("flag")
+		field := v.Field(i)
+		if name == "" || field.IsNil() {
+			continue
+		}
+		var values []string
+		if field.Kind() == reflect.Slice {
+			for j := 0; j < field.Len(); j++ {
+				values = append(values, fmt.Sprint(field.Index(j).Interface()))
+			}
+		} else {
+			values = []string{fmt.Sprint(field.Elem().Interface())}
+		}
+		if err := set(name, values...); err != nil {
+			return err
+		}
+	}
+
+	names := make([]string, 0, len(cfg.Flags))
+	for name := range cfg.Flags {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	for _, name := range names {
+		if err := set(name, cfg.Flags[name]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,126 @@
+package config
+
+import (
+	"flag"
+	"os"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+const testConfig = `
+encoder: svtav1
+preset: 4
+crf: 28
+two_pass: true
+docker_image: ffmpeg:7.1
+audio_langs: eng,jpn
+min_duration: 2m
+min_vmaf: 93.5
+exclude:
+  - "**/Extras/**"
+  - "*sample*"
+flags:
+  temp-location: subdir
+`
+
+func writeConfig(t *testing.T, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "transcoder.yaml")
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLoadRoundTrip(t *testing.T) {
+	cfg, err := Load(writeConfig(t, testConfig))
+	if err != nil {
+		t.Fatalf("Load() error: %v", err)
+	}
+	if cfg.Preset == nil || *cfg.Preset != 4 || cfg.TwoPass == nil || !*cfg.TwoPass || cfg.CRF == nil || *cfg.CRF != 28 {
+		t.Errorf("Load() = %+v, want preset 4, crf 28 and two pass", cfg)
+	}
+	if cfg.AudioCodec != nil {
+		t.Errorf("Load() set audio codec %q missing from the file", *cfg.AudioCodec)
+	}
+
+	path := filepath.Join(t.TempDir(), "written.yaml")
+	if err := Write(path, cfg); err != nil {
+		t.Fatalf("Write() error: %v", err)
+	}
+	reloaded, err := Load(path)
+	if err != nil {
+		t.Fatalf("Load() of written config error: %v", err)
+	}
+	if !reflect.DeepEqual(reloaded, cfg) {
+		t.Errorf("round trip = %+v, want %+v", reloaded, cfg)
+	}
+}
+
+func TestLoadErrors(t *testing.T) {
+	if _, err := Load(writeConfig(t, "presett: 4\n")); err == nil {
+		t.Errorf("Load() of unknown key succeeded, want an error")
+	}
+	if _, err := Load(writeConfig(t, "preset: fast\n")); err == nil {
+		t.Errorf("Load() of mistyped value succeeded, want an error")
+	}
+	if cfg, err := Load(writeConfig(t, "")); err != nil || !reflect.DeepEqual(cfg, Config{}) {
+		t.Errorf("Load() of empty file = %+v, %v, want an empty config", cfg, err)
+	}
+}
+
+// multiFlag is a repeatable flag like -exclude.
+type multiFlag []string
+
+func (m *multiFlag) String() string     { return strings.Join(*m, ",") }
+func (m *multiFlag) Set(v string) error { *m = append(*m, v); return nil }
+
+func TestApplyPrecedence(t *testing.T) {
+	fs := flag.NewFlagSet("transcoder", flag.ContinueOnError)
+	preset := fs.Int("preset", 6, "")
+	crf := fs.Int("crf", 24, "")
+	twoPass := fs.Bool("two-pass", false, "")
+	encoder := fs.String("encoder", "svtav1", "")
+	audioCodec := fs.String("audio-codec", "libopus", "")
+	minDuration := fs.Duration("min-duration", 0, "")
+	tempLocation := fs.String("temp-location", "hidden", "")
+	var exclude multiFlag
+	fs.Var(&exclude, "exclude", "")
+	for _, name := range []string{"docker-image", "audio-langs"} {
+		fs.String(name, "", "")
+	}
+	fs.Float64("min-vmaf", 0, "")
+
+	if err := fs.Parse([]string{"-crf", "30"}); err != nil {
+		t.Fatal(err)
+	}
+	cfg, err := Load(writeConfig(t, testConfig))
+	if err != nil {
+		t.Fatalf("Load() error: %v", err)
+	}
+	if err := Apply(fs, cfg); err != nil {
+		t.Fatalf("Apply() error: %v", err)
+	}
+
+	if *crf != 30 {
+		t.Errorf("-crf = %d, want the command line's 30 over the config's 28", *crf)
+	}
+	if *preset != 4 || !*twoPass || *minDuration != 2*time.Minute || *tempLocation != "subdir" {
+		t.Errorf("-preset %d -two-pass %v -min-duration %s -temp-location %s, want the config's 4 true 2m subdir", *preset, *twoPass, *minDuration, *tempLocation)
+	}
+	if *encoder != "svtav1" || *audioCodec != "libopus" {
+		t.Errorf("-encoder %s -audio-codec %s, want defaults", *encoder, *audioCodec)
+	}
+	if !slices.Equal(exclude, []string{"**/Extras/**", "*sample*"}) {
+		t.Errorf("-exclude = %v, want both config globs", exclude)
+	}
+
+	cfg.Flags = map[string]string{"no-such-flag": "1"}
+	if err := Apply(flag.NewFlagSet("empty", flag.ContinueOnError), Config{Flags: cfg.Flags}); err == nil {
+		t.Errorf("Apply() of unknown flag succeeded, want an error")
+	}
+}
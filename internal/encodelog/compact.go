@@ -0,0 +1,135 @@
+package encodelog
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/gofrs/flock"
+)
+
+// CompactResult counts what Compact did with the lines of a log.
+type CompactResult struct {
+	Kept    int // latest entry of each input and output
+	Dropped int // entries superseded by a later entry for the same input and output
+	Invalid int // lines kept verbatim because they don't parse, e.g. a line truncated by a crash
+}
+
+// Compact rewrites the log keeping only the latest entry for each input and output pair, the one lookups act on.
+// Entries are kept verbatim in the order of their latest occurrence. The log is locked for the rewrite, which is
+// written to a temp file and renamed over the log so that a crash can't lose it.
+func Compact(filename string) (CompactResult, error) {
+	var result CompactResult
+
+	lock := flock.New(filename + ".lock")
+	if err := lock.Lock(); err != nil {
+		return result, err
+	}
+	defer lock.Unlock()
+
+	f, err := os.Open(filename)
+	if err != nil {
+		return result, err
+	}
+	defer f.Close()
+
+	type line struct {
+		data  []byte
+		key   Key
+		valid bool
+	}
+	var lines []line
+	latest := make(map[Key]int) // index of the latest line of each key
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 0, 64*1024), maxLineSize)
+	for scanner.Scan() {
+		data := bytes.TrimSpace(scanner.Bytes())
+		if len(data) == 0 {
+			continue
+		}
+		l := line{data: bytes.Clone(data)}
+		var entry LogFileEntry
+		if err := json.Unmarshal(data, &entry); err == nil {
+			l.key, l.valid = entry.Key(), true
+			latest[l.key] = len(lines)
+		}
+		lines = append(lines, l)
+	}
+	if err := scanner.Err(); err != nil {
+		return result, err
+	}
+
+	var compacted bytes.Buffer
+	for i, l := range lines {
+		switch {
+		case !l.valid:
+			result.Invalid++
+		case latest[l.key] != i:
+			result.Dropped++
+			continue
+		default:
+			result.Kept++
+		}
+		compacted.Write(l.data)
+		compacted.WriteByte('\n')
+	}
+
+	info, err := f.Stat()
+	if err != nil {
+		return result, err
+	}
+	tmpfile := filename + ".compact.tmp"
+	if err := os.WriteFile(tmpfile, compacted.Bytes(), info.Mode().Perm()); err != nil {
+		os.Remove(tmpfile)
+		return result, err
+	}
+	if err := os.Rename(tmpfile, filename); err != nil {
+		os.Remove(tmpfile)
+		return result, err
+	}
+	return result, nil
+}
+
+// Rotate moves the log to <log>.1 if it is at least maxBytes large, shifting earlier rotations up to <log>.<keep>
+// and deleting the oldest. An empty log takes its place. Entries in rotated logs are no longer consulted, a file
+// they covered is examined again and skipped because its output exists. It reports whether the log was rotated.
+func Rotate(filename string, maxBytes int64, keep int) (bool, error) {
+	if keep < 1 {
+		return false, fmt.Errorf("keep must be at least 1")
+	}
+
+	lock := flock.New(filename + ".lock")
+	if err := lock.Lock(); err != nil {
+		return false, err
+	}
+	defer lock.Unlock()
+
+	info, err := os.Stat(filename)
+	if err != nil {
+		return false, err
+	}
+	if info.Size() < maxBytes {
+		return false, nil
+	}
+
+	rotated := func(n int) string { return fmt.Sprintf("%s.%d", filename, n) }
+	if err := os.Remove(rotated(keep)); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return false, err
+	}
+	for n := keep - 1; n >= 1; n-- {
+		if err := os.Rename(rotated(n), rotated(n+1)); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return false, err
+		}
+	}
+	if err := os.Rename(filename, rotated(1)); err != nil {
+		return false, err
+	}
+	// readers expect the log to exist
+	if err := os.WriteFile(filename, nil, info.Mode().Perm()); err != nil {
+		return true, fmt.Errorf("creating a new log, the old one is at %q: %w", rotated(1), err)
+	}
+	return true, nil
+}
@@ -0,0 +1,79 @@
+package encodelog
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestCompact(t *testing.T) {
+	logFile := filepath.Join(t.TempDir(), "transcode.log")
+	for _, entry := range []LogFileEntry{
+		{InputPath: "a.mkv", OutputPath: "a-svtav1enc.mkv", Error: "exit status 1"},
+		{InputPath: "b.mkv", OutputPath: "b-svtav1enc.mkv", Skipped: "temp file exists", Retry: true},
+		{InputPath: "a.mkv", OutputPath: "a-svtav1enc.mkv", Duration: "1h0m0s"},
+		{InputPath: "a.mkv", OutputPath: "a-svtav1enc.mp4", Duration: "1h0m0s"},
+		{InputPath: "b.mkv", OutputPath: "b-svtav1enc.mkv", Duration: "30m0s"},
+	} {
+		if err := AppendLog(logFile, entry); err != nil {
+			t.Fatal(err)
+		}
+	}
+	f, err := os.OpenFile(logFile, os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.WriteString(`{"input":"c.mk` + "\n")
+	f.Close()
+
+	result, err := Compact(logFile)
+	if err != nil {
+		t.Fatalf("Compact() error: %v", err)
+	}
+	if result != (CompactResult{Kept: 3, Dropped: 2, Invalid: 1}) {
+		t.Errorf("Compact() = %+v, want 3 kept, 2 dropped and 1 invalid", result)
+	}
+
+	entries, err := ReadLog(logFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, entry := range entries {
+		got = append(got, entry.OutputPath+" "+entry.Duration)
+	}
+	want := []string{"a-svtav1enc.mkv 1h0m0s", "a-svtav1enc.mp4 1h0m0s", "b-svtav1enc.mkv 30m0s"}
+	if fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Errorf("compacted log = %v, want %v", got, want)
+	}
+}
+
+func TestRotate(t *testing.T) {
+	logFile := filepath.Join(t.TempDir(), "transcode.log")
+	write := func(content string) {
+		if err := os.WriteFile(logFile, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	write("small\n")
+	if rotated, err := Rotate(logFile, 100, 2); err != nil || rotated {
+		t.Errorf("Rotate() of a small log = %v, %v, want not rotated", rotated, err)
+	}
+
+	for _, content := range []string{"first\n", "second\n", "third\n"} {
+		write(content)
+		if rotated, err := Rotate(logFile, 1, 2); err != nil || !rotated {
+			t.Fatalf("Rotate() = %v, %v, want rotated", rotated, err)
+		}
+	}
+	for name, want := range map[string]string{logFile: "", logFile + ".1": "third\n", logFile + ".2": "second\n"} {
+		if data, err := os.ReadFile(name); err != nil || string(data) != want {
+			t.Errorf("%s = %q, %v, want %q", filepath.Base(name), data, err, want)
+		}
+	}
+	if _, err := os.Stat(logFile + ".3"); err == nil {
+		t.Errorf("Rotate() kept more than 2 rotations")
+	}
+}
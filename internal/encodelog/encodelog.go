@@ -9,6 +9,9 @@ import (
 	"go.uber.org/zap"
 )
 
+// maxLineSize bounds the length of a single log entry, entries carry the full ffmpeg command so may be long.
+const maxLineSize = 1 << 20
+
 type LogFileEntry struct {
 	InputPath  string   `json:"input,omitempty"`
 	OutputPath string   `json:"output,omitempty"`
@@ -17,50 +20,167 @@ type LogFileEntry struct {
 	Args       []string `json:"args,omitempty"`
 	Error      string   `json:"error,omitempty"`
 	Skipped    string   `json:"skipped,omitempty"`
+	Retry      bool     `json:"retry,omitempty"` // the skip or error is transient and the item should be examined again next run
+	Mode       string   `json:"mode,omitempty"`  // encode mode if not a quality encode e.g. preview
+	TwoPass    bool     `json:"two_pass,omitempty"`
+	Attempts   int      `json:"attempts,omitempty"` // encoder runs including retries, only recorded when -max-retries is set
+
+	OutputDecodeErrors int `json:"output_decode_errors,omitempty"` // errors found by a full decode of the output, see -decode-check
+
+	// frame counts of the source's video stream and the output's, see -frame-check
+	ExpectedFrames int `json:"expected_frames,omitempty"`
+	OutputFrames   int `json:"output_frames,omitempty"`
+
+	// identity of the source when the entry was written, used to notice a different file replacing it at the same path
+	InputSizeBytes int64  `json:"input_size_bytes,omitempty"`
+	InputModTime   string `json:"input_mod_time,omitempty"`
+
+	OutputSizeBytes int64 `json:"output_size_bytes,omitempty"` // size of a successful encode, compare with InputSizeBytes
+
+	ProbeFailures int `json:"probe_failures,omitempty"` // consecutive ffprobe failures of the same source file
+
+	// versions of the tools that produced the encode
+	FFmpegVersion string `json:"ffmpeg_version,omitempty"`
+	SvtAv1Version string `json:"svtav1_version,omitempty"`
+
+	Decisions []StreamDecision `json:"decisions,omitempty"`
+	Crop      string           `json:"crop,omitempty"` // -autocrop filter applied to the source's video e.g. crop=1920:800:0:140
+
+	// quality scores of the output compared against the source, see -quality-metric
+	VMAF            float64 `json:"vmaf,omitempty"`
+	SSIM            float64 `json:"ssim,omitempty"`
+	QualitySampling string  `json:"quality_sampling,omitempty"` // which frames the scores were computed over
+}
+
+// StreamDecision records what was done with a single source stream and why.
+type StreamDecision struct {
+	Stream string `json:"stream"`           // ffmpeg stream specifier of the source stream e.g. 0:a:1
+	Action string `json:"action"`           // copy, encode, downmix, drop
+	Reason string `json:"reason,omitempty"` // human readable explanation
+}
+
+func (d StreamDecision) String() string {
+	if d.Reason == "" {
+		return d.Stream + " " + d.Action
+	}
+	return d.Stream + " " + d.Action + " (" + d.Reason + ")"
 }
 
+// AppendLog appends entry to the log as a single line. The line is written with a single write so that a crash
+// leaves at most a partial last line, which is skipped when reading and terminated before the next entry is
+// appended so that it doesn't corrupt that entry too.
 func AppendLog(filename string, entry LogFileEntry) error {
+	line, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	line = append(line, '\n')
+
 	lock := flock.New(filename + ".lock")
 	if err := lock.Lock(); err != nil {
 		return err
 	}
 	defer lock.Unlock()
-	f, err := os.OpenFile(filename, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	f, err := os.OpenFile(filename, os.O_APPEND|os.O_CREATE|os.O_RDWR, 0644)
 	if err != nil {
 		return err
 	}
 	defer f.Close()
-	enc := json.NewEncoder(f)
-	if err := enc.Encode(entry); err != nil {
+
+	partial, err := endsWithPartialLine(f)
+	if err != nil {
+		return err
+	}
+	if partial {
+		line = append([]byte{'\n'}, line...)
+	}
+	if _, err := f.Write(line); err != nil {
 		return err
 	}
-	return nil
+	return f.Close()
+}
+
+// endsWithPartialLine reports whether f is non-empty and its last line is missing its newline.
+func endsWithPartialLine(f *os.File) (bool, error) {
+	info, err := f.Stat()
+	if err != nil || info.Size() == 0 {
+		return false, err
+	}
+	last := make([]byte, 1)
+	if _, err := f.ReadAt(last, info.Size()-1); err != nil {
+		return false, err
+	}
+	return last[0] != '\n', nil
+}
+
+// Key identifies what an entry is about, an input encoded to an output. A file attempted again gets another entry
+// with the same key, the latest entry of a key is the one that counts.
+type Key struct {
+	InputPath  string
+	OutputPath string
+}
+
+func (e LogFileEntry) Key() Key {
+	return Key{InputPath: e.InputPath, OutputPath: e.OutputPath}
+}
+
+// Index returns the latest entry of each output path in entries, which are in log order.
+func Index(entries []LogFileEntry) map[string]LogFileEntry {
+	index := make(map[string]LogFileEntry, len(entries))
+	for _, entry := range entries {
+		index[entry.OutputPath] = entry
+	}
+	return index
+}
+
+// ScanIndex reads the latest entry of each key in the log without holding superseded entries in memory.
+func ScanIndex(filename string) (map[Key]LogFileEntry, error) {
+	index := make(map[Key]LogFileEntry)
+	err := ScanLog(filename, func(entry LogFileEntry) error {
+		index[entry.Key()] = entry
+		return nil
+	})
+	return index, err
 }
 
 func ReadLog(filename string) ([]LogFileEntry, error) {
+	var entries []LogFileEntry
+	if err := ScanLog(filename, func(entry LogFileEntry) error {
+		entries = append(entries, entry)
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+	return entries, nil
+}
+
+// ScanLog streams the entries of the log to fn in order under the read lock without holding the whole log in
+// memory. Scanning stops at the first error returned by fn which is returned by ScanLog.
+func ScanLog(filename string, fn func(LogFileEntry) error) error {
 	lock := flock.New(filename + ".lock")
 	if err := lock.RLock(); err != nil {
-		return nil, err
+		return err
 	}
 	defer lock.Unlock()
 
 	f, err := os.Open(filename)
 	if err != nil {
-		return nil, err
+		return err
 	}
+	defer f.Close()
+
 	// parse the file line by line as NDJSON
-	var entries []LogFileEntry
 	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 0, 64*1024), maxLineSize)
 	for scanner.Scan() {
 		var entry LogFileEntry
 		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
 			zap.S().Warnf("failed to parse transcode log entry: %v", err)
 			continue
 		}
-		entries = append(entries, entry)
-	}
-	if err := scanner.Err(); err != nil {
-		return nil, err
+		if err := fn(entry); err != nil {
+			return err
+		}
 	}
-	return entries, nil
+	return scanner.Err()
 }
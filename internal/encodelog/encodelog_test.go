@@ -0,0 +1,126 @@
+package encodelog
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestScanLog(t *testing.T) {
+	logFile := filepath.Join(t.TempDir(), "transcode.log")
+	for _, input := range []string{"a.mkv", "b.mkv", "c.mkv"} {
+		if err := AppendLog(logFile, LogFileEntry{InputPath: input}); err != nil {
+			t.Fatalf("AppendLog() error: %v", err)
+		}
+	}
+
+	var seen []string
+	if err := ScanLog(logFile, func(entry LogFileEntry) error {
+		seen = append(seen, entry.InputPath)
+		return nil
+	}); err != nil {
+		t.Fatalf("ScanLog() error: %v", err)
+	}
+	if len(seen) != 3 || seen[0] != "a.mkv" || seen[2] != "c.mkv" {
+		t.Errorf("ScanLog() visited %v, want [a.mkv b.mkv c.mkv]", seen)
+	}
+
+	errStop := errors.New("stop")
+	count := 0
+	err := ScanLog(logFile, func(entry LogFileEntry) error {
+		count++
+		return errStop
+	})
+	if !errors.Is(err, errStop) || count != 1 {
+		t.Errorf("ScanLog() = %v after %d entries, want errStop after 1", err, count)
+	}
+}
+
+func TestAppendLogConcurrent(t *testing.T) {
+	logFile := filepath.Join(t.TempDir(), "transcode.log")
+	const writers, perWriter = 8, 25
+	var wg sync.WaitGroup
+	for w := 0; w < writers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < perWriter; i++ {
+				entry := LogFileEntry{InputPath: fmt.Sprintf("%d-%d.mkv", w, i), Args: []string{"ffmpeg", strings.Repeat("-x ", 500)}}
+				if err := AppendLog(logFile, entry); err != nil {
+					t.Errorf("AppendLog() error: %v", err)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	entries, err := ReadLog(logFile)
+	if err != nil {
+		t.Fatalf("ReadLog() error: %v", err)
+	}
+	seen := make(map[string]bool)
+	for _, entry := range entries {
+		seen[entry.InputPath] = true
+	}
+	if len(entries) != writers*perWriter || len(seen) != writers*perWriter {
+		t.Errorf("ReadLog() = %d entries of %d inputs, want %d", len(entries), len(seen), writers*perWriter)
+	}
+}
+
+func TestAppendLogAfterPartialLine(t *testing.T) {
+	logFile := filepath.Join(t.TempDir(), "transcode.log")
+	if err := AppendLog(logFile, LogFileEntry{InputPath: "a.mkv"}); err != nil {
+		t.Fatal(err)
+	}
+	// a crash while appending leaves a truncated line
+	f, err := os.OpenFile(logFile, os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.WriteString(`{"input":"b.mk`)
+	f.Close()
+
+	entries, err := ReadLog(logFile)
+	if err != nil || len(entries) != 1 || entries[0].InputPath != "a.mkv" {
+		t.Errorf("ReadLog() with a partial last line = %+v, %v, want the complete entry", entries, err)
+	}
+
+	if err := AppendLog(logFile, LogFileEntry{InputPath: "c.mkv"}); err != nil {
+		t.Fatal(err)
+	}
+	entries, err = ReadLog(logFile)
+	if err != nil || len(entries) != 2 || entries[1].InputPath != "c.mkv" {
+		t.Errorf("ReadLog() after appending past a partial line = %+v, %v, want a.mkv and c.mkv", entries, err)
+	}
+}
+
+func TestIndex(t *testing.T) {
+	logFile := filepath.Join(t.TempDir(), "transcode.log")
+	entries := []LogFileEntry{
+		{InputPath: "a.mkv", OutputPath: "a-svtav1enc.mkv", Error: "exit status 1"},
+		{InputPath: "a.mp4", OutputPath: "a-svtav1enc.mkv", Skipped: "output exists"},
+		{InputPath: "a.mkv", OutputPath: "a-svtav1enc.mkv", Duration: "1h0m0s"},
+	}
+	for _, entry := range entries {
+		if err := AppendLog(logFile, entry); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	byOutput := Index(entries)
+	if len(byOutput) != 1 || byOutput["a-svtav1enc.mkv"].Duration != "1h0m0s" {
+		t.Errorf("Index() = %+v, want the latest entry of a-svtav1enc.mkv", byOutput)
+	}
+
+	byKey, err := ScanIndex(logFile)
+	if err != nil {
+		t.Fatalf("ScanIndex() error: %v", err)
+	}
+	if len(byKey) != 2 || byKey[entries[0].Key()].Duration != "1h0m0s" || byKey[entries[1].Key()].Skipped != "output exists" {
+		t.Errorf("ScanIndex() = %+v, want the latest entry of each input and output", byKey)
+	}
+}
@@ -0,0 +1,86 @@
+package encodelog
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/gofrs/flock"
+)
+
+// MigrateResult counts what MigrateLog did with the entries of a log.
+type MigrateResult struct {
+	Rewritten int // entries rewritten in the canonical format
+	Kept      int // lines kept verbatim because they have fields the canonical format doesn't know, or don't parse
+}
+
+// MigrateLog rewrites a log written by older builds, which wrote every field even when empty, in the canonical
+// format that omits empty fields. The original is moved to backup first, which must not exist yet. Lines with fields
+// the canonical format doesn't know are kept verbatim so that no data is lost.
+func MigrateLog(filename, backup string) (MigrateResult, error) {
+	var result MigrateResult
+
+	lock := flock.New(filename + ".lock")
+	if err := lock.Lock(); err != nil {
+		return result, err
+	}
+	defer lock.Unlock()
+
+	if _, err := os.Lstat(backup); err == nil {
+		return result, fmt.Errorf("backup %q already exists", backup)
+	} else if !errors.Is(err, os.ErrNotExist) {
+		return result, err
+	}
+
+	f, err := os.Open(filename)
+	if err != nil {
+		return result, err
+	}
+	defer f.Close()
+
+	var migrated bytes.Buffer
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 0, 64*1024), maxLineSize)
+	for scanner.Scan() {
+		line := scanner.Bytes()
+		if len(bytes.TrimSpace(line)) == 0 {
+			continue
+		}
+		var entry LogFileEntry
+		dec := json.NewDecoder(bytes.NewReader(line))
+		dec.DisallowUnknownFields()
+		if err := dec.Decode(&entry); err != nil {
+			migrated.Write(line)
+			migrated.WriteByte('\n')
+			result.Kept++
+			continue
+		}
+		if err := json.NewEncoder(&migrated).Encode(entry); err != nil {
+			return result, err
+		}
+		result.Rewritten++
+	}
+	if err := scanner.Err(); err != nil {
+		return result, err
+	}
+
+	info, err := f.Stat()
+	if err != nil {
+		return result, err
+	}
+	tmpfile := filename + ".migrate.tmp"
+	if err := os.WriteFile(tmpfile, migrated.Bytes(), info.Mode().Perm()); err != nil {
+		return result, err
+	}
+	if err := os.Rename(filename, backup); err != nil {
+		os.Remove(tmpfile)
+		return result, err
+	}
+	if err := os.Rename(tmpfile, filename); err != nil {
+		return result, fmt.Errorf("moving migrated log into place, the original is at %q: %w", backup, err)
+	}
+	return result, nil
+}
@@ -0,0 +1,53 @@
+package encodelog
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestMigrateLog(t *testing.T) {
+	dir := t.TempDir()
+	logFile := filepath.Join(dir, "transcode.log")
+	backup := logFile + ".bak"
+	legacy := `{"input":"/media/a.mkv","output":"/media/a-svtav1enc.mkv","start_time":"2024-01-01T00:00:00Z","duration":"1h0m0s","args":["ffmpeg"],"error":"","skipped":""}
+{"input":"/media/b.mkv","output":"/media/b-svtav1enc.mkv","error":"","skipped":"already low bitrate","retry":false}
+{"input":"/media/c.mkv","legacy_field":"keep me"}
+`
+	if err := os.WriteFile(logFile, []byte(legacy), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	result, err := MigrateLog(logFile, backup)
+	if err != nil {
+		t.Fatalf("MigrateLog() error: %v", err)
+	}
+	if result.Rewritten != 2 || result.Kept != 1 {
+		t.Errorf("MigrateLog() = %+v, want 2 rewritten and 1 kept", result)
+	}
+
+	data, err := os.ReadFile(logFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+	if len(lines) != 3 {
+		t.Fatalf("migrated log has %d lines, want 3:\n%s", len(lines), data)
+	}
+	if strings.Contains(lines[0], `"error"`) || strings.Contains(lines[1], `"retry"`) {
+		t.Errorf("migrated entries still have empty fields:\n%s", data)
+	}
+	if !strings.Contains(lines[1], `"skipped":"already low bitrate"`) || !strings.Contains(lines[2], `"legacy_field":"keep me"`) {
+		t.Errorf("migrated log lost data:\n%s", data)
+	}
+
+	original, err := os.ReadFile(backup)
+	if err != nil || string(original) != legacy {
+		t.Errorf("backup = %q, %v, want the original log", original, err)
+	}
+
+	if _, err := MigrateLog(logFile, backup); err == nil {
+		t.Errorf("MigrateLog() with an existing backup succeeded, want an error")
+	}
+}
@@ -14,5 +14,16 @@ var (
 		".m4v",
 		".3gp",
 		".3g2",
+		".ts",
+		".m2ts",
+		".mts",
+	}
+
+	// UnreliableContainerExts are containers without reliable headers e.g. MPEG-TS recordings, ffprobe's quick
+	// probe often misses streams or misreports durations for these so they are probed thoroughly.
+	UnreliableContainerExts []string = []string{
+		".ts",
+		".m2ts",
+		".mts",
 	}
 )
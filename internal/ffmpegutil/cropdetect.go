@@ -0,0 +1,113 @@
+package ffmpegutil
+
+import (
+	"bytes"
+	"fmt"
+	"os/exec"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+const (
+	cropSamples       = 5 // clips spread across the file that must agree on the crop
+	cropSampleSeconds = 2 // length of each clip
+)
+
+// Crop is a crop rectangle as cropdetect reports it, Width x Height at offset X,Y of the frame.
+type Crop struct {
+	Width, Height int
+	X, Y          int
+}
+
+// Filter returns the crop filter applying the rectangle.
+func (c Crop) Filter() string {
+	return fmt.Sprintf("crop=%d:%d:%d:%d", c.Width, c.Height, c.X, c.Y)
+}
+
+// ParseCrop parses a crop filter as returned by Filter e.g. crop=1920:800:0:140.
+func ParseCrop(filter string) (Crop, error) {
+	m := cropdetectPattern.FindStringSubmatch(filter)
+	if m == nil || m[0] != filter {
+		return Crop{}, fmt.Errorf("invalid crop %q, want crop=w:h:x:y", filter)
+	}
+	return cropFromMatch(m), nil
+}
+
+// cropdetect ends each frame's report with the crop filter it suggests e.g. crop=1920:800:0:140. It suggests
+// negative sizes until it has seen enough frames, those don't match.
+var cropdetectPattern = regexp.MustCompile(`crop=(\d+):(\d+):(\d+):(\d+)`)
+
+// cropFromMatch converts a match of cropdetectPattern to a Crop.
+func cropFromMatch(m []string) Crop {
+	var c Crop
+	c.Width, _ = strconv.Atoi(m[1])
+	c.Height, _ = strconv.Atoi(m[2])
+	c.X, _ = strconv.Atoi(m[3])
+	c.Y, _ = strconv.Atoi(m[4])
+	return c
+}
+
+// DominantCrop returns the crop suggested most often in cropdetect's output lines, ties go to the one suggested
+// first. It returns false if no line suggests a crop.
+func DominantCrop(lines []string) (Crop, bool) {
+	counts := make(map[Crop]int)
+	var best Crop
+	for _, line := range lines {
+		m := cropdetectPattern.FindStringSubmatch(line)
+		if m == nil {
+			continue
+		}
+		c := cropFromMatch(m)
+		if c.Width == 0 || c.Height == 0 {
+			continue
+		}
+		counts[c]++
+		if counts[c] > counts[best] {
+			best = c
+		}
+	}
+	return best, len(counts) > 0
+}
+
+// DetectCrop runs cropdetect over short clips of a video stream, the N in 0:v:N, spread across a file and returns
+// the crop they all agree on. It returns false if the clips disagree e.g. because of a dark scene or a change of
+// aspect ratio, or if the file's duration is unknown so that clips can't be spread across it. This costs a decode of
+// a few seconds per clip.
+func DetectCrop(videoFileName string, videoIdx int, durationSeconds float64) (Crop, bool, error) {
+	if durationSeconds <= 0 {
+		return Crop{}, false, nil
+	}
+	var agreed Crop
+	for i := range cropSamples {
+		offset := durationSeconds * float64(i+1) / float64(cropSamples+1)
+		lines, err := runCropdetect(videoFileName, videoIdx, offset)
+		if err != nil {
+			return Crop{}, false, err
+		}
+		crop, ok := DominantCrop(lines)
+		if !ok || (i > 0 && crop != agreed) {
+			return Crop{}, false, nil
+		}
+		agreed = crop
+	}
+	return agreed, true, nil
+}
+
+// runCropdetect runs cropdetect over a clip of a video stream starting offset seconds into the file and returns its
+// output lines.
+func runCropdetect(videoFileName string, videoIdx int, offset float64) ([]string, error) {
+	args := []string{"-nostdin", "-hide_banner", "-ss", strconv.FormatFloat(offset, 'f', 3, 64)}
+	args = append(args, ThoroughProbeArgs(videoFileName)...)
+	args = append(args, "-i", videoFileName,
+		"-map", fmt.Sprintf("0:v:%d", videoIdx), "-t", strconv.Itoa(cropSampleSeconds),
+		"-vf", "cropdetect=round=2", "-f", "null", "-")
+
+	cmd := exec.Command("nice", append([]string{"-n", "19", "ffmpeg"}, args...)...)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return nil, fmt.Errorf("cropdetect failed: %w", err)
+	}
+	return strings.Split(stderr.String(), "\n"), nil
+}
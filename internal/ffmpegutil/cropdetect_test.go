@@ -0,0 +1,30 @@
+package ffmpegutil
+
+import "testing"
+
+func TestDominantCrop(t *testing.T) {
+	lines := []string{
+		"Input #0, matroska,webm, from 'in.mkv':",
+		"[Parsed_cropdetect_0 @ 0x55d0c8] x1:1919 x2:0 y1:1079 y2:0 w:-1904 h:-1072 x:1914 y:1076 pts:0 t:0.000000 limit:0.094118 crop=-1904:-1072:1914:1076",
+		"[Parsed_cropdetect_0 @ 0x55d0c8] x1:0 x2:1919 y1:140 y2:939 w:1920 h:800 x:0 y:140 pts:42 t:0.042000 limit:0.094118 crop=1920:800:0:140",
+		"[Parsed_cropdetect_0 @ 0x55d0c8] x1:0 x2:1919 y1:100 y2:979 w:1920 h:880 x:0 y:100 pts:83 t:0.083000 limit:0.094118 crop=1920:880:0:100",
+		"[Parsed_cropdetect_0 @ 0x55d0c8] x1:0 x2:1919 y1:140 y2:939 w:1920 h:800 x:0 y:140 pts:125 t:0.125000 limit:0.094118 crop=1920:800:0:140",
+	}
+	crop, ok := DominantCrop(lines)
+	if want := (Crop{Width: 1920, Height: 800, X: 0, Y: 140}); !ok || crop != want {
+		t.Errorf("DominantCrop() = %+v, %v, want %+v, true", crop, ok, want)
+	}
+	if got := crop.Filter(); got != "crop=1920:800:0:140" {
+		t.Errorf("Filter() = %q, want crop=1920:800:0:140", got)
+	}
+	if parsed, err := ParseCrop(crop.Filter()); err != nil || parsed != crop {
+		t.Errorf("ParseCrop(%q) = %+v, %v, want %+v", crop.Filter(), parsed, err, crop)
+	}
+	if _, err := ParseCrop("crop=1920:800"); err == nil {
+		t.Errorf("ParseCrop() of an incomplete crop succeeded, want an error")
+	}
+
+	if _, ok := DominantCrop(lines[:2]); ok {
+		t.Errorf("DominantCrop() without a valid suggestion = true, want false")
+	}
+}
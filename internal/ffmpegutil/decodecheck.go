@@ -0,0 +1,40 @@
+package ffmpegutil
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os/exec"
+	"strings"
+)
+
+// CountDecodeErrors fully decodes a file and returns the number of errors ffmpeg reports e.g. corrupt frames. This
+// is expensive, it costs a full decode of every stream.
+func CountDecodeErrors(videoFileName string) (int, error) {
+	args := []string{"-nostdin", "-hide_banner", "-v", "error"}
+	args = append(args, ThoroughProbeArgs(videoFileName)...)
+	args = append(args, "-i", videoFileName, "-f", "null", "-")
+
+	cmd := exec.Command("nice", append([]string{"-n", "19", "ffmpeg"}, args...)...)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	err := cmd.Run()
+
+	count := countErrorLines(stderr.String())
+	var exitErr *exec.ExitError
+	if err != nil && (!errors.As(err, &exitErr) || count == 0) {
+		return count, fmt.Errorf("decode check failed: %w", err)
+	}
+	return count, nil
+}
+
+// countErrorLines counts the non-empty lines of ffmpeg's output at -v error, each is a separate error report.
+func countErrorLines(output string) int {
+	count := 0
+	for _, line := range strings.Split(output, "\n") {
+		if strings.TrimSpace(line) != "" {
+			count++
+		}
+	}
+	return count
+}
@@ -0,0 +1,16 @@
+package ffmpegutil
+
+import "testing"
+
+func TestCountErrorLines(t *testing.T) {
+	output := "[h264 @ 0x55e] error while decoding MB 23 41, bytestream -5\n" +
+		"[h264 @ 0x55e] concealing 1450 DC, 1450 AC, 1450 MV errors in P frame\n" +
+		"\n" +
+		"[aac @ 0x55f] Input buffer exhausted before END element found\n"
+	if got := countErrorLines(output); got != 3 {
+		t.Errorf("countErrorLines() = %d, want 3", got)
+	}
+	if got := countErrorLines(""); got != 0 {
+		t.Errorf("countErrorLines(\"\") = %d, want 0", got)
+	}
+}
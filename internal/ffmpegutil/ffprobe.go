@@ -2,10 +2,18 @@ package ffmpegutil
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
+	"math"
+	"os"
 	"os/exec"
+	"path/filepath"
+	"regexp"
+	"slices"
 	"strconv"
 	"strings"
+	"time"
 
 	"go.uber.org/zap"
 )
@@ -21,11 +29,151 @@ type StreamData struct {
 	// Size
 	Width  int `json:"width"`
 	Height int `json:"height"`
+	// Aspect ratios as e.g. 32:27, the shape of a pixel and of the displayed picture. Anamorphic video e.g. DVDs
+	// has non-square pixels so its coded size differs from the displayed size.
+	SampleAspectRatio  string `json:"sample_aspect_ratio"`
+	DisplayAspectRatio string `json:"display_aspect_ratio"`
+	// Frame rates as fractions e.g. 24000/1001
+	AvgFrameRate string `json:"avg_frame_rate"`
+	RFrameRate   string `json:"r_frame_rate"`
+	// Pixel format e.g. yuv420p10le and the bits per sample the decoder reports, which is often missing
+	PixFmt           string `json:"pix_fmt"`
+	BitsPerRawSample string `json:"bits_per_raw_sample"`
+	NbFrames         string `json:"nb_frames"` // frame count recorded by the container, often missing e.g. in Matroska
+	Duration         string `json:"duration"`  // seconds, often missing e.g. in Matroska which has a DURATION tag instead
 
 	// Tags
 	Tags struct {
-		Language string `json:"language"`
+		Language       string `json:"language"`
+		Title          string `json:"title"`            // track name e.g. Director's Commentary
+		NumberOfFrames string `json:"NUMBER_OF_FRAMES"` // frame count statistics tag written by mkvmerge
+		Duration       string `json:"DURATION"`         // e.g. 01:23:45.678000000, written by mkvmerge and ffmpeg
 	} `json:"tags"`
+
+	Disposition struct {
+		AttachedPic int `json:"attached_pic"`
+	} `json:"disposition"`
+
+	SideDataList []SideData `json:"side_data_list"`
+}
+
+// SideData is an entry of the side data ffprobe reports for a stream or frame.
+type SideData struct {
+	SideDataType string `json:"side_data_type"`
+	// Dolby Vision configuration record fields, profile 5 has no HDR10 compatible base layer
+	DvProfile                 int `json:"dv_profile"`
+	DvBlSignalCompatibilityID int `json:"dv_bl_signal_compatibility_id"`
+}
+
+// Side data types of the HDR dynamic metadata formats.
+const (
+	sideDataDolbyVision = "DOVI configuration record"
+	sideDataHDR10Plus   = "HDR Dynamic Metadata SMPTE2094-40 (HDR10+)"
+)
+
+// FrameRate returns the stream's frames per second, preferring the average frame rate over the base rate. It
+// returns 0 if neither is known.
+func (sd *StreamData) FrameRate() float64 {
+	for _, rate := range []string{sd.AvgFrameRate, sd.RFrameRate} {
+		if fps := parseFrameRate(rate); fps > 0 {
+			return fps
+		}
+	}
+	return 0
+}
+
+// parseFrameRate parses a frame rate as ffprobe prints it, a fraction such as 24000/1001 or a plain number. Unknown
+// rates, which ffprobe prints as 0/0 or N/A, and anything else that isn't a finite positive rate give 0.
+func parseFrameRate(rate string) float64 {
+	num, den, ok := strings.Cut(rate, "/")
+	if !ok {
+		den = "1"
+	}
+	n, err1 := strconv.ParseFloat(num, 64)
+	d, err2 := strconv.ParseFloat(den, 64)
+	if err1 != nil || err2 != nil || d == 0 {
+		return 0
+	}
+	fps := n / d
+	if fps <= 0 || math.IsInf(fps, 0) || math.IsNaN(fps) {
+		return 0
+	}
+	return fps
+}
+
+// SampleAspect returns the width of a pixel relative to its height, 0 if unknown.
+func (sd *StreamData) SampleAspect() float64 {
+	return parseRatio(sd.SampleAspectRatio)
+}
+
+// IsAnamorphic reports whether the stream has non-square pixels.
+func (sd *StreamData) IsAnamorphic() bool {
+	sar := sd.SampleAspect()
+	return sar > 0 && sar != 1
+}
+
+// Cropped returns the stream's geometry after crop is applied to it. The pixel shape is unchanged, the zero Crop
+// leaves the stream as it is.
+func (sd *StreamData) Cropped(crop Crop) StreamData {
+	cropped := *sd
+	if crop.Width > 0 && crop.Height > 0 {
+		cropped.Width, cropped.Height = crop.Width, crop.Height
+		cropped.DisplayAspectRatio = "" // described the uncropped frame
+	}
+	return cropped
+}
+
+// DisplayDimensions returns the size the picture is displayed at, the coded width stretched by the sample aspect
+// ratio, or failing that matched to the display aspect ratio, e.g. 853x480 for a 720x480 DVD with a 16:9 display
+// aspect ratio. Without either the coded size is returned.
+func (sd *StreamData) DisplayDimensions() (int, int) {
+	if sar := sd.SampleAspect(); sar > 0 {
+		return int(math.Round(float64(sd.Width) * sar)), sd.Height
+	}
+	if dar := parseRatio(sd.DisplayAspectRatio); dar > 0 && sd.Height > 0 {
+		return int(math.Round(float64(sd.Height) * dar)), sd.Height
+	}
+	return sd.Width, sd.Height
+}
+
+// pixFmtDepthPattern matches the bit depth in the name of a planar or gray pixel format e.g. yuv420p10le or p010le,
+// pixel formats without one e.g. yuv420p or nv12 are 8 bit.
+var pixFmtDepthPattern = regexp.MustCompile(`(?:p|gray)(\d+)(?:le|be)$`)
+
+// BitDepth returns the bits per sample of a video stream e.g. 8 or 10, from bits_per_raw_sample or else the pixel
+// format. It returns 0 if neither is known.
+func (sd *StreamData) BitDepth() int {
+	if bits, err := strconv.Atoi(sd.BitsPerRawSample); err == nil && bits > 0 {
+		return bits
+	}
+	if sd.PixFmt == "" || sd.PixFmt == "unknown" {
+		return 0
+	}
+	if m := pixFmtDepthPattern.FindStringSubmatch(sd.PixFmt); m != nil {
+		if bits, err := strconv.Atoi(m[1]); err == nil && bits > 0 {
+			return bits
+		}
+	}
+	return 8
+}
+
+// parseRatio parses a ratio such as 16:9, ffprobe reports 0:1 or N/A if unknown for which 0 is returned.
+func parseRatio(ratio string) float64 {
+	num, den, ok := strings.Cut(ratio, ":")
+	if !ok {
+		return 0
+	}
+	n, err1 := strconv.ParseFloat(num, 64)
+	d, err2 := strconv.ParseFloat(den, 64)
+	if err1 != nil || err2 != nil || n <= 0 || d <= 0 {
+		return 0
+	}
+	return n / d
+}
+
+// IsAttachedPic reports whether the stream is an embedded picture e.g. cover art, ffprobe reports these as video.
+func (sd *StreamData) IsAttachedPic() bool {
+	return sd.Disposition.AttachedPic == 1
 }
 
 func (sd *StreamData) IsVideo() bool {
@@ -45,6 +193,28 @@ func (sd *StreamData) IsSubtitle() bool {
 	return sd.CodecType == "subtitle"
 }
 
+// textSubtitleCodecs and imageSubtitleCodecs are the subtitle codecs stored as text and as bitmaps respectively.
+var (
+	textSubtitleCodecs  = []string{"subrip", "srt", "ass", "ssa", "mov_text", "webvtt", "text"}
+	imageSubtitleCodecs = []string{"hdmv_pgs_subtitle", "dvd_subtitle", "dvb_subtitle", "xsub"}
+)
+
+// IsTextSubtitle reports whether the stream is a text based subtitle e.g. subrip or ass.
+func (sd *StreamData) IsTextSubtitle() bool {
+	return sd.IsSubtitle() && slices.Contains(textSubtitleCodecs, strings.ToLower(sd.CodecName))
+}
+
+// IsImageSubtitle reports whether the stream is a bitmap subtitle e.g. PGS or VOBSUB, which many containers
+// other than matroska can't carry.
+func (sd *StreamData) IsImageSubtitle() bool {
+	return sd.IsSubtitle() && slices.Contains(imageSubtitleCodecs, strings.ToLower(sd.CodecName))
+}
+
+// IsData reports whether the stream is a data stream e.g. timed metadata such as GPS from an action camera.
+func (sd *StreamData) IsData() bool {
+	return sd.CodecType == "data"
+}
+
 func (sd *StreamData) IsSurroundAudio() bool {
 	return sd.CodecType == "audio" && sd.Channels > 2
 }
@@ -53,26 +223,140 @@ type ProbeData struct {
 	videoFileName string `json:"-"`
 
 	Format struct {
-		BitRate string `json:"bit_rate"`
+		BitRate  string `json:"bit_rate"`
+		Duration string `json:"duration"`
+
+		Tags struct {
+			CreationTime string `json:"creation_time"`
+		} `json:"tags"`
 	} `json:"format"`
 
 	Streams []StreamData `json:"streams"`
+
+	Chapters []ChapterData `json:"chapters"`
+
+	// Frames holds the first video frame when the file has HDR metadata, some dynamic metadata such as HDR10+ is
+	// only carried per frame.
+	Frames []struct {
+		SideDataList []SideData `json:"side_data_list"`
+	} `json:"frames"`
 }
 
-func GetFfprobeInfo(videoFileName string) (ProbeData, error) {
-	// Get file metadata using ffprobe
-	probeCmd := exec.Command("ffprobe",
+// ChapterData is a chapter marker of a file e.g. the scenes of a ripped movie.
+type ChapterData struct {
+	ID        int64  `json:"id"`
+	StartTime string `json:"start_time"` // seconds
+	EndTime   string `json:"end_time"`
+	Tags      struct {
+		Title string `json:"title"`
+	} `json:"tags"`
+}
+
+// HasChapters reports whether the file has chapter markers.
+func (pd *ProbeData) HasChapters() bool {
+	return len(pd.Chapters) > 0
+}
+
+var (
+	// ThoroughAnalyzeDuration and ThoroughProbeSize are used in place of ffprobe's defaults for containers in
+	// UnreliableContainerExts.
+	ThoroughAnalyzeDuration       = 100 * time.Second
+	ThoroughProbeSize       int64 = 100 << 20
+)
+
+// ThoroughProbeArgs returns the input options that make ffprobe / ffmpeg analyze more of the file before
+// deciding on its streams, or nil if the file's container has reliable headers.
+func ThoroughProbeArgs(videoFileName string) []string {
+	if !slices.Contains(UnreliableContainerExts, strings.ToLower(filepath.Ext(videoFileName))) {
+		return nil
+	}
+	return []string{
+		"-analyzeduration", strconv.FormatInt(ThoroughAnalyzeDuration.Microseconds(), 10),
+		"-probesize", strconv.FormatInt(ThoroughProbeSize, 10),
+	}
+}
+
+func probeArgs(videoFileName string) []string {
+	args := []string{
 		"-v", "quiet",
 		"-print_format", "json",
 		"-show_format",
 		"-show_streams",
-		videoFileName,
-	)
+		"-show_chapters",
+	}
+	args = append(args, ThoroughProbeArgs(videoFileName)...)
+	return append(args, videoFileName)
+}
+
+func GetFfprobeInfo(videoFileName string) (ProbeData, error) {
+	// Get file metadata using ffprobe
+	probeCmd := exec.Command("ffprobe", probeArgs(videoFileName)...)
 	probeOutput, err := probeCmd.Output()
 	if err != nil {
-		return ProbeData{}, fmt.Errorf("ffprobe failed: %w", err)
+		return ProbeData{}, probeError(videoFileName, err)
+	}
+	pd, err := parseFfprobeOutput(probeOutput, videoFileName)
+	if err != nil || !pd.HasHDR() {
+		return pd, err
 	}
 
+	// only probe a frame of HDR files, looking for dynamic metadata isn't worth the time for others
+	frameOutput, err := exec.Command("ffprobe", frameProbeArgs(videoFileName)...).Output()
+	if err != nil {
+		zap.S().Warnf("Item %q ffprobe of the first frame failed, HDR10+ metadata can't be detected: %v", videoFileName, err)
+		return pd, nil
+	}
+	if err := json.Unmarshal(frameOutput, &pd); err != nil {
+		zap.S().Warnf("Item %q failed to parse ffprobe frame output: %v", videoFileName, err)
+	}
+	return pd, nil
+}
+
+// ErrProbeRejected marks ffprobe failures that are the file's fault: ffprobe ran to completion on a readable
+// file and couldn't make sense of it. Other failures, e.g. a missing ffprobe binary or a read error, may go away
+// by themselves.
+var ErrProbeRejected = errors.New("ffprobe rejected the file")
+
+// probeError wraps the error of a failed ffprobe run of videoFileName, as ErrProbeRejected if the file is to blame.
+func probeError(videoFileName string, err error) error {
+	var exitErr *exec.ExitError
+	if !errors.As(err, &exitErr) || !exitErr.Exited() {
+		return fmt.Errorf("ffprobe failed: %w", err)
+	}
+	if readErr := checkReadable(videoFileName); readErr != nil {
+		return fmt.Errorf("ffprobe failed, the file can't be read: %w", readErr)
+	}
+	return fmt.Errorf("%w: %w", ErrProbeRejected, err)
+}
+
+// checkReadable reads the start of a file, catching the I/O errors that make any probe of it fail.
+func checkReadable(name string) error {
+	f, err := os.Open(name)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	if _, err := f.Read(make([]byte, 64*1024)); err != nil && !errors.Is(err, io.EOF) {
+		return err
+	}
+	return nil
+}
+
+// frameProbeArgs returns the ffprobe arguments printing the side data of the first video frame.
+func frameProbeArgs(videoFileName string) []string {
+	args := []string{
+		"-v", "quiet",
+		"-print_format", "json",
+		"-select_streams", "v:0",
+		"-read_intervals", "%+#1",
+		"-show_entries", "frame=side_data_list",
+	}
+	args = append(args, ThoroughProbeArgs(videoFileName)...)
+	return append(args, videoFileName)
+}
+
+// parseFfprobeOutput parses the JSON printed by ffprobe -show_format -show_streams -show_chapters for videoFileName.
+func parseFfprobeOutput(probeOutput []byte, videoFileName string) (ProbeData, error) {
 	var pd ProbeData
 	if err := json.Unmarshal(probeOutput, &pd); err != nil {
 		return ProbeData{}, fmt.Errorf("failed to parse ffprobe output: %w", err)
@@ -83,12 +367,39 @@ func GetFfprobeInfo(videoFileName string) (ProbeData, error) {
 	return pd, nil
 }
 
+// HasHDR reports whether the primary video stream is HDR10, HLG or Dolby Vision, the latter may not have HDR color
+// tags e.g. profile 5.
 func (pd *ProbeData) HasHDR() bool {
-	for _, stream := range pd.Streams {
-		if stream.CodecType == "video" {
-			if stream.ColorSpace == "bt2020nc" && (stream.ColorTransfer == "arib-std-b67" || stream.ColorTransfer == "smpte2084") {
-				return true
-			}
+	if pd.HasDolbyVision() {
+		return true
+	}
+	stream := pd.GetPrimaryVideoStream()
+	return stream.ColorSpace == "bt2020nc" && (stream.ColorTransfer == "arib-std-b67" || stream.ColorTransfer == "smpte2084")
+}
+
+// DolbyVisionProfile returns the Dolby Vision profile of the video stream e.g. 5, 7 or 8, 0 if it has none.
+func (pd *ProbeData) DolbyVisionProfile() int {
+	for _, sd := range pd.GetPrimaryVideoStream().SideDataList {
+		if sd.SideDataType == sideDataDolbyVision {
+			return sd.DvProfile
+		}
+	}
+	return 0
+}
+
+// HasDolbyVision reports whether the video stream carries Dolby Vision metadata.
+func (pd *ProbeData) HasDolbyVision() bool {
+	return slices.ContainsFunc(pd.GetPrimaryVideoStream().SideDataList, func(sd SideData) bool {
+		return sd.SideDataType == sideDataDolbyVision
+	})
+}
+
+// HasHDR10Plus reports whether the first video frame carries HDR10+ dynamic metadata. Only HDR files have their
+// frames probed, see GetFfprobeInfo.
+func (pd *ProbeData) HasHDR10Plus() bool {
+	for _, frame := range pd.Frames {
+		if slices.ContainsFunc(frame.SideDataList, func(sd SideData) bool { return sd.SideDataType == sideDataHDR10Plus }) {
+			return true
 		}
 	}
 	return false
@@ -103,13 +414,91 @@ func (pd *ProbeData) HasSurroundAudio() bool {
 	return false
 }
 
+// HasRealVideo reports whether there is a video stream that isn't just an attached picture such as cover art.
+func (pd *ProbeData) HasRealVideo() bool {
+	for _, stream := range pd.Streams {
+		if stream.IsVideo() && !stream.IsAttachedPic() {
+			return true
+		}
+	}
+	return false
+}
+
+// GetVideoStream returns the main video stream, the first one that isn't an attached picture e.g. cover art, which
+// is often stream 0. If every video stream is an attached picture the first is returned.
 func (pd *ProbeData) GetVideoStream() StreamData {
+	idx := pd.VideoStreamIndex()
+	if idx < 0 {
+		return StreamData{}
+	}
+	return pd.videoStreams()[idx]
+}
+
+// VideoStreamIndex returns the index of GetVideoStream among the video streams, the N in 0:v:N, or -1 if there is
+// no video stream.
+func (pd *ProbeData) VideoStreamIndex() int {
+	videos := pd.videoStreams()
+	for idx, stream := range videos {
+		if !stream.IsAttachedPic() {
+			return idx
+		}
+	}
+	if len(videos) > 0 {
+		return 0
+	}
+	return -1
+}
+
+// GetPrimaryVideoStream returns the video stream with the most pixels, ignoring attached pictures e.g. cover art,
+// the first of equally large ones. Unlike GetVideoStream it picks the main angle of multi-angle rips whose smaller
+// streams come first. If every video stream is an attached picture the first is returned.
+func (pd *ProbeData) GetPrimaryVideoStream() StreamData {
+	idx := pd.PrimaryVideoStreamIndex()
+	if idx < 0 {
+		return StreamData{}
+	}
+	return pd.videoStreams()[idx]
+}
+
+// PrimaryVideoStreamIndex returns the index of GetPrimaryVideoStream among the video streams, the N in 0:v:N, or -1
+// if there is no video stream.
+func (pd *ProbeData) PrimaryVideoStreamIndex() int {
+	primary := pd.VideoStreamIndex()
+	videos := pd.videoStreams()
+	for idx, stream := range videos {
+		if !stream.IsAttachedPic() && stream.Width*stream.Height > videos[primary].Width*videos[primary].Height {
+			primary = idx
+		}
+	}
+	return primary
+}
+
+// CoverArtIndices returns the indices among the video streams, the N in 0:v:N, of the attached pictures other than
+// GetPrimaryVideoStream e.g. cover art.
+func (pd *ProbeData) CoverArtIndices() []int {
+	main := pd.PrimaryVideoStreamIndex()
+	var indices []int
+	for idx, stream := range pd.videoStreams() {
+		if stream.IsAttachedPic() && idx != main {
+			indices = append(indices, idx)
+		}
+	}
+	return indices
+}
+
+func (pd *ProbeData) videoStreams() []StreamData {
+	var videos []StreamData
 	for _, stream := range pd.Streams {
 		if stream.CodecType == "video" {
-			return stream
+			videos = append(videos, stream)
 		}
 	}
-	return StreamData{}
+	return videos
+}
+
+// VideoCodec returns the codec name of the video stream e.g. h264 or av1, empty if there is none.
+func (pd *ProbeData) VideoCodec() string {
+	return pd.GetPrimaryVideoStream().CodecName
 }
 
 func (pd *ProbeData) HasSubtitles() bool {
@@ -121,15 +510,76 @@ func (pd *ProbeData) HasSubtitles() bool {
 	return false
 }
 
+// GetBitrateBPS returns the container bitrate. Many Matroska files don't record one, it is then estimated from the
+// file size and duration. It returns 0 if neither works.
 func (pd *ProbeData) GetBitrateBPS() int {
 	bitrate, err := strconv.Atoi(pd.Format.BitRate)
-	if err != nil {
-		zap.S().Warnf("failed to parse bitrate: %v", err)
+	if err == nil && bitrate > 0 {
+		zap.S().Debugf("Item %q bitrate %d bps from the container", pd.videoFileName, bitrate)
+		return bitrate
+	}
+
+	duration := pd.GetDurationSeconds()
+	info, statErr := os.Stat(pd.videoFileName)
+	if duration <= 0 || statErr != nil {
+		zap.S().Warnf("Item %q bitrate unknown, the container has none (%q) and it can't be estimated from the size and duration (%.1fs): %v", pd.videoFileName, pd.Format.BitRate, duration, statErr)
 		return 0
 	}
+	bitrate = int(float64(info.Size()) * 8 / duration)
+	zap.S().Debugf("Item %q bitrate %d bps estimated from the file size and duration", pd.videoFileName, bitrate)
 	return bitrate
 }
 
+// GetBitsPerPixel returns the bits spent per pixel per frame, bitrate / (width * height * fps), a measure of how
+// efficiently a file is already encoded that is comparable across resolutions and frame rates. The container
+// bitrate is used so audio is included. It returns 0 if the bitrate, resolution or frame rate is unknown.
+func (pd *ProbeData) GetBitsPerPixel() float64 {
+	videoStream := pd.GetPrimaryVideoStream()
+	pixelsPerSecond := float64(videoStream.Width*videoStream.Height) * videoStream.FrameRate()
+	if pixelsPerSecond <= 0 {
+		return 0
+	}
+	return float64(pd.GetBitrateBPS()) / pixelsPerSecond
+}
+
+// GetDurationSeconds returns the container duration in seconds. Some files only report a duration at the stream
+// level, for those the video stream's duration is used instead. It returns 0 if neither is known.
+func (pd *ProbeData) GetDurationSeconds() float64 {
+	if duration, err := strconv.ParseFloat(pd.Format.Duration, 64); err == nil {
+		return duration
+	}
+	videoStream := pd.GetPrimaryVideoStream()
+	if duration, err := strconv.ParseFloat(videoStream.Duration, 64); err == nil {
+		return duration
+	}
+	if duration, err := parseDurationTag(videoStream.Tags.Duration); err == nil {
+		return duration
+	}
+	zap.S().Warnf("failed to parse duration, format duration %q, video stream duration %q", pd.Format.Duration, videoStream.Duration)
+	return 0
+}
+
+// parseDurationTag parses a Matroska style HH:MM:SS.nnnnnnnnn duration tag into seconds.
+func parseDurationTag(tag string) (float64, error) {
+	parts := strings.Split(tag, ":")
+	if len(parts) != 3 {
+		return 0, fmt.Errorf("invalid duration tag %q", tag)
+	}
+	hours, err := strconv.Atoi(parts[0])
+	if err != nil {
+		return 0, fmt.Errorf("invalid duration tag %q: %w", tag, err)
+	}
+	minutes, err := strconv.Atoi(parts[1])
+	if err != nil {
+		return 0, fmt.Errorf("invalid duration tag %q: %w", tag, err)
+	}
+	seconds, err := strconv.ParseFloat(parts[2], 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid duration tag %q: %w", tag, err)
+	}
+	return float64(hours*3600+minutes*60) + seconds, nil
+}
+
 func (pd *ProbeData) MapStreamIdx(codecType string, rawStreamIdx int) int {
 	idx := 0
 	for i := 0; i < len(pd.Streams) && i < rawStreamIdx; i++ {
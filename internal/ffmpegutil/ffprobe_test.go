@@ -0,0 +1,378 @@
+package ffmpegutil
+
+import (
+	"encoding/json"
+	"errors"
+	"math"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+)
+
+func mustParseProbe(t *testing.T, data string) ProbeData {
+	t.Helper()
+	var pd ProbeData
+	if err := json.Unmarshal([]byte(data), &pd); err != nil {
+		t.Fatalf("failed to parse probe fixture: %v", err)
+	}
+	return pd
+}
+
+func TestHasRealVideoIgnoresCoverArt(t *testing.T) {
+	audioWithCoverArt := mustParseProbe(t, `{
+		"format": {"bit_rate": "256000", "duration": "215.3"},
+		"streams": [
+			{"index": 0, "codec_type": "audio", "codec_name": "aac", "channels": 2},
+			{"index": 1, "codec_type": "video", "codec_name": "mjpeg", "width": 600, "height": 600, "disposition": {"attached_pic": 1}}
+		]
+	}`)
+	if audioWithCoverArt.HasRealVideo() {
+		t.Errorf("HasRealVideo() = true for audio with cover art, want false")
+	}
+
+	movieWithCoverArt := mustParseProbe(t, `{
+		"streams": [
+			{"index": 0, "codec_type": "video", "codec_name": "png", "disposition": {"attached_pic": 1}},
+			{"index": 1, "codec_type": "video", "codec_name": "h264", "width": 1920, "height": 1080, "disposition": {"attached_pic": 0}}
+		]
+	}`)
+	if !movieWithCoverArt.HasRealVideo() {
+		t.Errorf("HasRealVideo() = false for a movie with cover art, want true")
+	}
+	if got := movieWithCoverArt.GetVideoStream().CodecName; got != "h264" {
+		t.Errorf("GetVideoStream() of a movie with cover art first = %s, want the h264 stream", got)
+	}
+	if got := movieWithCoverArt.VideoStreamIndex(); got != 1 {
+		t.Errorf("VideoStreamIndex() = %d, want 1", got)
+	}
+	if got := movieWithCoverArt.CoverArtIndices(); len(got) != 1 || got[0] != 0 {
+		t.Errorf("CoverArtIndices() = %v, want [0]", got)
+	}
+
+	if got := audioWithCoverArt.GetVideoStream().CodecName; got != "mjpeg" {
+		t.Errorf("GetVideoStream() of only cover art = %s, want the cover art", got)
+	}
+	if got := audioWithCoverArt.CoverArtIndices(); len(got) != 0 {
+		t.Errorf("CoverArtIndices() of only cover art = %v, want none besides the video stream", got)
+	}
+}
+
+func TestGetBitsPerPixel(t *testing.T) {
+	tests := []struct {
+		name  string
+		probe string
+		want  float64
+	}{
+		{
+			name:  "1080p24 at 8 Mbps",
+			probe: `{"format": {"bit_rate": "8000000"}, "streams": [{"codec_type": "video", "width": 1920, "height": 1080, "avg_frame_rate": "24000/1001"}]}`,
+			want:  8000000 / (1920 * 1080 * (24000.0 / 1001)),
+		},
+		{
+			name:  "2160p24 at 8 Mbps is four times as efficient",
+			probe: `{"format": {"bit_rate": "8000000"}, "streams": [{"codec_type": "video", "width": 3840, "height": 2160, "avg_frame_rate": "24000/1001"}]}`,
+			want:  8000000 / (3840 * 2160 * (24000.0 / 1001)),
+		},
+		{
+			name:  "720p60 falls back to r_frame_rate",
+			probe: `{"format": {"bit_rate": "5000000"}, "streams": [{"codec_type": "video", "width": 1280, "height": 720, "avg_frame_rate": "0/0", "r_frame_rate": "60/1"}]}`,
+			want:  5000000 / (1280 * 720 * 60.0),
+		},
+		{
+			name:  "unknown frame rate",
+			probe: `{"format": {"bit_rate": "5000000"}, "streams": [{"codec_type": "video", "width": 1280, "height": 720}]}`,
+			want:  0,
+		},
+	}
+	for _, tc := range tests {
+		pd := mustParseProbe(t, tc.probe)
+		if got := pd.GetBitsPerPixel(); math.Abs(got-tc.want) > 1e-9 {
+			t.Errorf("%s: GetBitsPerPixel() = %v, want %v", tc.name, got, tc.want)
+		}
+	}
+}
+
+func TestGetDurationSeconds(t *testing.T) {
+	tests := []struct {
+		name  string
+		probe string
+		want  float64
+	}{
+		{
+			name:  "format duration",
+			probe: `{"format": {"duration": "5400.250000"}, "streams": [{"codec_type": "video", "duration": "10.0"}]}`,
+			want:  5400.25,
+		},
+		{
+			name:  "falls back to the video stream's duration",
+			probe: `{"format": {}, "streams": [{"codec_type": "audio", "duration": "99.0"}, {"codec_type": "video", "duration": "42.5"}]}`,
+			want:  42.5,
+		},
+		{
+			name:  "falls back to the video stream's DURATION tag",
+			probe: `{"format": {}, "streams": [{"codec_type": "video", "tags": {"DURATION": "01:02:03.500000000"}}]}`,
+			want:  3723.5,
+		},
+		{
+			name:  "unknown",
+			probe: `{"format": {}, "streams": [{"codec_type": "video"}]}`,
+			want:  0,
+		},
+	}
+	for _, tc := range tests {
+		pd := mustParseProbe(t, tc.probe)
+		if got := pd.GetDurationSeconds(); math.Abs(got-tc.want) > 1e-9 {
+			t.Errorf("%s: GetDurationSeconds() = %v, want %v", tc.name, got, tc.want)
+		}
+	}
+}
+
+func TestParseFfprobeOutput(t *testing.T) {
+	// trimmed output of ffprobe -show_format -show_streams -show_chapters for a movie with two audio tracks,
+	// subtitles and chapters
+	const fixture = `{
+		"streams": [
+			{"index": 0, "codec_name": "h264", "codec_type": "video", "width": 1920, "height": 1080, "avg_frame_rate": "24000/1001", "color_transfer": "bt709", "tags": {"language": "eng", "DURATION": "01:30:00.000000000"}},
+			{"index": 1, "codec_name": "ac3", "codec_type": "audio", "channels": 6, "tags": {"language": "eng"}},
+			{"index": 2, "codec_name": "aac", "codec_type": "audio", "channels": 2, "tags": {"language": "fre"}},
+			{"index": 3, "codec_name": "subrip", "codec_type": "subtitle", "tags": {"language": "eng"}}
+		],
+		"chapters": [
+			{"id": 1, "time_base": "1/1000000000", "start": 0, "start_time": "0.000000", "end": 2700000000000, "end_time": "2700.000000", "tags": {"title": "Chapter 01"}},
+			{"id": 2, "time_base": "1/1000000000", "start": 2700000000000, "start_time": "2700.000000", "end": 5400000000000, "end_time": "5400.000000", "tags": {"title": "Chapter 02"}}
+		],
+		"format": {"filename": "movie.mkv", "nb_streams": 4, "format_name": "matroska,webm", "duration": "5400.000000", "bit_rate": "12000000", "tags": {"creation_time": "2020-01-01T00:00:00.000000Z"}}
+	}`
+	pd, err := parseFfprobeOutput([]byte(fixture), "movie.mkv")
+	if err != nil {
+		t.Fatalf("parseFfprobeOutput() error: %v", err)
+	}
+
+	if len(pd.Streams) != 4 {
+		t.Fatalf("parsed %d streams, want 4", len(pd.Streams))
+	}
+	video := pd.GetVideoStream()
+	if video.CodecName != "h264" || video.Width != 1920 || video.Height != 1080 {
+		t.Errorf("GetVideoStream() = %+v, want 1920x1080 h264", video)
+	}
+	if pd.VideoCodec() != "h264" {
+		t.Errorf("VideoCodec() = %q, want h264", pd.VideoCodec())
+	}
+	if pd.GetBitrateBPS() != 12000000 || pd.GetDurationSeconds() != 5400 {
+		t.Errorf("bitrate %d duration %v, want 12000000 and 5400", pd.GetBitrateBPS(), pd.GetDurationSeconds())
+	}
+	if pd.Format.Tags.CreationTime != "2020-01-01T00:00:00.000000Z" {
+		t.Errorf("creation time = %q", pd.Format.Tags.CreationTime)
+	}
+	if !pd.HasSurroundAudio() || !pd.HasSubtitles() || pd.HasHDR() {
+		t.Errorf("HasSurroundAudio() = %v, HasSubtitles() = %v, HasHDR() = %v, want true, true, false", pd.HasSurroundAudio(), pd.HasSubtitles(), pd.HasHDR())
+	}
+	if !pd.HasChapters() || pd.Chapters[1].Tags.Title != "Chapter 02" || pd.Chapters[1].StartTime != "2700.000000" {
+		t.Errorf("chapters = %+v, want two", pd.Chapters)
+	}
+	if got := pd.MapStreamIdx("audio", 2); got != 1 {
+		t.Errorf("MapStreamIdx(audio, 2) = %d, want 1", got)
+	}
+	if pd.Streams[2].Tags.Language != "fre" || pd.Streams[1].Channels != 6 {
+		t.Errorf("audio streams = %+v, %+v", pd.Streams[1], pd.Streams[2])
+	}
+
+	if _, err := parseFfprobeOutput([]byte("not json"), "movie.mkv"); err == nil {
+		t.Errorf("parseFfprobeOutput() of invalid output succeeded, want an error")
+	}
+}
+
+func TestDynamicHDRMetadata(t *testing.T) {
+	tests := []struct {
+		name        string
+		fixture     string
+		wantProfile int
+		wantDV      bool
+		wantHDR10P  bool
+	}{
+		{
+			name:    "hdr10",
+			fixture: `{"streams": [{"codec_type": "video", "color_space": "bt2020nc", "color_transfer": "smpte2084"}], "frames": [{"side_data_list": [{"side_data_type": "Mastering display metadata"}]}]}`,
+		},
+		{
+			name:        "dolby vision profile 8",
+			fixture:     `{"streams": [{"codec_type": "video", "color_space": "bt2020nc", "color_transfer": "smpte2084", "side_data_list": [{"side_data_type": "DOVI configuration record", "dv_profile": 8, "dv_bl_signal_compatibility_id": 1}]}]}`,
+			wantProfile: 8,
+			wantDV:      true,
+		},
+		{
+			name:       "hdr10+",
+			fixture:    `{"streams": [{"codec_type": "video", "color_space": "bt2020nc", "color_transfer": "smpte2084"}], "frames": [{"side_data_list": [{"side_data_type": "HDR Dynamic Metadata SMPTE2094-40 (HDR10+)"}]}]}`,
+			wantHDR10P: true,
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			pd, err := parseFfprobeOutput([]byte(tc.fixture), "movie.mkv")
+			if err != nil {
+				t.Fatalf("parseFfprobeOutput() error: %v", err)
+			}
+			if !pd.HasHDR() {
+				t.Errorf("HasHDR() = false, want true")
+			}
+			if pd.DolbyVisionProfile() != tc.wantProfile || pd.HasDolbyVision() != tc.wantDV || pd.HasHDR10Plus() != tc.wantHDR10P {
+				t.Errorf("DolbyVisionProfile() %d HasDolbyVision() %v HasHDR10Plus() %v, want %d %v %v", pd.DolbyVisionProfile(), pd.HasDolbyVision(), pd.HasHDR10Plus(), tc.wantProfile, tc.wantDV, tc.wantHDR10P)
+			}
+		})
+	}
+}
+
+func TestGetBitrateBPSEstimatedFromSize(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "movie.mkv")
+	if err := os.WriteFile(path, make([]byte, 1_000_000), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	pd, err := parseFfprobeOutput([]byte(`{"format": {"duration": "10.0"}, "streams": [{"codec_type": "video"}]}`), path)
+	if err != nil {
+		t.Fatalf("parseFfprobeOutput() error: %v", err)
+	}
+	if got, want := pd.GetBitrateBPS(), 800_000; got != want {
+		t.Errorf("GetBitrateBPS() without a container bitrate = %d, want %d", got, want)
+	}
+
+	pd.Format.BitRate = "12000000"
+	if got := pd.GetBitrateBPS(); got != 12000000 {
+		t.Errorf("GetBitrateBPS() = %d, want the container bitrate 12000000", got)
+	}
+
+	pd, _ = parseFfprobeOutput([]byte(`{"format": {}, "streams": [{"codec_type": "video"}]}`), path)
+	if got := pd.GetBitrateBPS(); got != 0 {
+		t.Errorf("GetBitrateBPS() without a duration = %d, want 0", got)
+	}
+}
+
+func TestDisplayDimensions(t *testing.T) {
+	for _, tc := range []struct {
+		name                  string
+		stream                StreamData
+		wantWidth, wantHeight int
+	}{
+		{"NTSC DVD 16:9", StreamData{Width: 720, Height: 480, SampleAspectRatio: "32:27", DisplayAspectRatio: "16:9"}, 853, 480},
+		{"NTSC DVD 4:3", StreamData{Width: 720, Height: 480, SampleAspectRatio: "8:9", DisplayAspectRatio: "4:3"}, 640, 480},
+		{"PAL DVD 16:9", StreamData{Width: 720, Height: 576, SampleAspectRatio: "64:45", DisplayAspectRatio: "16:9"}, 1024, 576},
+		{"display aspect only", StreamData{Width: 720, Height: 480, SampleAspectRatio: "0:1", DisplayAspectRatio: "16:9"}, 853, 480},
+		{"square pixels", StreamData{Width: 1920, Height: 1080, SampleAspectRatio: "1:1", DisplayAspectRatio: "16:9"}, 1920, 1080},
+		{"unknown", StreamData{Width: 1920, Height: 1080}, 1920, 1080},
+	} {
+		width, height := tc.stream.DisplayDimensions()
+		if width != tc.wantWidth || height != tc.wantHeight {
+			t.Errorf("DisplayDimensions(%s) = %dx%d, want %dx%d", tc.name, width, height, tc.wantWidth, tc.wantHeight)
+		}
+	}
+}
+
+func TestFrameRate(t *testing.T) {
+	for rate, want := range map[string]float64{
+		"24000/1001": 24000.0 / 1001,
+		"30/1":       30,
+		"25":         25,
+		"0/0":        0,
+		"N/A":        0,
+		"":           0,
+		"30/x":       0,
+		"-30/1":      0,
+		"inf/1":      0,
+		"nan":        0,
+	} {
+		if got := parseFrameRate(rate); got != want {
+			t.Errorf("parseFrameRate(%q) = %v, want %v", rate, got, want)
+		}
+	}
+
+	stream := StreamData{AvgFrameRate: "0/0", RFrameRate: "60000/1001"}
+	if got := stream.FrameRate(); got != 60000.0/1001 {
+		t.Errorf("FrameRate() with an unknown average = %v, want the base rate", got)
+	}
+}
+
+func TestBitDepth(t *testing.T) {
+	for _, tc := range []struct {
+		pixFmt, bits string
+		want         int
+	}{
+		{pixFmt: "yuv420p", want: 8},
+		{pixFmt: "yuv420p10le", want: 10},
+		{pixFmt: "yuv422p12be", want: 12},
+		{pixFmt: "p010le", want: 10},
+		{pixFmt: "nv12", want: 8},
+		{pixFmt: "gray10le", want: 10},
+		{pixFmt: "yuv420p", bits: "10", want: 10},
+		{pixFmt: "yuv420p10le", bits: "N/A", want: 10},
+		{pixFmt: "unknown", want: 0},
+		{want: 0},
+	} {
+		sd := StreamData{PixFmt: tc.pixFmt, BitsPerRawSample: tc.bits}
+		if got := sd.BitDepth(); got != tc.want {
+			t.Errorf("BitDepth() of pix_fmt %q bits_per_raw_sample %q = %d, want %d", tc.pixFmt, tc.bits, got, tc.want)
+		}
+	}
+}
+
+func TestGetPrimaryVideoStream(t *testing.T) {
+	multiAngle := mustParseProbe(t, `{
+		"streams": [
+			{"index": 0, "codec_type": "video", "codec_name": "h264", "width": 720, "height": 480},
+			{"index": 1, "codec_type": "video", "codec_name": "mjpeg", "width": 3000, "height": 3000, "disposition": {"attached_pic": 1}},
+			{"index": 2, "codec_type": "video", "codec_name": "hevc", "width": 3840, "height": 2160, "color_space": "bt2020nc", "color_transfer": "smpte2084"},
+			{"index": 3, "codec_type": "video", "codec_name": "hevc", "width": 3840, "height": 2160},
+			{"index": 4, "codec_type": "audio", "codec_name": "aac", "channels": 2}
+		]
+	}`)
+	if got := multiAngle.GetPrimaryVideoStream(); got.CodecName != "hevc" || got.Width != 3840 {
+		t.Errorf("GetPrimaryVideoStream() = %s %dx%d, want the 3840x2160 hevc stream", got.CodecName, got.Width, got.Height)
+	}
+	if got := multiAngle.PrimaryVideoStreamIndex(); got != 2 {
+		t.Errorf("PrimaryVideoStreamIndex() = %d, want the first of the equally large streams, 2", got)
+	}
+	if got := multiAngle.GetVideoStream().CodecName; got != "h264" {
+		t.Errorf("GetVideoStream() = %s, want the first stream that isn't cover art", got)
+	}
+	if !multiAngle.HasHDR() {
+		t.Errorf("HasHDR() = false, want the primary stream's HDR")
+	}
+	if got := multiAngle.VideoCodec(); got != "hevc" {
+		t.Errorf("VideoCodec() = %s, want the primary stream's hevc", got)
+	}
+	if got := multiAngle.CoverArtIndices(); len(got) != 1 || got[0] != 1 {
+		t.Errorf("CoverArtIndices() = %v, want [1]", got)
+	}
+
+	sdOnlyHDRExtra := mustParseProbe(t, `{
+		"streams": [
+			{"index": 0, "codec_type": "video", "codec_name": "h264", "width": 1920, "height": 1080},
+			{"index": 1, "codec_type": "video", "codec_name": "hevc", "width": 640, "height": 360, "color_space": "bt2020nc", "color_transfer": "smpte2084"}
+		]
+	}`)
+	if sdOnlyHDRExtra.HasHDR() {
+		t.Errorf("HasHDR() = true for an SDR primary stream with a small HDR extra stream, want false")
+	}
+}
+
+func TestProbeErrorRejected(t *testing.T) {
+	exitErr := exec.Command("false").Run()
+	if exitErr == nil {
+		t.Fatal("false exited successfully")
+	}
+	path := filepath.Join(t.TempDir(), "junk.mkv")
+	if err := os.WriteFile(path, []byte("not a video"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := probeError(path, exitErr); !errors.Is(err, ErrProbeRejected) {
+		t.Errorf("probeError() of a readable file = %v, want ErrProbeRejected", err)
+	}
+	// ffprobe missing, or the file gone or unreadable, isn't the file's fault
+	if err := probeError(path, exec.ErrNotFound); errors.Is(err, ErrProbeRejected) {
+		t.Errorf("probeError() of a missing ffprobe = %v, want not rejected", err)
+	}
+	if err := probeError(filepath.Join(t.TempDir(), "gone.mkv"), exitErr); errors.Is(err, ErrProbeRejected) {
+		t.Errorf("probeError() of a missing file = %v, want not rejected", err)
+	}
+}
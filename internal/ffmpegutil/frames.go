@@ -0,0 +1,56 @@
+package ffmpegutil
+
+import (
+	"fmt"
+	"math"
+	"os/exec"
+	"strconv"
+	"strings"
+)
+
+// ExpectedVideoFrames returns the number of frames in the video stream. The count recorded by the container is
+// used if there is one, exact reports whether that was the case, otherwise it is estimated from the duration and
+// frame rate. It returns 0 if neither is known.
+func (pd *ProbeData) ExpectedVideoFrames() (frames int, exact bool) {
+	videoStream := pd.GetPrimaryVideoStream()
+	for _, count := range []string{videoStream.NbFrames, videoStream.Tags.NumberOfFrames} {
+		if n, err := strconv.Atoi(count); err == nil && n > 0 {
+			return n, true
+		}
+	}
+	return int(math.Round(pd.GetDurationSeconds() * videoStream.FrameRate())), false
+}
+
+// CountVideoFrames counts the packets of the first video stream, one per frame. This demuxes the whole file but
+// doesn't decode it so it is much cheaper than a decode check. Unlike the duration in the header it can't be fooled
+// by a truncated file.
+func CountVideoFrames(videoFileName string) (int, error) {
+	cmd := exec.Command("ffprobe", "-v", "error", "-select_streams", "v:0", "-count_packets",
+		"-show_entries", "stream=nb_read_packets", "-of", "csv=p=0", videoFileName)
+	output, err := cmd.Output()
+	if err != nil {
+		return 0, fmt.Errorf("ffprobe failed: %w", err)
+	}
+	count, err := strconv.Atoi(strings.TrimSpace(strings.Split(string(output), "\n")[0]))
+	if err != nil {
+		return 0, fmt.Errorf("failed to parse frame count %q: %w", output, err)
+	}
+	return count, nil
+}
+
+// CheckFrameCount returns an error if an output's frame count is short of or exceeds the expected count by more
+// than a couple of frames, or 1% if the expected count is only an estimate.
+func CheckFrameCount(expected, actual int, exact bool) error {
+	if expected <= 0 {
+		return nil
+	}
+	relative := 0.001
+	if !exact {
+		relative = 0.01
+	}
+	tolerance := max(2, int(float64(expected)*relative))
+	if diff := actual - expected; diff > tolerance || -diff > tolerance {
+		return fmt.Errorf("output has %d frames but the source has %d", actual, expected)
+	}
+	return nil
+}
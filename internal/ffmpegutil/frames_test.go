@@ -0,0 +1,56 @@
+package ffmpegutil
+
+import "testing"
+
+func TestExpectedVideoFrames(t *testing.T) {
+	tests := []struct {
+		name      string
+		probe     string
+		want      int
+		wantExact bool
+	}{
+		{
+			name:      "nb_frames",
+			probe:     `{"streams": [{"codec_type": "video", "nb_frames": "172656"}]}`,
+			want:      172656,
+			wantExact: true,
+		},
+		{
+			name:      "mkvmerge statistics tag",
+			probe:     `{"streams": [{"codec_type": "video", "tags": {"NUMBER_OF_FRAMES": "34046"}}]}`,
+			want:      34046,
+			wantExact: true,
+		},
+		{
+			name:  "estimated from duration",
+			probe: `{"format": {"duration": "100.1"}, "streams": [{"codec_type": "video", "avg_frame_rate": "24000/1001"}]}`,
+			want:  2400,
+		},
+	}
+	for _, tc := range tests {
+		pd := mustParseProbe(t, tc.probe)
+		if got, exact := pd.ExpectedVideoFrames(); got != tc.want || exact != tc.wantExact {
+			t.Errorf("%s: ExpectedVideoFrames() = %d, %v, want %d, %v", tc.name, got, exact, tc.want, tc.wantExact)
+		}
+	}
+}
+
+func TestCheckFrameCount(t *testing.T) {
+	tests := []struct {
+		expected, actual int
+		exact            bool
+		wantErr          bool
+	}{
+		{expected: 172656, actual: 172656, exact: true},
+		{expected: 172656, actual: 172600, exact: true},
+		{expected: 172656, actual: 170000, exact: true, wantErr: true},
+		{expected: 172656, actual: 171500, exact: false},
+		{expected: 172656, actual: 86328, exact: false, wantErr: true},
+		{expected: 0, actual: 100},
+	}
+	for _, tc := range tests {
+		if err := CheckFrameCount(tc.expected, tc.actual, tc.exact); (err != nil) != tc.wantErr {
+			t.Errorf("CheckFrameCount(%d, %d, %v) error = %v, wantErr %v", tc.expected, tc.actual, tc.exact, err, tc.wantErr)
+		}
+	}
+}
@@ -0,0 +1,80 @@
+package ffmpegutil
+
+import (
+	"bytes"
+	"fmt"
+	"os/exec"
+	"regexp"
+	"strconv"
+)
+
+// Quality metrics supported by MeasureQuality.
+const (
+	MetricVMAF = "vmaf"
+	MetricSSIM = "ssim"
+)
+
+var (
+	vmafScoreRe = regexp.MustCompile(`VMAF score[:=]\s*([0-9.]+)`)
+	ssimScoreRe = regexp.MustCompile(`SSIM .*All:([0-9.]+)`)
+)
+
+// QualityReference is the part of a source that an encode is scored against.
+type QualityReference struct {
+	File     string
+	VideoIdx int     // the N in 0:v:N
+	Crop     Crop    // applied to the reference so that it matches an encode cropped alike, the zero Crop for none
+	Seconds  float64 // only the start of the reference that an encode cut short covers, 0 for all of it
+}
+
+// MeasureQuality scores the video of distorted against reference using ffmpeg's libvmaf or ssim filter. Only every
+// sampleEvery'th frame of each input is compared to keep the cost down, a value <= 1 compares every frame. Both
+// inputs must have the same resolution after cropping and the same length after limiting the reference.
+func MeasureQuality(metric, distorted string, reference QualityReference, sampleEvery int) (float64, error) {
+	var compare string
+	switch metric {
+	case MetricVMAF:
+		compare = "libvmaf"
+	case MetricSSIM:
+		compare = "ssim"
+	default:
+		return 0, fmt.Errorf("unknown quality metric %q", metric)
+	}
+
+	sample := "null"
+	if sampleEvery > 1 {
+		sample = fmt.Sprintf("select='not(mod(n\\,%d))',setpts=N/TB", sampleEvery)
+	}
+	refFilters := sample
+	if reference.Crop != (Crop{}) {
+		refFilters = reference.Crop.Filter() + "," + sample
+	}
+	// V rather than v skips attached pictures e.g. cover art copied after the distorted video
+	filter := fmt.Sprintf("[0:V:0]%s[dist];[1:v:%d]%s[ref];[dist][ref]%s", sample, reference.VideoIdx, refFilters, compare)
+
+	args := []string{"-n", "19", "ffmpeg", "-hide_banner", "-nostats", "-i", distorted}
+	if reference.Seconds > 0 {
+		args = append(args, "-t", strconv.FormatFloat(reference.Seconds, 'f', -1, 64))
+	}
+	args = append(args, "-i", reference.File, "-lavfi", filter, "-f", "null", "-")
+	cmd := exec.Command("nice", args...)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return 0, fmt.Errorf("%s comparison failed: %w", metric, err)
+	}
+	return parseQualityScore(metric, stderr.String())
+}
+
+// parseQualityScore extracts the overall score from the log output of ffmpeg's libvmaf or ssim filter.
+func parseQualityScore(metric, output string) (float64, error) {
+	re := vmafScoreRe
+	if metric == MetricSSIM {
+		re = ssimScoreRe
+	}
+	matches := re.FindAllStringSubmatch(output, -1)
+	if len(matches) == 0 {
+		return 0, fmt.Errorf("no %s score in ffmpeg output", metric)
+	}
+	return strconv.ParseFloat(matches[len(matches)-1][1], 64)
+}
@@ -0,0 +1,38 @@
+package ffmpegutil
+
+import "testing"
+
+func TestParseQualityScore(t *testing.T) {
+	tests := []struct {
+		metric  string
+		output  string
+		want    float64
+		wantErr bool
+	}{
+		{
+			metric: MetricVMAF,
+			output: "[Parsed_libvmaf_4 @ 0x5581] VMAF score: 94.371204\n",
+			want:   94.371204,
+		},
+		{
+			metric: MetricSSIM,
+			output: "[Parsed_ssim_4 @ 0x55d1] SSIM Y:0.987264 (18.950389) U:0.991802 (20.863393) V:0.992240 (21.101627) All:0.989109 (19.628816)\n",
+			want:   0.989109,
+		},
+		{
+			metric:  MetricVMAF,
+			output:  "Conversion failed!\n",
+			wantErr: true,
+		},
+	}
+	for _, tc := range tests {
+		got, err := parseQualityScore(tc.metric, tc.output)
+		if (err != nil) != tc.wantErr {
+			t.Errorf("parseQualityScore(%q) error = %v, wantErr %v", tc.metric, err, tc.wantErr)
+			continue
+		}
+		if got != tc.want {
+			t.Errorf("parseQualityScore(%q) = %v, want %v", tc.metric, got, tc.want)
+		}
+	}
+}
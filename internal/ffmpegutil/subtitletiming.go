@@ -0,0 +1,44 @@
+package ffmpegutil
+
+import (
+	"fmt"
+	"math"
+	"os/exec"
+	"strconv"
+	"strings"
+)
+
+// SubtitleTimeRange returns the time of the first subtitle event and the end of the last in a subtitle stream,
+// the N in 0:s:N. It reads every packet of the stream but decodes nothing.
+func SubtitleTimeRange(videoFileName string, subIdx int) (first, last float64, err error) {
+	cmd := exec.Command("ffprobe", "-v", "error", "-select_streams", fmt.Sprintf("s:%d", subIdx),
+		"-show_entries", "packet=pts_time,duration_time", "-of", "csv=p=0", videoFileName)
+	output, err := cmd.Output()
+	if err != nil {
+		return 0, 0, fmt.Errorf("ffprobe failed: %w", err)
+	}
+	return parseSubtitlePackets(string(output))
+}
+
+// parseSubtitlePackets parses ffprobe's csv packet listing of pts_time,duration_time lines.
+func parseSubtitlePackets(output string) (first, last float64, err error) {
+	first, last = math.Inf(1), math.Inf(-1)
+	for _, line := range strings.Split(output, "\n") {
+		fields := strings.Split(strings.TrimSpace(line), ",")
+		pts, err := strconv.ParseFloat(fields[0], 64)
+		if err != nil {
+			continue // blank lines and packets without a timestamp
+		}
+		end := pts
+		if len(fields) > 1 {
+			if duration, err := strconv.ParseFloat(fields[1], 64); err == nil {
+				end += duration
+			}
+		}
+		first, last = min(first, pts), max(last, end)
+	}
+	if math.IsInf(first, 1) {
+		return 0, 0, fmt.Errorf("no timed subtitle packets")
+	}
+	return first, last, nil
+}
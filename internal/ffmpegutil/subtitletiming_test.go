@@ -0,0 +1,18 @@
+package ffmpegutil
+
+import "testing"
+
+func TestParseSubtitlePackets(t *testing.T) {
+	output := "12.512000,2.002000\n15.015000,3.100000\nN/A,N/A\n2650.400000,4.000000,\n\n"
+	first, last, err := parseSubtitlePackets(output)
+	if err != nil {
+		t.Fatalf("parseSubtitlePackets() error: %v", err)
+	}
+	if first != 12.512 || last != 2654.4 {
+		t.Errorf("parseSubtitlePackets() = %v, %v, want 12.512, 2654.4", first, last)
+	}
+
+	if _, _, err := parseSubtitlePackets("N/A,N/A\n"); err == nil {
+		t.Errorf("parseSubtitlePackets() without timestamps expected an error")
+	}
+}
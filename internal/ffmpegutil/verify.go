@@ -0,0 +1,65 @@
+package ffmpegutil
+
+import (
+	"fmt"
+	"math"
+)
+
+// VerifyOutput checks that an encode's probe looks like a complete copy of its source's: it must have a real video
+// stream, keep audio if the source had any and have a duration matching the source's. crop is the crop applied to the
+// source's video when it was encoded, the zero Crop if none.
+func VerifyOutput(source, output ProbeData, crop Crop) error {
+	if !output.HasRealVideo() {
+		return fmt.Errorf("output has no video stream")
+	}
+	if countStreams(source, (*StreamData).IsAudio) > 0 && countStreams(output, (*StreamData).IsAudio) == 0 {
+		return fmt.Errorf("output has no audio stream but the source does")
+	}
+	sourceVideo := source.GetPrimaryVideoStream()
+	if err := checkAspectPreserved(sourceVideo.Cropped(crop), output.GetPrimaryVideoStream()); err != nil {
+		return err
+	}
+	return CheckDurationsMatch(source.GetDurationSeconds(), output.GetDurationSeconds())
+}
+
+// checkAspectPreserved returns an error if an anamorphic source's output is displayed at a different shape, i.e.
+// its sample aspect ratio was lost and it plays squashed.
+func checkAspectPreserved(source, output StreamData) error {
+	if !source.IsAnamorphic() {
+		return nil
+	}
+	srcWidth, srcHeight := source.DisplayDimensions()
+	outWidth, outHeight := output.DisplayDimensions()
+	if srcHeight <= 0 || outHeight <= 0 {
+		return nil
+	}
+	srcAspect := float64(srcWidth) / float64(srcHeight)
+	outAspect := float64(outWidth) / float64(outHeight)
+	if math.Abs(srcAspect-outAspect) > srcAspect*0.02 {
+		return fmt.Errorf("output display aspect %.3f does not match source display aspect %.3f, the sample aspect ratio %s was lost", outAspect, srcAspect, source.SampleAspectRatio)
+	}
+	return nil
+}
+
+// CheckDurationsMatch returns an error if the output's duration differs from the source's by more than a couple of
+// seconds or 1%, whichever is larger. Unknown durations can't be compared and are accepted.
+func CheckDurationsMatch(sourceSeconds, outputSeconds float64) error {
+	if sourceSeconds <= 0 || outputSeconds <= 0 {
+		return nil
+	}
+	tolerance := max(2, sourceSeconds*0.01)
+	if math.Abs(sourceSeconds-outputSeconds) > tolerance {
+		return fmt.Errorf("output duration %.1fs does not match source duration %.1fs", outputSeconds, sourceSeconds)
+	}
+	return nil
+}
+
+func countStreams(pd ProbeData, match func(*StreamData) bool) int {
+	n := 0
+	for i := range pd.Streams {
+		if match(&pd.Streams[i]) {
+			n++
+		}
+	}
+	return n
+}
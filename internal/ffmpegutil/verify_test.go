@@ -0,0 +1,66 @@
+package ffmpegutil
+
+import "testing"
+
+func TestCheckDurationsMatch(t *testing.T) {
+	tests := []struct {
+		source, output float64
+		wantErr        bool
+	}{
+		{source: 7200, output: 7199.5},
+		{source: 7200, output: 7150},
+		{source: 7200, output: 3600, wantErr: true},
+		{source: 60, output: 57, wantErr: true},
+		{source: 0, output: 3600},
+	}
+	for _, tc := range tests {
+		if err := CheckDurationsMatch(tc.source, tc.output); (err != nil) != tc.wantErr {
+			t.Errorf("CheckDurationsMatch(%v, %v) error = %v, wantErr %v", tc.source, tc.output, err, tc.wantErr)
+		}
+	}
+}
+
+func TestVerifyOutput(t *testing.T) {
+	source := mustParseProbe(t, `{
+		"format": {"duration": "3600.0"},
+		"streams": [{"codec_type": "video", "codec_name": "h264"}, {"codec_type": "audio", "codec_name": "ac3"}]
+	}`)
+
+	tests := []struct {
+		name    string
+		output  string
+		wantErr bool
+	}{
+		{name: "complete", output: `{"format": {"duration": "3600.2"}, "streams": [{"codec_type": "video", "codec_name": "av1"}, {"codec_type": "audio", "codec_name": "opus"}]}`},
+		{name: "truncated", output: `{"format": {"duration": "1800.0"}, "streams": [{"codec_type": "video", "codec_name": "av1"}, {"codec_type": "audio", "codec_name": "opus"}]}`, wantErr: true},
+		{name: "no audio", output: `{"format": {"duration": "3600.0"}, "streams": [{"codec_type": "video", "codec_name": "av1"}]}`, wantErr: true},
+		{name: "no video", output: `{"format": {"duration": "3600.0"}, "streams": [{"codec_type": "audio", "codec_name": "opus"}]}`, wantErr: true},
+	}
+	for _, tc := range tests {
+		if err := VerifyOutput(source, mustParseProbe(t, tc.output), Crop{}); (err != nil) != tc.wantErr {
+			t.Errorf("VerifyOutput(%s) error = %v, wantErr %v", tc.name, err, tc.wantErr)
+		}
+	}
+}
+
+func TestCheckAspectPreserved(t *testing.T) {
+	dvd := StreamData{Width: 720, Height: 480, SampleAspectRatio: "32:27"}
+	if err := checkAspectPreserved(dvd, StreamData{Width: 720, Height: 480, SampleAspectRatio: "32:27"}); err != nil {
+		t.Errorf("checkAspectPreserved() of a kept sample aspect ratio error = %v", err)
+	}
+	if err := checkAspectPreserved(dvd, StreamData{Width: 720, Height: 480, SampleAspectRatio: "1:1"}); err == nil {
+		t.Errorf("checkAspectPreserved() of a lost sample aspect ratio succeeded, want an error")
+	}
+	if err := checkAspectPreserved(StreamData{Width: 1920, Height: 1080}, StreamData{Width: 1920, Height: 1080}); err != nil {
+		t.Errorf("checkAspectPreserved() of square pixels error = %v", err)
+	}
+
+	// a letterboxed DVD cropped to its picture keeps its pixel shape but not its frame's shape
+	cropped := StreamData{Width: 720, Height: 360, SampleAspectRatio: "32:27"}
+	if err := checkAspectPreserved(dvd.Cropped(Crop{Width: 720, Height: 360, Y: 60}), cropped); err != nil {
+		t.Errorf("checkAspectPreserved() of a cropped output against the cropped source error = %v", err)
+	}
+	if err := checkAspectPreserved(dvd, cropped); err == nil {
+		t.Errorf("checkAspectPreserved() of a cropped output against the uncropped source succeeded, want an error")
+	}
+}
@@ -0,0 +1,66 @@
+package ffmpegutil
+
+import (
+	"bytes"
+	"fmt"
+	"os/exec"
+	"regexp"
+	"strings"
+)
+
+var svtAv1VersionRe = regexp.MustCompile(`SVT-AV1 Encoder Lib (v?[0-9][^\s]*)`)
+
+// EncoderVersions identifies the ffmpeg build and SVT-AV1 library used to produce an encode.
+type EncoderVersions struct {
+	FFmpeg string
+	SvtAv1 string
+}
+
+// DetectVersions runs ffmpeg to determine its version and the version of the SVT-AV1 library it links against.
+// cmdPrefix is prepended to the ffmpeg invocation e.g. to run it inside a docker container.
+func DetectVersions(cmdPrefix []string) (EncoderVersions, error) {
+	var versions EncoderVersions
+
+	out, err := runFfmpeg(cmdPrefix, "-version")
+	if err != nil {
+		return versions, fmt.Errorf("ffmpeg -version: %w", err)
+	}
+	versions.FFmpeg = parseFfmpegVersion(out)
+
+	// SVT-AV1 only reports its version when an encoder is created, so encode a handful of blank frames
+	out, err = runFfmpeg(cmdPrefix, "-hide_banner", "-f", "lavfi", "-i", "color=size=64x64:duration=0.1", "-c:v", "libsvtav1", "-f", "null", "-")
+	if err != nil {
+		return versions, fmt.Errorf("libsvtav1 version probe: %w", err)
+	}
+	versions.SvtAv1 = parseSvtAv1Version(out)
+
+	return versions, nil
+}
+
+func runFfmpeg(cmdPrefix []string, args ...string) (string, error) {
+	argv := append(append(append([]string{}, cmdPrefix...), "ffmpeg"), args...)
+	cmd := exec.Command(argv[0], argv[1:]...)
+	var out bytes.Buffer
+	cmd.Stdout = &out
+	cmd.Stderr = &out
+	err := cmd.Run()
+	return out.String(), err
+}
+
+// parseFfmpegVersion extracts the version from the first line of ffmpeg -version e.g. "ffmpeg version 7.1 Copyright ..."
+func parseFfmpegVersion(output string) string {
+	line, _, _ := strings.Cut(output, "\n")
+	fields := strings.Fields(line)
+	if len(fields) >= 3 && fields[0] == "ffmpeg" && fields[1] == "version" {
+		return fields[2]
+	}
+	return ""
+}
+
+func parseSvtAv1Version(output string) string {
+	m := svtAv1VersionRe.FindStringSubmatch(output)
+	if m == nil {
+		return ""
+	}
+	return m[1]
+}
@@ -0,0 +1,18 @@
+package ffmpegutil
+
+import "testing"
+
+func TestParseVersions(t *testing.T) {
+	ffmpegOut := "ffmpeg version 7.1 Copyright (c) 2000-2024 the FFmpeg developers\nbuilt with gcc 13 (Ubuntu 13.2.0-23ubuntu4)\n"
+	if got := parseFfmpegVersion(ffmpegOut); got != "7.1" {
+		t.Errorf("parseFfmpegVersion() = %q, want %q", got, "7.1")
+	}
+	if got := parseFfmpegVersion("bash: ffmpeg: command not found"); got != "" {
+		t.Errorf("parseFfmpegVersion() = %q, want empty", got)
+	}
+
+	svtOut := "Svt[info]: -------------------------------------------\nSvt[info]: SVT [version]:\tSVT-AV1 Encoder Lib v1.7.0\nSvt[info]: SVT [build]  :\tGCC 13.2.0\t 64 bit\n"
+	if got := parseSvtAv1Version(svtOut); got != "v1.7.0" {
+		t.Errorf("parseSvtAv1Version() = %q, want %q", got, "v1.7.0")
+	}
+}
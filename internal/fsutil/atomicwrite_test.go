@@ -0,0 +1,33 @@
+package fsutil
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestWriteFileAtomic(t *testing.T) {
+	dir := t.TempDir()
+	name := filepath.Join(dir, "status.json")
+
+	for _, content := range []string{"first", "second"} {
+		if err := WriteFileAtomic(name, []byte(content), 0644); err != nil {
+			t.Fatalf("WriteFileAtomic() error: %v", err)
+		}
+		if got, err := os.ReadFile(name); err != nil || string(got) != content {
+			t.Errorf("after WriteFileAtomic(%q) file contains %q, %v", content, got, err)
+		}
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 {
+		t.Errorf("directory has %d entries after writing, want only the file: %v", len(entries), entries)
+	}
+
+	if err := WriteFileAtomic(filepath.Join(dir, "missing", "status.json"), []byte("x"), 0644); err == nil {
+		t.Errorf("WriteFileAtomic() into a missing directory succeeded, want an error")
+	}
+}
@@ -0,0 +1,20 @@
+package fsutil
+
+import "testing"
+
+func TestFormatBytes(t *testing.T) {
+	tests := []struct {
+		n    int64
+		want string
+	}{
+		{n: 512, want: "512 B"},
+		{n: 1536, want: "1.5 KiB"},
+		{n: 4509715660, want: "4.2 GiB"},
+		{n: -3 << 20, want: "-3.0 MiB"},
+	}
+	for _, tc := range tests {
+		if got := FormatBytes(tc.n); got != tc.want {
+			t.Errorf("FormatBytes(%d) = %q, want %q", tc.n, got, tc.want)
+		}
+	}
+}
@@ -0,0 +1,50 @@
+package fsutil
+
+import (
+	"fmt"
+	"path"
+	"runtime"
+	"strings"
+
+	"github.com/bmatcuk/doublestar/v4"
+)
+
+// excludeCaseInsensitive makes exclude globs ignore case, as paths do on Windows.
+var excludeCaseInsensitive = runtime.GOOS == "windows"
+
+// ValidateExcludes checks that every exclude glob is well formed.
+func ValidateExcludes(excludes []string) error {
+	for _, glob := range excludes {
+		if !doublestar.ValidatePattern(normalizeExcludePath(glob)) {
+			return fmt.Errorf("invalid exclude glob %q", glob)
+		}
+	}
+	return nil
+}
+
+// Excluded reports whether relPath, relative to the input directory, matches any of the exclude globs. Globs use
+// filepath.Match syntax plus ** to match any number of directories e.g. **/Extras/**. A glob without a / is matched
+// against the last element of the path so that *sample* excludes sample files in any directory.
+func Excluded(excludes []string, relPath string) bool {
+	relPath = normalizeExcludePath(relPath)
+	for _, glob := range excludes {
+		glob = normalizeExcludePath(glob)
+		target := relPath
+		if !strings.Contains(glob, "/") {
+			target = path.Base(relPath)
+		}
+		if match, _ := doublestar.Match(glob, target); match {
+			return true
+		}
+	}
+	return false
+}
+
+// normalizeExcludePath converts Windows style separators to / and folds case where paths are case insensitive.
+func normalizeExcludePath(p string) string {
+	p = strings.ReplaceAll(p, `\`, "/")
+	if excludeCaseInsensitive {
+		p = strings.ToLower(p)
+	}
+	return p
+}
@@ -0,0 +1,68 @@
+package fsutil
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+func TestMediaInDirExcludes(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{
+		"Movie/movie.mkv",
+		"Movie/movie-sample.mkv",
+		"Movie/Extras/featurette.mkv",
+		"Show/Season 1/Extras/Behind/scenes.mkv",
+		"Show/Season 1/e01.mkv",
+	} {
+		path := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, nil, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	excludes := []string{"**/Extras/**", "*sample*"}
+	if err := ValidateExcludes(excludes); err != nil {
+		t.Fatalf("ValidateExcludes() error: %v", err)
+	}
+	matches, err := MediaInDir(dir, excludes...)
+	if err != nil {
+		t.Fatalf("MediaInDir() error: %v", err)
+	}
+	want := []string{
+		filepath.Join(dir, "Movie", "movie.mkv"),
+		filepath.Join(dir, "Show", "Season 1", "e01.mkv"),
+	}
+	if !slices.Equal(matches, want) {
+		t.Errorf("MediaInDir() = %v, want %v", matches, want)
+	}
+}
+
+func TestExcluded(t *testing.T) {
+	tests := []struct {
+		excludes []string
+		path     string
+		want     bool
+	}{
+		{excludes: []string{"*sample*"}, path: "a/b/Movie-sample.mkv", want: true},
+		{excludes: []string{"**/Extras/**"}, path: "Extras/x.mkv", want: true},
+		{excludes: []string{"**/Extras/**"}, path: `Show\Extras\x.mkv`, want: true},
+		{excludes: []string{"Show/*.mkv"}, path: "Show/Season 1/x.mkv", want: false},
+		{excludes: []string{"**/extras/**"}, path: "Show/Extras/x.mkv", want: false},
+	}
+	for _, tc := range tests {
+		if got := Excluded(tc.excludes, tc.path); got != tc.want {
+			t.Errorf("Excluded(%v, %q) = %v, want %v", tc.excludes, tc.path, got, tc.want)
+		}
+	}
+
+	excludeCaseInsensitive = true
+	t.Cleanup(func() { excludeCaseInsensitive = false })
+	if !Excluded([]string{"**/extras/**"}, `Show\Extras\x.mkv`) {
+		t.Errorf("Excluded() with case insensitive matching didn't match a differently cased path")
+	}
+}
@@ -0,0 +1,58 @@
+package fsutil
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/bmatcuk/doublestar/v4"
+	"github.com/garethgeorge/media-toolkit/internal/ffmpegutil"
+)
+
+// MediaForInput lists the media files selected by a command line input argument. A directory is walked as by
+// MediaInDir, anything else is treated as a doublestar glob e.g. /media/**/*S01*.mkv where ** matches any number
+// of directories, * and ? match within a path segment and {a,b} and [abc] alternatives are supported. Matching is
+// done in process so huge matches don't hit shell argument length limits. Files matching any of the exclude globs
+// relative to InputBaseDir are skipped. An input without wildcards that doesn't exist is an error wrapping
+// os.ErrNotExist, rather than a glob matching nothing.
+func MediaForInput(input string, excludes ...string) ([]string, error) {
+	info, err := os.Stat(input)
+	if err == nil && info.IsDir() {
+		return MediaInDir(input, excludes...)
+	}
+	if errors.Is(err, os.ErrNotExist) && !strings.ContainsAny(input, globMeta) {
+		return nil, err
+	}
+	baseDir := InputBaseDir(input)
+	paths, err := doublestar.FilepathGlob(input, doublestar.WithFilesOnly())
+	if err != nil {
+		return nil, err
+	}
+	var matches []string
+	for _, path := range paths {
+		if !slices.Contains(ffmpegutil.VideoFileExts, filepath.Ext(path)) {
+			continue
+		}
+		if rel, err := filepath.Rel(baseDir, path); err == nil && Excluded(excludes, rel) {
+			continue
+		}
+		matches = append(matches, path)
+	}
+	slices.Sort(matches)
+	return matches, nil
+}
+
+// globMeta are the characters that make an input a doublestar glob rather than a literal path.
+const globMeta = `*?[{\`
+
+// InputBaseDir returns the directory an input argument refers to, for a glob this is the directory before the
+// first wildcard.
+func InputBaseDir(input string) string {
+	if info, err := os.Stat(input); err == nil && info.IsDir() {
+		return input
+	}
+	base, _ := doublestar.SplitPattern(filepath.ToSlash(input))
+	return filepath.FromSlash(base)
+}
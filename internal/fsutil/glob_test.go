@@ -0,0 +1,47 @@
+package fsutil
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+func TestMediaForInput(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{"show/s01/show S01E01.mkv", "show/s01/show S01E02.mkv", "show/s02/show S02E01.mkv", "show/s01/notes S01.txt"} {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, nil, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	got, err := MediaForInput(filepath.Join(dir, "**", "*S01*"))
+	if err != nil {
+		t.Fatalf("MediaForInput() error: %v", err)
+	}
+	want := []string{filepath.Join(dir, "show/s01/show S01E01.mkv"), filepath.Join(dir, "show/s01/show S01E02.mkv")}
+	if !slices.Equal(got, want) {
+		t.Errorf("MediaForInput(glob) = %v, want %v", got, want)
+	}
+
+	got, err = MediaForInput(dir)
+	if err != nil || len(got) != 3 {
+		t.Errorf("MediaForInput(dir) = %v, %v, want all 3 videos", got, err)
+	}
+
+	if _, err := MediaForInput(filepath.Join(dir, "show", "missing.mkv")); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("MediaForInput() of a missing file error = %v, want os.ErrNotExist", err)
+	}
+	if got, err := MediaForInput(filepath.Join(dir, "missing", "*.mkv")); err != nil || len(got) != 0 {
+		t.Errorf("MediaForInput() of a glob matching nothing = %v, %v, want no matches and no error", got, err)
+	}
+
+	if base := InputBaseDir(filepath.Join(dir, "show", "**", "*.mkv")); base != filepath.Join(dir, "show") {
+		t.Errorf("InputBaseDir() = %q, want %q", base, filepath.Join(dir, "show"))
+	}
+}
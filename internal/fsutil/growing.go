@@ -0,0 +1,69 @@
+package fsutil
+
+import (
+	"os"
+	"time"
+)
+
+// IsGrowing reports whether a file is still being appended to e.g. a live recording, by comparing its size
+// before and after waiting interval.
+func IsGrowing(path string, interval time.Duration) (bool, error) {
+	return CheckGrowth([]string{path}, interval).IsGrowing(path)
+}
+
+// Growth holds the samples taken by CheckGrowth.
+type Growth struct {
+	samples map[string]growthSample
+}
+
+type growthSample struct {
+	last    os.FileInfo // the second sample
+	growing bool
+	err     error
+}
+
+// CheckGrowth samples the size and modification time of every path, waits interval once and samples them again,
+// so checking many files costs a single wait. Query the result with Growth.IsGrowing.
+func CheckGrowth(paths []string, interval time.Duration) Growth {
+	g := Growth{samples: make(map[string]growthSample, len(paths))}
+	first := make(map[string]os.FileInfo, len(paths))
+	for _, path := range paths {
+		info, err := os.Stat(path)
+		if err != nil {
+			g.samples[path] = growthSample{err: err}
+			continue
+		}
+		first[path] = info
+	}
+	if len(first) == 0 {
+		return g
+	}
+	time.Sleep(interval)
+	for path, before := range first {
+		after, err := os.Stat(path)
+		if err != nil {
+			g.samples[path] = growthSample{err: err}
+			continue
+		}
+		g.samples[path] = growthSample{last: after, growing: changed(before, after)}
+	}
+	return g
+}
+
+// IsGrowing reports whether path changed while it was sampled or has changed since, the latter costs a stat but
+// no wait. Paths that weren't sampled are reported as not growing.
+func (g Growth) IsGrowing(path string) (bool, error) {
+	sample, ok := g.samples[path]
+	if !ok || sample.err != nil || sample.growing {
+		return sample.growing, sample.err
+	}
+	now, err := os.Stat(path)
+	if err != nil {
+		return false, err
+	}
+	return changed(sample.last, now), nil
+}
+
+func changed(before, after os.FileInfo) bool {
+	return after.Size() != before.Size() || !after.ModTime().Equal(before.ModTime())
+}
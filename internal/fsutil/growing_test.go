@@ -0,0 +1,71 @@
+package fsutil
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestIsGrowing(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "recording.ts")
+	if err := os.WriteFile(path, []byte("header"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if growing, err := IsGrowing(path, 20*time.Millisecond); err != nil || growing {
+		t.Errorf("IsGrowing() of an idle file = %v, %v, want false", growing, err)
+	}
+
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 10; i++ {
+			f.Write([]byte("packet"))
+			time.Sleep(5 * time.Millisecond)
+		}
+	}()
+	if growing, err := IsGrowing(path, 30*time.Millisecond); err != nil || !growing {
+		t.Errorf("IsGrowing() of a file being appended = %v, %v, want true", growing, err)
+	}
+	<-done
+}
+
+func TestCheckGrowth(t *testing.T) {
+	dir := t.TempDir()
+	idle := filepath.Join(dir, "idle.ts")
+	appended := filepath.Join(dir, "appended.ts")
+	for _, path := range []string{idle, appended} {
+		if err := os.WriteFile(path, []byte("header"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	start := time.Now()
+	growth := CheckGrowth([]string{idle, appended, filepath.Join(dir, "gone.ts")}, 200*time.Millisecond)
+	if elapsed := time.Since(start); elapsed >= 400*time.Millisecond {
+		t.Errorf("CheckGrowth() took %s, want a single wait", elapsed)
+	}
+	if growing, err := growth.IsGrowing(idle); err != nil || growing {
+		t.Errorf("IsGrowing() of an idle file = %v, %v, want false", growing, err)
+	}
+	if _, err := growth.IsGrowing(filepath.Join(dir, "gone.ts")); !os.IsNotExist(err) {
+		t.Errorf("IsGrowing() of a missing file error = %v, want not exist", err)
+	}
+	if growing, err := growth.IsGrowing(filepath.Join(dir, "unsampled.ts")); err != nil || growing {
+		t.Errorf("IsGrowing() of an unsampled file = %v, %v, want false", growing, err)
+	}
+
+	// a file written after it was sampled still counts as growing
+	if err := os.WriteFile(appended, []byte("header and a packet"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if growing, err := growth.IsGrowing(appended); err != nil || !growing {
+		t.Errorf("IsGrowing() of a file written since sampling = %v, %v, want true", growing, err)
+	}
+}
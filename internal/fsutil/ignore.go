@@ -0,0 +1,96 @@
+package fsutil
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/bmatcuk/doublestar/v4"
+)
+
+// IgnoreFileName is the name of the gitignore style file at the root of a library listing paths to leave alone.
+const IgnoreFileName = ".transcodeignore"
+
+type ignoreRule struct {
+	pattern  string
+	negate   bool // pattern started with ! and re-includes matching paths
+	dirOnly  bool // pattern ended with / and only matches directories
+	anchored bool // pattern contained a / other than a trailing one and is relative to the root
+}
+
+// IgnoreMatcher implements the commonly used subset of gitignore syntax: comments, ! negation, trailing / for
+// directories, leading or inner / to anchor a pattern to the root, and * ? [] ** wildcards. As in git the last
+// matching pattern wins and files inside an ignored directory can't be re-included.
+type IgnoreMatcher struct {
+	rules []ignoreRule
+}
+
+// ParseIgnore reads ignore patterns, one per line.
+func ParseIgnore(r io.Reader) (*IgnoreMatcher, error) {
+	m := &IgnoreMatcher{}
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimRight(scanner.Text(), " \t\r")
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		var rule ignoreRule
+		if strings.HasPrefix(line, "!") {
+			rule.negate = true
+			line = line[1:]
+		} else if strings.HasPrefix(line, `\`) {
+			line = line[1:] // escaped leading # or !
+		}
+		if strings.HasSuffix(line, "/") {
+			rule.dirOnly = true
+			line = strings.TrimSuffix(line, "/")
+		}
+		if strings.Contains(line, "/") {
+			rule.anchored = true
+			line = strings.TrimPrefix(line, "/")
+		}
+		if line == "" || !doublestar.ValidatePattern(line) {
+			continue
+		}
+		rule.pattern = line
+		m.rules = append(m.rules, rule)
+	}
+	return m, scanner.Err()
+}
+
+// LoadIgnoreFile reads the ignore file in dir, returning nil if there is none.
+func LoadIgnoreFile(dir string) (*IgnoreMatcher, error) {
+	f, err := os.Open(filepath.Join(dir, IgnoreFileName))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return ParseIgnore(f)
+}
+
+// Ignored reports whether a path, slash separated and relative to the directory holding the ignore file, is
+// ignored. Parent directories are not consulted, callers walking a tree prune ignored directories instead.
+func (m *IgnoreMatcher) Ignored(relPath string, isDir bool) bool {
+	if m == nil {
+		return false
+	}
+	ignored := false
+	for _, rule := range m.rules {
+		if rule.dirOnly && !isDir {
+			continue
+		}
+		pattern := rule.pattern
+		if !rule.anchored {
+			pattern = "**/" + pattern
+		}
+		if match, _ := doublestar.Match(pattern, relPath); match {
+			ignored = !rule.negate
+		}
+	}
+	return ignored
+}
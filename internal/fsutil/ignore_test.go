@@ -0,0 +1,79 @@
+package fsutil
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestIgnoreMatcher(t *testing.T) {
+	m, err := ParseIgnore(strings.NewReader(`
+# samples and extras are never worth encoding
+*sample*
+Extras/
+/Movies/Keep/**/*.mkv
+!/Movies/Keep/**/*remaster*.mkv
+TV/**/Specials/
+`))
+	if err != nil {
+		t.Fatalf("ParseIgnore() error: %v", err)
+	}
+
+	tests := []struct {
+		path  string
+		isDir bool
+		want  bool
+	}{
+		{path: "Movies/Film (2001)/film-sample.mkv", want: true},
+		{path: "Movies/Film (2001)/film.mkv", want: false},
+		{path: "Movies/Film (2001)/Extras", isDir: true, want: true},
+		{path: "Movies/Film (2001)/Extras", isDir: false, want: false},
+		{path: "Movies/Keep/Film/film.mkv", want: true},
+		{path: "Movies/Keep/Film/film remaster.mkv", want: false},
+		{path: "Other/Movies/Keep/Film/film.mkv", want: false},
+		{path: "TV/Show/Specials", isDir: true, want: true},
+		{path: "TV/Show/Season 1", isDir: true, want: false},
+	}
+	for _, tc := range tests {
+		if got := m.Ignored(tc.path, tc.isDir); got != tc.want {
+			t.Errorf("Ignored(%q, dir %v) = %v, want %v", tc.path, tc.isDir, got, tc.want)
+		}
+	}
+
+	var none *IgnoreMatcher
+	if none.Ignored("anything.mkv", false) {
+		t.Errorf("nil matcher ignored a path")
+	}
+}
+
+func TestMediaInDirHonorsIgnoreFile(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		IgnoreFileName:                "Extras/\n*sample*\n!keep-sample.mkv\n",
+		"Film/film.mkv":               "",
+		"Film/film-sample.mkv":        "",
+		"Film/keep-sample.mkv":        "",
+		"Film/Extras/interview.mkv":   "",
+		"Film/Extras/keep-sample.mkv": "",
+	}
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	got, err := MediaInDir(dir)
+	if err != nil {
+		t.Fatalf("MediaInDir() error: %v", err)
+	}
+	want := []string{filepath.Join(dir, "Film/film.mkv"), filepath.Join(dir, "Film/keep-sample.mkv")}
+	if !slices.Equal(got, want) {
+		t.Errorf("MediaInDir() = %v, want %v", got, want)
+	}
+}
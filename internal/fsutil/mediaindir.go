@@ -10,13 +10,35 @@ import (
 	"go.uber.org/zap"
 )
 
-func MediaInDir(dir string) ([]string, error) {
+// MediaInDir lists the video files under dir, skipping paths matched by a .transcodeignore file at its root or by
+// any of the exclude globs, see Excluded.
+func MediaInDir(dir string, excludes ...string) ([]string, error) {
+	ignore, err := LoadIgnoreFile(dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", IgnoreFileName, err)
+	}
+
 	var matches []string
-	err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+	err = filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
 		if err != nil {
 			zap.S().Errorf("Failed to access directory: %v", err)
 			return fmt.Errorf("failed to access directory: %w", err)
 		}
+		if rel, err := filepath.Rel(dir, path); err == nil && rel != "." {
+			reason := ""
+			if ignore.Ignored(filepath.ToSlash(rel), info.IsDir()) {
+				reason = IgnoreFileName
+			} else if Excluded(excludes, rel) {
+				reason = "an exclude glob"
+			}
+			if reason != "" {
+				zap.S().Debugf("Ignoring %q matched by %s", path, reason)
+				if info.IsDir() {
+					return filepath.SkipDir
+				}
+				return nil
+			}
+		}
 		if info.IsDir() || !slices.Contains(ffmpegutil.VideoFileExts, filepath.Ext(path)) {
 			return nil
 		}
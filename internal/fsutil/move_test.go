@@ -0,0 +1,67 @@
+package fsutil
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestMoveFile(t *testing.T) {
+	dir := t.TempDir()
+	src := filepath.Join(dir, "movie.mkv")
+	dst := filepath.Join(dir, "trash", "Movies", "movie.mkv")
+	if err := os.WriteFile(src, []byte("original"), 0640); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := MoveFile(src, dst); err != nil {
+		t.Fatalf("MoveFile() error: %v", err)
+	}
+	if _, err := os.Stat(src); !os.IsNotExist(err) {
+		t.Errorf("source still exists after MoveFile(): %v", err)
+	}
+	if data, err := os.ReadFile(dst); err != nil || string(data) != "original" {
+		t.Errorf("moved file = %q, %v, want the original", data, err)
+	}
+
+	if err := os.WriteFile(src, []byte("another"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := MoveFile(src, dst); err == nil {
+		t.Errorf("MoveFile() onto an existing file succeeded, want an error")
+	}
+	if _, err := os.Stat(src); err != nil {
+		t.Errorf("source removed after a failed MoveFile(): %v", err)
+	}
+}
+
+func TestCopyFile(t *testing.T) {
+	dir := t.TempDir()
+	src := filepath.Join(dir, "movie.mkv")
+	dst := filepath.Join(dir, "copy.mkv")
+	if err := os.WriteFile(src, []byte("original"), 0640); err != nil {
+		t.Fatal(err)
+	}
+	modTime := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+	if err := os.Chtimes(src, modTime, modTime); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := CopyFile(src, dst); err != nil {
+		t.Fatalf("CopyFile() error: %v", err)
+	}
+	info, err := os.Stat(dst)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode().Perm() != 0640 || !info.ModTime().Equal(modTime) {
+		t.Errorf("copy has mode %v and modification time %v, want the source's", info.Mode().Perm(), info.ModTime())
+	}
+	if data, _ := os.ReadFile(dst); string(data) != "original" {
+		t.Errorf("copy = %q, want the original", data)
+	}
+	if entries, _ := os.ReadDir(dir); len(entries) != 2 {
+		t.Errorf("directory has %d entries after copying, want the source and the copy", len(entries))
+	}
+}
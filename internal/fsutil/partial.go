@@ -0,0 +1,32 @@
+package fsutil
+
+import (
+	"os"
+	"strings"
+)
+
+// partialDownloadSuffixes are appended by downloaders to incomplete files, or to a control file next to the file
+// being written as aria2 does. Files carrying a suffix are never listed since it hides the video extension.
+var partialDownloadSuffixes = []string{".part", ".partial", ".!qB", ".crdownload", ".aria2"}
+
+// PartialDownloadMarker returns the path of a file next to path showing that it is still being downloaded, e.g.
+// movie.mkv.aria2 for movie.mkv.
+func PartialDownloadMarker(path string) (string, bool) {
+	for _, suffix := range partialDownloadSuffixes {
+		if _, err := os.Lstat(path + suffix); err == nil {
+			return path + suffix, true
+		}
+	}
+	return "", false
+}
+
+// PartialDownloadTarget returns the file a partial download marker belongs to, e.g. movie.mkv for movie.mkv.aria2.
+// It reports false if path isn't named like a marker.
+func PartialDownloadTarget(path string) (string, bool) {
+	for _, suffix := range partialDownloadSuffixes {
+		if target, ok := strings.CutSuffix(path, suffix); ok {
+			return target, true
+		}
+	}
+	return "", false
+}
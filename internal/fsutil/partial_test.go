@@ -0,0 +1,45 @@
+package fsutil
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestPartialDownloadMarker(t *testing.T) {
+	dir := t.TempDir()
+	movie := filepath.Join(dir, "movie.mkv")
+	for _, name := range []string{"movie.mkv", "other.mkv", "other.mkv.!qB"} {
+		if err := os.WriteFile(filepath.Join(dir, name), nil, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if marker, ok := PartialDownloadMarker(movie); ok {
+		t.Errorf("PartialDownloadMarker() of a complete file = %q, want none", marker)
+	}
+
+	if err := os.WriteFile(movie+".aria2", nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if marker, ok := PartialDownloadMarker(movie); !ok || marker != movie+".aria2" {
+		t.Errorf("PartialDownloadMarker() = %q, %v, want the aria2 control file", marker, ok)
+	}
+
+	matches, err := MediaInDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(matches) != 2 {
+		t.Errorf("MediaInDir() = %v, want the two .mkv files without the qBittorrent partial", matches)
+	}
+}
+
+func TestPartialDownloadTarget(t *testing.T) {
+	if target, ok := PartialDownloadTarget("/media/movie.mkv.!qB"); !ok || target != "/media/movie.mkv" {
+		t.Errorf("PartialDownloadTarget() = %q, %v, want /media/movie.mkv", target, ok)
+	}
+	if target, ok := PartialDownloadTarget("/media/movie.mkv"); ok {
+		t.Errorf("PartialDownloadTarget() of a video = %q, want none", target)
+	}
+}
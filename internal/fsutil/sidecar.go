@@ -0,0 +1,47 @@
+package fsutil
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// Sidecar is a file that belongs to a media file by its name, e.g. movie.en.srt, movie.nfo or movie-poster.jpg
+// next to movie.mkv.
+type Sidecar struct {
+	Path   string
+	Suffix string // the name after the media file's own name without extension e.g. .en.srt or -poster.jpg
+}
+
+// FindSidecars lists the files next to mediaPath named after it, its name without extension followed by . or -,
+// whose extension is one of exts e.g. srt or .nfo. Extensions are compared case insensitively.
+func FindSidecars(mediaPath string, exts []string) ([]Sidecar, error) {
+	dir := filepath.Dir(mediaPath)
+	stem := strings.TrimSuffix(filepath.Base(mediaPath), filepath.Ext(mediaPath))
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	var wanted []string
+	for _, ext := range exts {
+		wanted = append(wanted, "."+strings.ToLower(strings.TrimPrefix(strings.TrimSpace(ext), ".")))
+	}
+	var sidecars []Sidecar
+	for _, entry := range entries {
+		name := entry.Name()
+		if !entry.Type().IsRegular() || name == filepath.Base(mediaPath) {
+			continue
+		}
+		suffix, ok := strings.CutPrefix(name, stem)
+		if !ok || (!strings.HasPrefix(suffix, ".") && !strings.HasPrefix(suffix, "-")) {
+			continue
+		}
+		if !slices.Contains(wanted, strings.ToLower(filepath.Ext(name))) {
+			continue
+		}
+		sidecars = append(sidecars, Sidecar{Path: filepath.Join(dir, name), Suffix: suffix})
+	}
+	return sidecars, nil
+}
@@ -0,0 +1,40 @@
+package fsutil
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+func TestFindSidecars(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{
+		"movie.mkv", "movie.srt", "movie.en.forced.SRT", "movie.nfo", "movie-poster.jpg",
+		"movie.txt", "movie2.srt", "other.srt", "moviex.nfo",
+	} {
+		if err := os.WriteFile(filepath.Join(dir, name), nil, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.Mkdir(filepath.Join(dir, "movie.nfo.d"), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	sidecars, err := FindSidecars(filepath.Join(dir, "movie.mkv"), []string{"srt", ".nfo", "jpg", "mkv"})
+	if err != nil {
+		t.Fatalf("FindSidecars() error: %v", err)
+	}
+	var suffixes []string
+	for _, s := range sidecars {
+		if s.Path != filepath.Join(dir, "movie"+s.Suffix) {
+			t.Errorf("FindSidecars() sidecar %q has suffix %q", s.Path, s.Suffix)
+		}
+		suffixes = append(suffixes, s.Suffix)
+	}
+	slices.Sort(suffixes)
+	want := []string{"-poster.jpg", ".en.forced.SRT", ".nfo", ".srt"}
+	if !slices.Equal(suffixes, want) {
+		t.Errorf("FindSidecars() suffixes = %v, want %v", suffixes, want)
+	}
+}
@@ -0,0 +1,27 @@
+package fsutil
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"syscall"
+)
+
+// CheckWritable verifies that files can be created in dir by creating and removing a temporary file.
+func CheckWritable(dir string) error {
+	f, err := os.CreateTemp(dir, ".gtranscoder-writecheck-*")
+	if err != nil {
+		return err
+	}
+	name := f.Name()
+	if err := f.Close(); err != nil {
+		os.Remove(name)
+		return err
+	}
+	return os.Remove(name)
+}
+
+// IsWriteDenied reports whether err was caused by missing write permission or a read-only filesystem.
+func IsWriteDenied(err error) bool {
+	return errors.Is(err, fs.ErrPermission) || errors.Is(err, syscall.EROFS)
+}
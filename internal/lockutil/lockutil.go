@@ -7,15 +7,57 @@ import (
 	"fmt"
 	"io"
 	"os"
+	"path/filepath"
+	"strings"
 	"sync"
 	"syscall"
+	"time"
 
 	"github.com/gofrs/flock"
 )
 
 type namedLockSetEntry struct {
-	Name string `json:"name"`
-	PID  int    `json:"pid"`
+	Name       string    `json:"name"`
+	PID        int       `json:"pid"`
+	Tree       bool      `json:"tree,omitempty"`        // the lock covers Name and every path beneath it
+	AcquiredAt time.Time `json:"acquired_at,omitempty"` // zero for entries written by older versions
+}
+
+// stale reports whether the entry's holder is gone. The holder is gone if its PID isn't running, or if the entry
+// is older than maxAge and its PID now belongs to a process that isn't the same program, i.e. the PID was
+// recycled. A maxAge of 0 disables the age check.
+func (e namedLockSetEntry) stale(now time.Time, maxAge time.Duration) bool {
+	if !checkPIDRunning(e.PID) {
+		return true
+	}
+	if maxAge <= 0 || e.AcquiredAt.IsZero() || now.Sub(e.AcquiredAt) <= maxAge {
+		return false
+	}
+	return !runsSameProgram(e.PID)
+}
+
+// conflicts reports whether the entry prevents acquiring a lock on name. Plain locks conflict on an exact name
+// match. A tree lock on a directory additionally conflicts with locks on any path beneath it, and a lock on a
+// path conflicts with tree locks on any of its parent directories.
+func (e namedLockSetEntry) conflicts(name string, tree bool) bool {
+	if e.Name == name {
+		return true
+	}
+	if e.Tree && isWithin(name, e.Name) {
+		return true
+	}
+	return tree && isWithin(e.Name, name)
+}
+
+// isWithin reports whether path is dir or beneath it.
+func isWithin(path, dir string) bool {
+	if path == dir {
+		return true
+	}
+	if !strings.HasSuffix(dir, string(filepath.Separator)) {
+		dir += string(filepath.Separator)
+	}
+	return strings.HasPrefix(path, dir)
 }
 
 var ErrLockAlreadyHeld = errors.New("lock already held")
@@ -23,6 +65,10 @@ var ErrLockAlreadyHeld = errors.New("lock already held")
 type NamedLockSet struct {
 	mu   sync.Mutex
 	File string
+
+	// MaxAge is the age after which an entry whose PID no longer runs this program is reclaimed as stale,
+	// guarding against PIDs recycled by unrelated processes. 0 only reclaims entries whose PID isn't running.
+	MaxAge time.Duration
 }
 
 // openLockedFile opens the lock file and returns the file handle and filesystem lock
@@ -77,7 +123,20 @@ func writeLockEntries(f *os.File, locks []namedLockSetEntry) error {
 	return nil
 }
 
+// TryAcquire acquires the named lock, it fails with ErrLockAlreadyHeld if the name is locked or is a path beneath a
+// directory locked with TryAcquireTree.
 func (nls *NamedLockSet) TryAcquire(name string) error {
+	return nls.tryAcquire(name, false)
+}
+
+// TryAcquireTree acquires an exclusive lock on a directory and everything beneath it. It fails with
+// ErrLockAlreadyHeld if the directory, any path beneath it, or any parent directory held as a tree is locked.
+// Release the lock with Release(dir).
+func (nls *NamedLockSet) TryAcquireTree(dir string) error {
+	return nls.tryAcquire(filepath.Clean(dir), true)
+}
+
+func (nls *NamedLockSet) tryAcquire(name string, tree bool) error {
 	nls.mu.Lock()
 	defer nls.mu.Unlock()
 
@@ -97,22 +156,58 @@ func (nls *NamedLockSet) TryAcquire(name string) error {
 
 	// Check if lock is already held
 	var keepLocks []namedLockSetEntry
+	now := time.Now()
 	for _, entry := range locks {
-		if !checkPIDRunning(entry.PID) {
+		if entry.stale(now, nls.MaxAge) {
 			continue
 		}
-		if entry.Name == name {
-			return fmt.Errorf("%w: by PID %d", ErrLockAlreadyHeld, entry.PID)
+		if entry.conflicts(name, tree) {
+			return fmt.Errorf("%w: %q by PID %d", ErrLockAlreadyHeld, entry.Name, entry.PID)
 		}
 		keepLocks = append(keepLocks, entry)
 	}
 
 	// Add new lock entry
-	keepLocks = append(keepLocks, namedLockSetEntry{Name: name, PID: os.Getpid()})
+	keepLocks = append(keepLocks, namedLockSetEntry{Name: name, PID: os.Getpid(), Tree: tree, AcquiredAt: now})
 	return writeLockEntries(f, keepLocks)
 }
 
+// Reclaim removes every stale entry from the lock set and returns how many it removed.
+func (nls *NamedLockSet) Reclaim() (int, error) {
+	nls.mu.Lock()
+	defer nls.mu.Unlock()
+
+	f, lock, err := nls.openLockedFile()
+	if err != nil {
+		return 0, err
+	}
+	defer func() {
+		f.Close()
+		lock.Unlock()
+	}()
+
+	locks, err := readLockEntries(f)
+	if err != nil {
+		return 0, err
+	}
+
+	now := time.Now()
+	keepLocks := make([]namedLockSetEntry, 0, len(locks))
+	for _, entry := range locks {
+		if !entry.stale(now, nls.MaxAge) {
+			keepLocks = append(keepLocks, entry)
+		}
+	}
+	if len(keepLocks) == len(locks) {
+		return 0, nil
+	}
+	return len(locks) - len(keepLocks), writeLockEntries(f, keepLocks)
+}
+
+// Release releases a lock held by this process acquired with TryAcquire or TryAcquireTree. Names are compared as
+// cleaned paths, as TryAcquireTree stores them, so "dir/" releases the tree lock acquired as "dir/".
 func (nls *NamedLockSet) Release(name string) error {
+	name = filepath.Clean(name)
 	nls.mu.Lock()
 	defer nls.mu.Unlock()
 
@@ -133,7 +228,7 @@ func (nls *NamedLockSet) Release(name string) error {
 	// Remove matching entries
 	newLocks := make([]namedLockSetEntry, 0, len(locks))
 	for _, entry := range locks {
-		if entry.Name != name || entry.PID != os.Getpid() {
+		if filepath.Clean(entry.Name) != name || entry.PID != os.Getpid() {
 			newLocks = append(newLocks, entry)
 		}
 	}
@@ -141,6 +236,21 @@ func (nls *NamedLockSet) Release(name string) error {
 	return writeLockEntries(f, newLocks)
 }
 
+// runsSameProgram reports whether pid runs the same executable as this process. It is a variable so tests can
+// simulate a recycled PID. Where the executable can't be determined it conservatively reports true.
+var runsSameProgram = func(pid int) bool {
+	exe, err := os.Readlink(fmt.Sprintf("/proc/%d/exe", pid))
+	if err != nil {
+		return true
+	}
+	self, err := os.Executable()
+	if err != nil {
+		return true
+	}
+	exe = strings.TrimSuffix(exe, " (deleted)") // the binary was replaced since the process started
+	return exe == self || filepath.Base(exe) == filepath.Base(self)
+}
+
 func checkPIDRunning(pid int) bool {
 	process, err := os.FindProcess(pid)
 	if err != nil {
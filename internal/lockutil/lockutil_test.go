@@ -2,7 +2,9 @@ package lockutil
 
 import (
 	"errors"
+	"os"
 	"testing"
+	"time"
 )
 
 func TestNamedLock(t *testing.T) {
@@ -22,3 +24,102 @@ func TestNamedLock(t *testing.T) {
 	}
 	nls.Release("test")
 }
+
+func TestTreeLock(t *testing.T) {
+	nls := &NamedLockSet{
+		File: t.TempDir() + "/testlock",
+	}
+
+	if err := nls.TryAcquire("/media/tv/show/s01e01.mkv"); err != nil {
+		t.Fatalf("Expected nil, got %v", err)
+	}
+	// a tree lock conflicts with locks on paths beneath it
+	if err := nls.TryAcquireTree("/media/tv/show"); !errors.Is(err, ErrLockAlreadyHeld) {
+		t.Errorf("Expected ErrLockAlreadyHeld, got %v", err)
+	}
+	if err := nls.TryAcquireTree("/media/tv"); !errors.Is(err, ErrLockAlreadyHeld) {
+		t.Errorf("Expected ErrLockAlreadyHeld, got %v", err)
+	}
+	// but not with sibling directories sharing a name prefix
+	if err := nls.TryAcquireTree("/media/tv/show2/"); err != nil {
+		t.Errorf("Expected nil, got %v", err)
+	}
+	nls.Release("/media/tv/show/s01e01.mkv")
+
+	if err := nls.TryAcquireTree("/media/tv/show/"); err != nil {
+		t.Fatalf("Expected nil, got %v", err)
+	}
+	// locks on paths beneath a tree lock, and on the locked tree's parents, conflict with it
+	if err := nls.TryAcquire("/media/tv/show/s01e02.mkv"); !errors.Is(err, ErrLockAlreadyHeld) {
+		t.Errorf("Expected ErrLockAlreadyHeld, got %v", err)
+	}
+	if err := nls.TryAcquireTree("/media"); !errors.Is(err, ErrLockAlreadyHeld) {
+		t.Errorf("Expected ErrLockAlreadyHeld, got %v", err)
+	}
+	if err := nls.TryAcquire("/media/tv/show2/s01e01.mkv"); !errors.Is(err, ErrLockAlreadyHeld) {
+		t.Errorf("Expected ErrLockAlreadyHeld beneath the show2 tree lock, got %v", err)
+	}
+	if err := nls.TryAcquire("/media/tv/other/s01e01.mkv"); err != nil {
+		t.Errorf("Expected nil, got %v", err)
+	}
+
+	nls.Release("/media/tv/show")
+	if err := nls.TryAcquire("/media/tv/show/s01e02.mkv"); err != nil {
+		t.Errorf("Expected nil, got %v", err)
+	}
+}
+
+func TestReleaseTreeWithTrailingSlash(t *testing.T) {
+	nls := &NamedLockSet{
+		File: t.TempDir() + "/testlock",
+	}
+	if err := nls.TryAcquireTree("dir/"); err != nil {
+		t.Fatalf("Expected nil, got %v", err)
+	}
+	if err := nls.Release("dir/"); err != nil {
+		t.Fatalf("Expected nil, got %v", err)
+	}
+	if err := nls.TryAcquire("dir/file.mkv"); err != nil {
+		t.Errorf("Expected the tree lock to be released, got %v", err)
+	}
+}
+
+func TestStaleLockReclaimedByAge(t *testing.T) {
+	recycled := true
+	orig := runsSameProgram
+	runsSameProgram = func(pid int) bool { return !recycled }
+	t.Cleanup(func() { runsSameProgram = orig })
+
+	file := t.TempDir() + "/testlock"
+	// an entry from a dead encode whose PID, our own here so that it is running, was recycled
+	old := namedLockSetEntry{Name: "old", PID: os.Getpid(), AcquiredAt: time.Now().Add(-72 * time.Hour)}
+	f, err := os.Create(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := writeLockEntries(f, []namedLockSetEntry{old}); err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+
+	nls := &NamedLockSet{File: file}
+	if err := nls.TryAcquire("old"); !errors.Is(err, ErrLockAlreadyHeld) {
+		t.Errorf("TryAcquire() without MaxAge = %v, want ErrLockAlreadyHeld", err)
+	}
+
+	nls.MaxAge = 24 * time.Hour
+	recycled = false
+	if n, err := nls.Reclaim(); err != nil || n != 0 {
+		t.Errorf("Reclaim() of an old entry still held by this program = %d, %v, want 0", n, err)
+	}
+	recycled = true
+	if n, err := nls.Reclaim(); err != nil || n != 1 {
+		t.Errorf("Reclaim() = %d, %v, want 1", n, err)
+	}
+	if err := nls.TryAcquire("old"); err != nil {
+		t.Errorf("TryAcquire() after reclaiming = %v, want nil", err)
+	}
+	if n, err := nls.Reclaim(); err != nil || n != 0 {
+		t.Errorf("Reclaim() of a fresh entry = %d, %v, want 0", n, err)
+	}
+}
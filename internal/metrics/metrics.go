@@ -0,0 +1,228 @@
+// Package metrics keeps the operational metrics of the transcoder and serves them in the Prometheus text format.
+// Only the few metric types the transcoder needs are implemented, without labels beyond a single one.
+package metrics
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+var (
+	FilesProcessed = newCounterVec("transcoder_files_processed_total", "Files examined by the transcoder by outcome.", "outcome",
+		OutcomeEncoded, OutcomeSkipped, OutcomeFailed, OutcomeAlreadyDone)
+	InputBytes      = newCounter("transcoder_input_bytes_total", "Size of the sources of finished encodes.")
+	BytesSaved      = newCounter("transcoder_bytes_saved_total", "Size of the sources of finished encodes less the size of their outputs, encodes larger than their source count as 0.")
+	EncodeDuration  = newHistogram("transcoder_encode_duration_seconds", "Wall time of finished encodes.", exponentialBuckets(60, 2, 10))
+	EncodesInFlight = newGauge("transcoder_encodes_in_flight", "Encodes currently running.")
+)
+
+// Outcomes of FilesProcessed.
+const (
+	OutcomeEncoded     = "encoded"
+	OutcomeSkipped     = "skipped"
+	OutcomeFailed      = "failed"
+	OutcomeAlreadyDone = "already_done"
+)
+
+type metric interface {
+	write(w io.Writer)
+}
+
+// registry holds every metric in the order they are served.
+var registry []metric
+
+// Counter is a value that only increases.
+type Counter struct {
+	name, help string
+	mu         sync.Mutex
+	value      float64
+}
+
+func newCounter(name, help string) *Counter {
+	c := &Counter{name: name, help: help}
+	registry = append(registry, c)
+	return c
+}
+
+func (c *Counter) Add(v float64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.value += v
+}
+
+func (c *Counter) Value() float64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.value
+}
+
+func (c *Counter) write(w io.Writer) {
+	writeHeader(w, c.name, c.help, "counter")
+	fmt.Fprintf(w, "%s %s\n", c.name, formatValue(c.Value()))
+}
+
+// CounterVec is a counter for each value of a label.
+type CounterVec struct {
+	name, help, label string
+	mu                sync.Mutex
+	values            map[string]float64
+}
+
+// newCounterVec returns a counter reporting the initial label values from the start, so that rates work before the
+// first increment of each.
+func newCounterVec(name, help, label string, initial ...string) *CounterVec {
+	c := &CounterVec{name: name, help: help, label: label, values: make(map[string]float64)}
+	for _, v := range initial {
+		c.values[v] = 0
+	}
+	registry = append(registry, c)
+	return c
+}
+
+func (c *CounterVec) Inc(labelValue string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.values[labelValue]++
+}
+
+func (c *CounterVec) Value(labelValue string) float64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.values[labelValue]
+}
+
+func (c *CounterVec) write(w io.Writer) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	writeHeader(w, c.name, c.help, "counter")
+	labelValues := make([]string, 0, len(c.values))
+	for v := range c.values {
+		labelValues = append(labelValues, v)
+	}
+	slices.Sort(labelValues)
+	for _, v := range labelValues {
+		fmt.Fprintf(w, "%s{%s=\"%s\"} %s\n", c.name, c.label, labelEscaper.Replace(v), formatValue(c.values[v]))
+	}
+}
+
+// Gauge is a value that goes up and down.
+type Gauge struct {
+	name, help string
+	mu         sync.Mutex
+	value      float64
+}
+
+func newGauge(name, help string) *Gauge {
+	g := &Gauge{name: name, help: help}
+	registry = append(registry, g)
+	return g
+}
+
+func (g *Gauge) Add(v float64) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.value += v
+}
+
+func (g *Gauge) Inc() { g.Add(1) }
+func (g *Gauge) Dec() { g.Add(-1) }
+
+func (g *Gauge) Value() float64 {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return g.value
+}
+
+func (g *Gauge) write(w io.Writer) {
+	writeHeader(w, g.name, g.help, "gauge")
+	fmt.Fprintf(w, "%s %s\n", g.name, formatValue(g.Value()))
+}
+
+// Histogram counts observations into buckets by upper bound.
+type Histogram struct {
+	name, help string
+	buckets    []float64 // upper bounds in increasing order, +Inf is implied
+	mu         sync.Mutex
+	counts     []uint64 // per bucket, not cumulative
+	count      uint64
+	sum        float64
+}
+
+func newHistogram(name, help string, buckets []float64) *Histogram {
+	h := &Histogram{name: name, help: help, buckets: buckets, counts: make([]uint64, len(buckets))}
+	registry = append(registry, h)
+	return h
+}
+
+func (h *Histogram) Observe(v float64) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if i, _ := slices.BinarySearch(h.buckets, v); i < len(h.buckets) {
+		h.counts[i]++
+	}
+	h.count++
+	h.sum += v
+}
+
+func (h *Histogram) write(w io.Writer) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	writeHeader(w, h.name, h.help, "histogram")
+	var cumulative uint64
+	for i, bound := range h.buckets {
+		cumulative += h.counts[i]
+		fmt.Fprintf(w, "%s_bucket{le=\"%s\"} %d\n", h.name, formatValue(bound), cumulative)
+	}
+	fmt.Fprintf(w, "%s_bucket{le=\"+Inf\"} %d\n", h.name, h.count)
+	fmt.Fprintf(w, "%s_sum %s\n", h.name, formatValue(h.sum))
+	fmt.Fprintf(w, "%s_count %d\n", h.name, h.count)
+}
+
+// exponentialBuckets returns count bucket bounds starting at start, each factor times the previous.
+func exponentialBuckets(start, factor float64, count int) []float64 {
+	buckets := make([]float64, count)
+	for i := range buckets {
+		buckets[i] = start
+		start *= factor
+	}
+	return buckets
+}
+
+func writeHeader(w io.Writer, name, help, kind string) {
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, kind)
+}
+
+func formatValue(v float64) string {
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+// labelEscaper escapes a label value for the text format.
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+// Write writes every metric in the Prometheus text format.
+func Write(w io.Writer) {
+	for _, m := range registry {
+		m.write(w)
+	}
+}
+
+// Handler serves the metrics in the Prometheus text format.
+func Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		Write(w)
+	})
+}
+
+// Serve serves the metrics at /metrics on ln until it fails.
+func Serve(ln net.Listener) error {
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", Handler())
+	return http.Serve(ln, mux)
+}
@@ -0,0 +1,35 @@
+package metrics
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestHandler(t *testing.T) {
+	FilesProcessed.Inc(OutcomeEncoded)
+	EncodesInFlight.Inc()
+	h := newHistogram("test_duration_seconds", "Test durations.", []float64{1, 10})
+	h.Observe(0.5)
+	h.Observe(5)
+	h.Observe(100)
+
+	rec := httptest.NewRecorder()
+	Handler().ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+	body := rec.Body.String()
+	for _, want := range []string{
+		"# TYPE transcoder_files_processed_total counter\n",
+		`transcoder_files_processed_total{outcome="encoded"} 1` + "\n",
+		`transcoder_files_processed_total{outcome="failed"} 0` + "\n",
+		"transcoder_encodes_in_flight 1\n",
+		`test_duration_seconds_bucket{le="1"} 1` + "\n",
+		`test_duration_seconds_bucket{le="10"} 2` + "\n",
+		`test_duration_seconds_bucket{le="+Inf"} 3` + "\n",
+		"test_duration_seconds_sum 105.5\n",
+		"test_duration_seconds_count 3\n",
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("metrics missing %q:\n%s", want, body)
+		}
+	}
+}